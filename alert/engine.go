@@ -0,0 +1,205 @@
+package alert
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+
+	defaultResolvedRetention = 1 * time.Hour
+	maxResolvedAlerts        = 200
+)
+
+// Alert 规则在某个实例上的告警状态
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Instance   string            `json:"instance,omitempty"`
+	Expr       string            `json:"expr"`
+	Severity   string            `json:"severity"`
+	State      string            `json:"state"`
+	Value      float64           `json:"value"`
+	Summary    string            `json:"summary"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	ActiveAt   time.Time         `json:"activeAt"`            // 条件首次成立的时间
+	FiredAt    time.Time         `json:"firedAt,omitzero"`    // 进入 firing 的时间
+	ResolvedAt time.Time         `json:"resolvedAt,omitzero"` // 恢复的时间
+	LastEvalAt time.Time         `json:"lastEvalAt"`          // 最后一次评估时间
+}
+
+// Key 告警的唯一标识
+func (a *Alert) Key() string {
+	return a.Rule + "\x00" + a.Instance
+}
+
+// Event 告警状态变化，State 为变化后的状态
+type Event struct {
+	Alert Alert
+	From  string
+}
+
+// Engine 在每次采样时评估规则，维护 pending → firing → resolved 状态机
+type Engine struct {
+	mu                sync.RWMutex
+	rules             []*Rule
+	active            map[string]*Alert
+	resolved          []Alert
+	resolvedRetention time.Duration
+}
+
+func NewEngine(rules []*Rule) *Engine {
+	return &Engine{
+		rules:             rules,
+		active:            make(map[string]*Alert),
+		resolvedRetention: defaultResolvedRetention,
+	}
+}
+
+// SetRules 替换规则；已删除规则的活跃告警直接丢弃
+func (e *Engine) SetRules(rules []*Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		names[rule.Name] = struct{}{}
+	}
+	for key, a := range e.active {
+		if _, ok := names[a.Rule]; !ok {
+			delete(e.active, key)
+		}
+	}
+	e.rules = rules
+}
+
+func (e *Engine) Rules() []*Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.rules
+}
+
+// Evaluate 使用一次采样的数据评估所有规则，返回本次发生的状态变化
+func (e *Engine) Evaluate(now time.Time, values map[string]float64) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []Event
+	seen := make(map[string]struct{})
+	for _, rule := range e.rules {
+		for _, instance := range rule.expr.Instances(values) {
+			key := rule.Name + "\x00" + instance
+			current, isActive := e.active[key]
+			hysteresis := 0.0
+			if isActive && current.State == StateFiring {
+				hysteresis = rule.Hysteresis
+			}
+			matched, value, ok := rule.expr.Eval(values, instance, hysteresis)
+			if !ok {
+				// 缺少数据时保持原状态，不做判断
+				if isActive {
+					seen[key] = struct{}{}
+				}
+				continue
+			}
+			if !matched {
+				continue
+			}
+			seen[key] = struct{}{}
+			if !isActive {
+				current = &Alert{
+					Rule:     rule.Name,
+					Instance: instance,
+					Expr:     rule.Expr,
+					Severity: rule.Severity,
+					State:    StatePending,
+					Labels:   rule.Labels,
+					ActiveAt: now,
+				}
+				e.active[key] = current
+			}
+			current.Value = value
+			current.LastEvalAt = now
+			current.Summary = rule.renderSummary(current)
+			if !isActive {
+				events = append(events, Event{Alert: *current})
+			}
+			if current.State == StatePending && now.Sub(current.ActiveAt) >= time.Duration(rule.For) {
+				current.State = StateFiring
+				current.FiredAt = now
+				events = append(events, Event{Alert: *current, From: StatePending})
+			}
+		}
+	}
+
+	for key, a := range e.active {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		delete(e.active, key)
+		if a.State != StateFiring {
+			// pending 期间条件不再成立，直接丢弃
+			continue
+		}
+		a.State = StateResolved
+		a.ResolvedAt = now
+		a.LastEvalAt = now
+		e.resolved = append(e.resolved, *a)
+		events = append(events, Event{Alert: *a, From: StateFiring})
+	}
+	e.pruneResolved(now)
+	return events
+}
+
+func (e *Engine) pruneResolved(now time.Time) {
+	cutoff := now.Add(-e.resolvedRetention)
+	i := 0
+	for i < len(e.resolved) && e.resolved[i].ResolvedAt.Before(cutoff) {
+		i++
+	}
+	if len(e.resolved)-i > maxResolvedAlerts {
+		i = len(e.resolved) - maxResolvedAlerts
+	}
+	e.resolved = slices.Clone(e.resolved[i:])
+}
+
+// Active 返回 pending 与 firing 状态的告警，按严重程度与开始时间排序
+func (e *Engine) Active() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	alerts := make([]Alert, 0, len(e.active))
+	for _, a := range e.active {
+		alerts = append(alerts, *a)
+	}
+	slices.SortFunc(alerts, func(a, b Alert) int {
+		if d := severityRank(b.Severity) - severityRank(a.Severity); d != 0 {
+			return d
+		}
+		return a.ActiveAt.Compare(b.ActiveAt)
+	})
+	return alerts
+}
+
+// Resolved 返回最近恢复的告警，最新的在前
+func (e *Engine) Resolved() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	alerts := slices.Clone(e.resolved)
+	slices.Reverse(alerts)
+	if alerts == nil {
+		alerts = []Alert{}
+	}
+	return alerts
+}
+
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 2
+	case SeverityWarning:
+		return 1
+	}
+	return 0
+}
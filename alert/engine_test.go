@@ -0,0 +1,143 @@
+package alert
+
+import (
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+func newTestEngine(t *testing.T, rules ...*Rule) *Engine {
+	t.Helper()
+	if err := CompileRules(rules, nil); err != nil {
+		t.Fatal(err)
+	}
+	return NewEngine(rules)
+}
+
+func states(events []Event) []string {
+	var out []string
+	for _, e := range events {
+		out = append(out, e.From+"->"+e.Alert.State)
+	}
+	return out
+}
+
+// pending 在 for 时长恰好经过时进入 firing
+func TestEvaluateForDuration(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "HighLoad", Expr: "load1 > 8", For: Duration(time.Minute)})
+	high := map[string]float64{"load1": 10}
+
+	steps := []struct {
+		at   time.Duration
+		want []string
+	}{
+		{0, []string{"->pending"}},
+		{30 * time.Second, nil},
+		{time.Minute - time.Nanosecond, nil},
+		{time.Minute, []string{"pending->firing"}},
+		{2 * time.Minute, nil},
+	}
+	for _, step := range steps {
+		got := states(e.Evaluate(testNow.Add(step.at), high))
+		if len(got) != len(step.want) || (len(got) > 0 && got[0] != step.want[0]) {
+			t.Fatalf("at %v: events = %q, want %q", step.at, got, step.want)
+		}
+	}
+	active := e.Active()
+	if len(active) != 1 || !active[0].FiredAt.Equal(testNow.Add(time.Minute)) || !active[0].ActiveAt.Equal(testNow) {
+		t.Fatalf("active = %+v", active)
+	}
+}
+
+// pending 期间条件不再成立时直接丢弃，不产生 resolved
+func TestEvaluatePendingDropped(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "HighLoad", Expr: "load1 > 8", For: Duration(time.Minute)})
+	e.Evaluate(testNow, map[string]float64{"load1": 10})
+	if got := states(e.Evaluate(testNow.Add(10*time.Second), map[string]float64{"load1": 1})); len(got) != 0 {
+		t.Fatalf("events = %q, want none", got)
+	}
+	if len(e.Active()) != 0 || len(e.Resolved()) != 0 {
+		t.Fatalf("active = %v, resolved = %v, want none", e.Active(), e.Resolved())
+	}
+}
+
+// 已触发的告警在触发阈值与恢复阈值之间保持 firing
+func TestEvaluateHysteresis(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "HighMemory", Expr: "memoryUsedPercent > 90", Hysteresis: 5})
+	steps := []struct {
+		value float64
+		want  string
+	}{
+		{95, StateFiring},
+		{88, StateFiring},
+		{85.5, StateFiring},
+		{84, ""},
+		{88, ""}, // 已恢复，需要重新超过 90 才触发
+		{91, StateFiring},
+	}
+	for i, step := range steps {
+		e.Evaluate(testNow.Add(time.Duration(i)*time.Second), map[string]float64{"memoryUsedPercent": step.value})
+		state := ""
+		if active := e.Active(); len(active) == 1 {
+			state = active[0].State
+		}
+		if state != step.want {
+			t.Fatalf("step %d value %v: state = %q, want %q", i, step.value, state, step.want)
+		}
+	}
+	if resolved := e.Resolved(); len(resolved) != 1 || resolved[0].Value != 85.5 {
+		t.Fatalf("resolved = %+v, want one alert with the last firing value", resolved)
+	}
+}
+
+// 通配符规则为每个实例单独维护状态
+func TestEvaluateWildcardInstances(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "DiskFull", Expr: "disk.*.usedPercent > 85"})
+	events := e.Evaluate(testNow, map[string]float64{"disk./.usedPercent": 90, "disk./data.usedPercent": 95, "disk./boot.usedPercent": 10})
+	if got := states(events); len(got) != 4 {
+		t.Fatalf("events = %q, want pending and firing for two instances", got)
+	}
+	events = e.Evaluate(testNow.Add(time.Second), map[string]float64{"disk./.usedPercent": 50, "disk./data.usedPercent": 95, "disk./boot.usedPercent": 10})
+	if len(events) != 1 || events[0].Alert.Instance != "/" || events[0].Alert.State != StateResolved {
+		t.Fatalf("events = %+v, want / resolved", events)
+	}
+	if active := e.Active(); len(active) != 1 || active[0].Instance != "/data" {
+		t.Fatalf("active = %+v, want /data", active)
+	}
+}
+
+// 缺少数据时保持原状态
+func TestEvaluateMissingDataKeepsState(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "HighLoad", Expr: "load1 > 8"})
+	e.Evaluate(testNow, map[string]float64{"load1": 10})
+	if events := e.Evaluate(testNow.Add(time.Second), map[string]float64{"load5": 1}); len(events) != 0 {
+		t.Fatalf("events = %+v, want none", events)
+	}
+	if active := e.Active(); len(active) != 1 || active[0].State != StateFiring {
+		t.Fatalf("active = %+v, want firing", active)
+	}
+}
+
+// 恢复列表按保留时间和数量上限裁剪
+func TestPruneResolved(t *testing.T) {
+	e := newTestEngine(t, &Rule{Name: "DiskFull", Expr: "disk.*.usedPercent > 85"})
+	fire := make(map[string]float64)
+	for i := range maxResolvedAlerts + 10 {
+		fire["disk./"+string(rune('a'+i%26))+string(rune('a'+i/26))+".usedPercent"] = 90
+	}
+	e.Evaluate(testNow, fire)
+	e.Evaluate(testNow.Add(time.Second), map[string]float64{})
+	if got := len(e.Resolved()); got != maxResolvedAlerts {
+		t.Fatalf("resolved = %d, want the cap %d", got, maxResolvedAlerts)
+	}
+
+	e.Evaluate(testNow.Add(defaultResolvedRetention), map[string]float64{})
+	if got := len(e.Resolved()); got != maxResolvedAlerts {
+		t.Fatalf("resolved at the retention boundary = %d, want %d", got, maxResolvedAlerts)
+	}
+	e.Evaluate(testNow.Add(defaultResolvedRetention+2*time.Second), map[string]float64{})
+	if got := len(e.Resolved()); got != 0 {
+		t.Fatalf("resolved after retention = %d, want 0", got)
+	}
+}
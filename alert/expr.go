@@ -0,0 +1,331 @@
+package alert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 表达式语法：
+//
+//	expr       := orExpr
+//	orExpr     := andExpr { ("||" | "or") andExpr }
+//	andExpr    := unary { ("&&" | "and") unary }
+//	unary      := ("!" | "not") unary | "(" expr ")" | comparison
+//	comparison := operand (">" | ">=" | "<" | "<=" | "==" | "!=") operand
+//	operand    := 数字 | 字段名 | "带空格的字段名"
+//
+// 字段名可以包含一个 "*" 通配符（如 disk.*.usedPercent），每个匹配到的实例单独产生告警；
+// 同一表达式中的多个通配符字段共用同一个匹配值。
+
+// Expr 编译后的告警表达式
+type Expr struct {
+	source   string
+	root     node
+	fields   []string // 表达式引用的全部字段
+	patterns []string // 含通配符的字段
+}
+
+type node interface {
+	eval(values map[string]float64, instance string, hysteresis float64) (result bool, value float64, ok bool)
+}
+
+type operand struct {
+	field  string
+	number float64
+	isNum  bool
+}
+
+func (o operand) resolve(values map[string]float64, instance string) (float64, bool) {
+	if o.isNum {
+		return o.number, true
+	}
+	name := o.field
+	if strings.Contains(name, "*") {
+		name = strings.Replace(name, "*", instance, 1)
+	}
+	v, ok := values[name]
+	return v, ok
+}
+
+type compareNode struct {
+	left, right operand
+	op          string
+}
+
+// eval 比较两个操作数；hysteresis 为正时放宽阈值使条件更容易保持成立（用于已触发的告警）
+func (c *compareNode) eval(values map[string]float64, instance string, hysteresis float64) (bool, float64, bool) {
+	l, ok := c.left.resolve(values, instance)
+	if !ok {
+		return false, 0, false
+	}
+	r, ok := c.right.resolve(values, instance)
+	if !ok {
+		return false, 0, false
+	}
+	value := l
+	if c.left.isNum && !c.right.isNum {
+		value = r
+	}
+	switch c.op {
+	case ">":
+		return l > r-hysteresis, value, true
+	case ">=":
+		return l >= r-hysteresis, value, true
+	case "<":
+		return l < r+hysteresis, value, true
+	case "<=":
+		return l <= r+hysteresis, value, true
+	case "==":
+		return l == r, value, true
+	case "!=":
+		return l != r, value, true
+	}
+	return false, value, false
+}
+
+type notNode struct {
+	child node
+}
+
+func (n *notNode) eval(values map[string]float64, instance string, hysteresis float64) (bool, float64, bool) {
+	result, value, ok := n.child.eval(values, instance, -hysteresis)
+	return !result, value, ok
+}
+
+type logicNode struct {
+	left, right node
+	and         bool
+}
+
+func (n *logicNode) eval(values map[string]float64, instance string, hysteresis float64) (bool, float64, bool) {
+	l, lv, lok := n.left.eval(values, instance, hysteresis)
+	r, rv, rok := n.right.eval(values, instance, hysteresis)
+	value := lv
+	if !lok {
+		value = rv
+	}
+	if n.and {
+		return lok && rok && l && r, value, lok || rok
+	}
+	if l && lok {
+		return true, lv, true
+	}
+	// 只有右侧成立时报告右侧的值
+	if r && rok {
+		return true, rv, true
+	}
+	return false, value, lok || rok
+}
+
+// Compile 解析表达式
+func Compile(source string) (*Expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q", p.tokens[p.pos].text)
+	}
+	return &Expr{source: source, root: root, fields: p.fields, patterns: p.patterns}, nil
+}
+
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Fields 表达式引用的字段名，通配符字段保留 "*"
+func (e *Expr) Fields() []string {
+	return e.fields
+}
+
+// Instances 返回表达式在当前数据上的实例列表；不含通配符时只有一个空实例
+func (e *Expr) Instances(values map[string]float64) []string {
+	if len(e.patterns) == 0 {
+		return []string{""}
+	}
+	prefix, suffix, _ := strings.Cut(e.patterns[0], "*")
+	var instances []string
+	for name := range values {
+		if len(name) <= len(prefix)+len(suffix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		instances = append(instances, name[len(prefix):len(name)-len(suffix)])
+	}
+	return instances
+}
+
+// Eval 计算表达式在指定实例上的结果，ok 为 false 表示缺少数据
+func (e *Expr) Eval(values map[string]float64, instance string, hysteresis float64) (result bool, value float64, ok bool) {
+	return e.root.eval(values, instance, hysteresis)
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			end := strings.IndexByte(s[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at %d", i)
+			}
+			tokens = append(tokens, token{text: s[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.IndexByte("<>=!&|", c) >= 0:
+			j := i + 1
+			if j < len(s) && strings.IndexByte("=&|", s[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, token{text: s[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\n()<>=!&|\"", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, token{text: s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	fields   []string
+	patterns []string
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) accept(texts ...string) bool {
+	t, ok := p.peek()
+	if !ok || t.quoted {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right, and: true}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.accept("!", "not") {
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	}
+	if p.accept("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return inner, nil
+	}
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("missing comparison after %q", p.tokens[p.pos-1].text)
+	}
+	switch t.text {
+	case ">", ">=", "<", "<=", "==", "!=":
+		p.pos++
+	default:
+		return nil, fmt.Errorf("expected comparison operator, got %q", t.text)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if left.isNum && right.isNum {
+		return nil, fmt.Errorf("comparison between two numbers")
+	}
+	return &compareNode{left: left, right: right, op: t.text}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t, ok := p.peek()
+	if !ok {
+		return operand{}, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	if !t.quoted {
+		if strings.ContainsAny(t.text, "()<>=!&|") || t.text == "and" || t.text == "or" || t.text == "not" {
+			return operand{}, fmt.Errorf("unexpected token %q", t.text)
+		}
+		if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return operand{number: n, isNum: true}, nil
+		}
+	}
+	if strings.Count(t.text, "*") > 1 {
+		return operand{}, fmt.Errorf("field %q has more than one wildcard", t.text)
+	}
+	p.fields = append(p.fields, t.text)
+	if strings.Contains(t.text, "*") {
+		p.patterns = append(p.patterns, t.text)
+	}
+	return operand{field: t.text}, nil
+}
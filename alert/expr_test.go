@@ -0,0 +1,124 @@
+package alert
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name, expr, want string
+	}{
+		{"empty", "", "unexpected end of expression"},
+		{"missing operand", "cpuUsedPercent >", "unexpected end of expression"},
+		{"missing operator", "cpuUsedPercent 90", "expected comparison operator"},
+		{"single equals", "cpuUsedPercent = 90", "expected comparison operator"},
+		{"doubled operator", "cpuUsedPercent >> 90", "unexpected token"},
+		{"single ampersand", "cpuUsedPercent > 90 & load1 > 1", "unexpected token"},
+		{"two numbers", "1 > 2", "comparison between two numbers"},
+		{"unclosed parenthesis", "(cpuUsedPercent > 90", "missing closing parenthesis"},
+		{"extra closing parenthesis", "cpuUsedPercent > 90)", "unexpected token"},
+		{"dangling and", "cpuUsedPercent > 90 &&", "unexpected end of expression"},
+		{"two wildcards", "disk.*.*.usedPercent > 90", "more than one wildcard"},
+		{"unterminated quote", `"cpuUsedPercent > 90`, "unterminated quote"},
+		{"keyword as operand", "and > 1", "unexpected token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Compile(%q) error = %v, want %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	values := map[string]float64{"cpuUsedPercent": 95, "load1": 2, "mem used": 50}
+	tests := []struct {
+		expr   string
+		want   bool
+		value  float64
+		wantOK bool
+	}{
+		{"cpuUsedPercent > 90", true, 95, true},
+		{"90 < cpuUsedPercent", true, 95, true},
+		{"cpuUsedPercent > 90 && load1 > 4", false, 95, true},
+		{"cpuUsedPercent > 99 || load1 >= 2", true, 2, true},
+		{"not (cpuUsedPercent > 90)", false, 95, true},
+		{`"mem used" == 50`, true, 50, true},
+		{"missing > 1", false, 0, false},
+		{"missing > 1 || load1 > 1", true, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, value, ok := expr.Eval(values, "", 0)
+			if got != tt.want || ok != tt.wantOK || (ok && value != tt.value) {
+				t.Fatalf("Eval = %t, %v, %t, want %t, %v, %t", got, value, ok, tt.want, tt.value, tt.wantOK)
+			}
+		})
+	}
+}
+
+// 通配符字段按匹配的实例展开，同一表达式中的多个通配符共用实例
+func TestInstances(t *testing.T) {
+	expr, err := Compile("disk.*.usedPercent > 85 || disk.*.inodesUsedPercent > 85")
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{
+		"disk./.usedPercent":           90,
+		"disk./.inodesUsedPercent":     10,
+		"disk./data.usedPercent":       10,
+		"disk./data.inodesUsedPercent": 99,
+		"disk..usedPercent":            99,
+		"diskio.sda.utilPercent":       99,
+	}
+	got := expr.Instances(values)
+	slices.Sort(got)
+	if want := []string{"/", "/data"}; !slices.Equal(got, want) {
+		t.Fatalf("instances = %q, want %q", got, want)
+	}
+	for _, instance := range got {
+		if matched, _, ok := expr.Eval(values, instance, 0); !matched || !ok {
+			t.Errorf("instance %s: matched = %t, ok = %t", instance, matched, ok)
+		}
+	}
+
+	plain, err := Compile("load1 > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plain.Instances(values); !slices.Equal(got, []string{""}) {
+		t.Fatalf("instances without wildcard = %q, want one empty instance", got)
+	}
+}
+
+func TestCompileRulesRejectsUnknownMetric(t *testing.T) {
+	known := func(field string) bool { return field == "load1" || strings.HasPrefix(field, "disk.") }
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"load1 > 1", true},
+		{"disk.*.usedPercent > 90", true},
+		{"lod1 > 1", false},
+		{"load1 > 1 && cpu > 90", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			err := CompileRules([]*Rule{{Name: "r", Expr: tt.expr}}, known)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error = %v, want ok %t", err, tt.ok)
+			}
+			if err != nil && !strings.Contains(err.Error(), "unknown metric") {
+				t.Fatalf("error = %v, want unknown metric", err)
+			}
+		})
+	}
+}
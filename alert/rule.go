@@ -0,0 +1,137 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Duration 支持 "5m" 形式的 JSON 时长
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n float64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return errors.New("duration must be a string like \"5m\" or seconds")
+		}
+		*d = Duration(time.Duration(n * float64(time.Second)))
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Rule 告警规则
+type Rule struct {
+	Name       string            `json:"name"`
+	Expr       string            `json:"expr"`
+	For        Duration          `json:"for"`        // 条件持续成立多久后才触发
+	Hysteresis float64           `json:"hysteresis"` // 触发后阈值放宽的幅度，避免在阈值附近反复触发/恢复
+	Severity   string            `json:"severity"`
+	Summary    string            `json:"summary"` // text/template，可用 .Value .Instance .Labels
+	Labels     map[string]string `json:"labels,omitempty"`
+
+	expr     *Expr
+	template *template.Template
+}
+
+type RuleFile struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// LoadRules 从 JSON 文件加载并校验规则，known 判断表达式中的字段是否存在，为 nil 时不检查
+func LoadRules(path string, known func(field string) bool) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file RuleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse rules %s: %w", path, err)
+	}
+	if err := CompileRules(file.Rules, known); err != nil {
+		return nil, fmt.Errorf("rules %s: %w", path, err)
+	}
+	return file.Rules, nil
+}
+
+// CompileRules 校验规则并编译表达式与模板
+func CompileRules(rules []*Rule, known func(field string) bool) error {
+	seen := make(map[string]struct{}, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule #%d: name is required", i)
+		}
+		if _, ok := seen[rule.Name]; ok {
+			return fmt.Errorf("rule %s: duplicate name", rule.Name)
+		}
+		seen[rule.Name] = struct{}{}
+		if err := rule.compile(known); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile(known func(field string) bool) error {
+	expr, err := Compile(r.Expr)
+	if err != nil {
+		return fmt.Errorf("expr: %w", err)
+	}
+	for _, field := range expr.Fields() {
+		if known != nil && !known(field) {
+			return fmt.Errorf("expr: unknown metric %q", field)
+		}
+	}
+	r.expr = expr
+	switch r.Severity {
+	case "":
+		r.Severity = SeverityWarning
+	case SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity %q", r.Severity)
+	}
+	if r.For < 0 {
+		return errors.New("for must not be negative")
+	}
+	if r.Hysteresis < 0 {
+		return errors.New("hysteresis must not be negative")
+	}
+	if r.Summary == "" {
+		r.Summary = "{{.Rule}}{{if .Instance}} [{{.Instance}}]{{end}}: value {{printf \"%.2f\" .Value}}"
+	}
+	tmpl, err := template.New(r.Name).Option("missingkey=zero").Parse(r.Summary)
+	if err != nil {
+		return fmt.Errorf("summary: %w", err)
+	}
+	r.template = tmpl
+	return nil
+}
+
+func (r *Rule) renderSummary(a *Alert) string {
+	var buf bytes.Buffer
+	if err := r.template.Execute(&buf, a); err != nil {
+		return fmt.Sprintf("%s: %v", r.Name, err)
+	}
+	return buf.String()
+}
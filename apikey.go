@@ -0,0 +1,132 @@
+package main
+
+import (
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const apiKeyUsage = "usage: hoststat apikey create <name> --scopes metrics:read,processes:read [--expires 30d] [--cidrs 10.0.0.0/8] | hoststat apikey list | hoststat apikey revoke <id|name>"
+
+// apiKeyOptions apikey create 的选项
+var apiKeyOptions struct {
+	scopes  string
+	cidrs   string
+	expires string
+}
+
+func apiKeyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&apiKeyOptions.scopes, "scopes", "", "权限范围，逗号分隔："+strings.Join(auth.Scopes, "、"))
+	fs.StringVar(&apiKeyOptions.cidrs, "cidrs", "", "允许的来源地址（CIDR 或 IP），逗号分隔，为空时不限制")
+	fs.StringVar(&apiKeyOptions.expires, "expires", "", "有效期（如 720h、30d）或过期日期（2006-01-02），为空时永不过期")
+}
+
+// runAPIKeyCommand 管理 auth.apiKeysFile 中的 API Key；运行中的服务会自动读取变化，吊销后立即生效
+func runAPIKeyCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+	path := cfg.Auth.APIKeysFile
+	file, err := auth.ReadAPIKeyFile(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		usage, err := auth.ReadKeyUsage(cfg.Auth.APIKeysUsageFile)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCOPES\tCIDRS\tCREATED\tEXPIRES\tLAST USED\tLAST IP")
+		for _, key := range file.Keys {
+			expires := "never"
+			if !key.ExpiresAt.IsZero() {
+				expires = key.ExpiresAt.Format("2006-01-02 15:04")
+				if key.Expired(now) {
+					expires += " (expired)"
+				}
+			}
+			lastUsed, lastIP := "never", "-"
+			if u, ok := usage[key.ID]; ok {
+				lastUsed, lastIP = u.LastUsedAt.Format("2006-01-02 15:04:05"), u.LastUsedIP
+			}
+			cidrs := strings.Join(key.CIDRs, ",")
+			if cidrs == "" {
+				cidrs = "any"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, strings.Join(key.Scopes, ","), cidrs,
+				key.CreatedAt.Format("2006-01-02 15:04"), expires, lastUsed, lastIP)
+		}
+		return w.Flush()
+	case args[0] == "create" && len(args) == 2:
+		expiresAt, err := parseExpiry(apiKeyOptions.expires, now)
+		if err != nil {
+			return err
+		}
+		plain, key, err := file.Create(args[1], splitList(apiKeyOptions.scopes), splitList(apiKeyOptions.cidrs), expiresAt, now)
+		if err != nil {
+			return err
+		}
+		if err := file.Write(path); err != nil {
+			return err
+		}
+		details := map[string]any{"id": key.ID, "name": key.Name, "scopes": key.Scopes, "cidrs": key.CIDRs}
+		if !key.ExpiresAt.IsZero() {
+			details["expiresAt"] = key.ExpiresAt
+		}
+		auditCommand("apikey.create", details)
+		fmt.Fprintf(os.Stderr, "api key %s created (%s), it is shown only once:\n", key.ID, path)
+		fmt.Println(plain)
+		return nil
+	case args[0] == "revoke" && len(args) == 2:
+		key, err := file.Revoke(args[1])
+		if err != nil {
+			return err
+		}
+		if err := file.Write(path); err != nil {
+			return err
+		}
+		auditCommand("apikey.revoke", map[string]any{"id": key.ID, "name": key.Name})
+		fmt.Printf("api key revoked: %s (%s)\n", key.ID, key.Name)
+		return nil
+	}
+	return errors.New(apiKeyUsage)
+}
+
+// parseExpiry 解析有效期：Go 时长、<天数>d 或日期（当天结束时过期）
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return now.AddDate(0, 0, n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	if date, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return date.AddDate(0, 0, 1), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q, expected a duration (720h, 30d) or a date (2006-01-02)", value)
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"chihqiang/hoststat/config"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// 事件结果
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+var ErrDisabled = errors.New("audit log is disabled")
+
+// Event 一条审计记录
+// Actor 为调用方（user:alice、apikey:<ID>、cert:<CN>、session:<会话ID>），命令行操作为 local:<系统用户>
+type Event struct {
+	Time      time.Time      `json:"time"`
+	Action    string         `json:"action"`
+	Outcome   string         `json:"outcome"`
+	Actor     string         `json:"actor,omitempty"`
+	IP        string         `json:"ip,omitempty"`
+	UserAgent string         `json:"userAgent,omitempty"`
+	Method    string         `json:"method,omitempty"`
+	Path      string         `json:"path,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// Log 只追加的审计日志，每条记录一行 JSON；文件超过 audit.maxSize 后轮转为 <file>.1、<file>.2…
+// 每次写入时读取配置，重新加载配置修改 audit.file 后写入新文件；写入和轮转持有文件锁，与命令行子命令的进程互不覆盖
+type Log struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	size int64
+}
+
+var LOG = &Log{}
+
+// Record 追加一条记录，audit.file 为空时不记录；写入失败只记录错误日志，不影响调用方
+func (l *Log) Record(e Event) {
+	cfg := config.Get().Audit
+	if cfg.File == "" {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		logx.Error("Encode audit event failed | action: %s | error: %v", e.Action, err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.write(cfg, append(line, '\n')); err != nil {
+		logx.Error("Write audit log failed | file: %s | action: %s | error: %v", cfg.File, e.Action, err)
+	}
+}
+
+// write 调用方需持有锁
+func (l *Log) write(cfg config.AuditConfig, line []byte) error {
+	if l.file == nil || l.path != cfg.File {
+		if err := l.open(cfg.File); err != nil {
+			return err
+		}
+	}
+	if err := l.lock(); err != nil {
+		return err
+	}
+	defer l.unlock()
+	if cfg.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > int64(cfg.MaxSize) {
+		if err := l.rotate(cfg.MaxBackups); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *Log) open(path string) error {
+	l.closeFile()
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	l.file, l.path, l.size = f, path, info.Size()
+	return nil
+}
+
+// lock 对打开的文件加排他锁，并重新检查路径是否仍指向该文件：其他进程轮转后重新打开，文件大小以加锁后为准
+func (l *Log) lock() error {
+	for {
+		if err := lockFile(l.file); err != nil {
+			return err
+		}
+		info, err := l.file.Stat()
+		if err != nil {
+			l.unlock()
+			return err
+		}
+		current, err := os.Stat(l.path)
+		if err == nil && os.SameFile(info, current) {
+			l.size = info.Size()
+			return nil
+		}
+		l.unlock()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := l.open(l.path); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *Log) unlock() {
+	if l.file != nil {
+		_ = unlockFile(l.file)
+	}
+}
+
+// rotate 当前文件改名为 <file>.1，已有的备份依次后移，超过 maxBackups 的删除；maxBackups 至少为 1，当前文件不会被删除
+// 调用方需持有锁，改名完成后才关闭旧文件释放文件锁，然后打开并锁定新文件
+func (l *Log) rotate(maxBackups int) error {
+	path := l.path
+	maxBackups = max(maxBackups, 1)
+	if err := os.Remove(backupName(path, maxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupName(path, i), backupName(path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(path, backupName(path, 1)); err != nil {
+		return err
+	}
+	if err := l.open(path); err != nil {
+		return err
+	}
+	return l.lock()
+}
+
+func (l *Log) closeFile() {
+	if l.file != nil {
+		_ = l.file.Close()
+		l.file = nil
+	}
+}
+
+// Close 退出时关闭文件
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func backupName(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
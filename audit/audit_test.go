@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"chihqiang/hoststat/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func useAudit(t *testing.T, maxSize config.Size, maxBackups int) string {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Audit.File = filepath.Join(t.TempDir(), "audit.jsonl")
+	cfg.Audit.MaxSize = maxSize
+	cfg.Audit.MaxBackups = maxBackups
+	config.Set(cfg)
+	return cfg.Audit.File
+}
+
+// 轮转不会删除当前文件，maxBackups 为 0 时也至少保留一个备份
+func TestRotateKeepsLiveFile(t *testing.T) {
+	path := useAudit(t, 1, 0)
+	l := &Log{}
+	defer l.Close()
+	l.Record(Event{Action: "first"})
+	l.Record(Event{Action: "second"})
+	data, err := os.ReadFile(backupName(path, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 {
+		t.Fatal("rotated file is empty")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Fatalf("live file after rotation: %v, %v", info, err)
+	}
+}
+
+// 两个进程写入同一文件：另一方轮转后重新打开，不会写入已改名的备份，也不会重复轮转
+func TestConcurrentWritersFollowRotation(t *testing.T) {
+	useAudit(t, 300, 5)
+	server, cli := &Log{}, &Log{}
+	defer server.Close()
+	defer cli.Close()
+	for range 10 {
+		server.Record(Event{Action: "server"})
+		cli.Record(Event{Action: "cli"})
+	}
+	events, err := server.Query(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 20 {
+		t.Fatalf("events = %d, want 20", len(events))
+	}
+	// 从新到旧交替为 cli、server，顺序错乱说明写入了已改名的文件
+	for i, e := range events {
+		if want := []string{"cli", "server"}[i%2]; e.Action != want {
+			t.Fatalf("event %d = %s, want %s", i, e.Action, want)
+		}
+	}
+}
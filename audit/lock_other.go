@@ -0,0 +1,14 @@
+//go:build !unix
+
+package audit
+
+import "os"
+
+// 其他平台不支持 flock，只在进程内串行写入
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,99 @@
+package audit
+
+import (
+	"bufio"
+	"chihqiang/hoststat/config"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxLineSize 读取时单条记录的最大长度
+const maxLineSize = 1 << 20
+
+// Filter 查询条件，零值表示不限制
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Actor   string // 完整的调用方（user:alice）或只写名称（alice）
+	Action  string // 完整的操作（process.signal）或前缀（process）
+	Outcome string
+	Limit   int
+}
+
+func (f Filter) match(e *Event) bool {
+	switch {
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	case f.Actor != "" && e.Actor != f.Actor && !strings.HasSuffix(e.Actor, ":"+f.Actor):
+		return false
+	case f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+"."):
+		return false
+	case f.Outcome != "" && e.Outcome != f.Outcome:
+		return false
+	}
+	return true
+}
+
+// Query 依次读取当前文件和轮转文件，按时间从新到旧返回匹配的记录，最多 Limit 条
+func (l *Log) Query(f Filter) ([]Event, error) {
+	cfg := config.Get().Audit
+	if cfg.File == "" {
+		return nil, ErrDisabled
+	}
+	events := []Event{}
+	for i := 0; i <= cfg.MaxBackups; i++ {
+		path := cfg.File
+		if i > 0 {
+			path = backupName(cfg.File, i)
+		}
+		matched, oldest, err := readEvents(path, f)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		slices.Reverse(matched)
+		events = append(events, matched...)
+		if f.Limit > 0 && len(events) >= f.Limit {
+			return events[:f.Limit], nil
+		}
+		// 更早的轮转文件只包含更早的记录
+		if !f.Since.IsZero() && !oldest.IsZero() && oldest.Before(f.Since) {
+			break
+		}
+	}
+	return events, nil
+}
+
+// readEvents 按文件中的顺序（从旧到新）返回匹配的记录以及文件中最早的记录时间；无法解析的行（如正在写入的最后一行）跳过
+func readEvents(path string, f Filter) ([]Event, time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+	var matched []Event
+	var oldest time.Time
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if oldest.IsZero() {
+			oldest = e.Time
+		}
+		if f.match(&e) {
+			matched = append(matched, e)
+		}
+	}
+	return matched, oldest, scanner.Err()
+}
@@ -0,0 +1,326 @@
+package auth
+
+import (
+	"chihqiang/hoststat/config"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// API Key 权限范围
+const (
+	ScopeMetricsRead   = "metrics:read"   // 主机指标：/base、/current、/history、/stream、/alerts、/ws、/metrics
+	ScopeProcessesRead = "processes:read" // 进程信息：/processes、/top/*/ps、/ws 的 processes 分组
+	ScopeAdmin         = "admin"          // 进程操作与会话管理，包含全部权限
+)
+
+var Scopes = []string{ScopeMetricsRead, ScopeProcessesRead, ScopeAdmin}
+
+const (
+	apiKeyPrefix = "hsk_"
+	apiKeyIDLen  = 8 // 十六进制
+	// apiKeyUsageFlushInterval 最近使用记录写入文件的间隔
+	apiKeyUsageFlushInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey    = errors.New("invalid api key")
+	ErrAPIKeyExpired    = errors.New("api key expired")
+	ErrSourceNotAllowed = errors.New("source address not allowed for api key")
+)
+
+// APIKey 机器客户端使用的密钥，完整密钥只在创建时显示一次，文件中只保存 SHA-256 哈希
+// 密钥格式为 hsk_<ID>_<随机串>，ID 用于查找和吊销
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Scopes    []string  `json:"scopes"`
+	CIDRs     []string  `json:"cidrs,omitempty"` // 允许的来源地址，为空时不限制
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+// Expired 是否已过期
+func (k *APIKey) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// allowsSource 来源 IP 是否在 CIDRs 中
+func (k *APIKey) allowsSource(ip string) bool {
+	if len(k.CIDRs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range k.CIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyFile auth.apiKeysFile 的内容，由 hoststat apikey 子命令维护
+type APIKeyFile struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+// ReadAPIKeyFile 读取 API Key 文件，文件不存在时返回空列表
+func ReadAPIKeyFile(path string) (*APIKeyFile, error) {
+	var file APIKeyFile
+	if err := readJSON(path, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Write 原子地写入 API Key 文件，权限 0600
+func (f *APIKeyFile) Write(path string) error {
+	return writeJSON(path, f)
+}
+
+// Find 按 ID 或名称查找；名称重复时返回错误
+func (f *APIKeyFile) Find(idOrName string) (*APIKey, error) {
+	var found []*APIKey
+	for _, key := range f.Keys {
+		if key.ID == idOrName {
+			return key, nil
+		}
+		if key.Name == idOrName {
+			found = append(found, key)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("api key %q not found", idOrName)
+	case 1:
+		return found[0], nil
+	}
+	return nil, fmt.Errorf("api key name %q is ambiguous, use the id", idOrName)
+}
+
+// Create 生成新的 API Key，返回只显示一次的完整密钥
+func (f *APIKeyFile) Create(name string, scopes, cidrs []string, expiresAt, now time.Time) (string, *APIKey, error) {
+	if name == "" {
+		return "", nil, errors.New("name must not be empty")
+	}
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required, available: %s", strings.Join(Scopes, ","))
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %q, available: %s", scope, strings.Join(Scopes, ","))
+		}
+	}
+	for i, cidr := range cidrs {
+		prefix, err := ParseCIDR(cidr)
+		if err != nil {
+			return "", nil, err
+		}
+		cidrs[i] = prefix.String()
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return "", nil, errors.New("expiry must be in the future")
+	}
+	id := randomHex(apiKeyIDLen / 2)
+	for f.findID(id) != nil {
+		id = randomHex(apiKeyIDLen / 2)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	plain := apiKeyPrefix + id + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key := &APIKey{
+		ID:        id,
+		Name:      name,
+		Hash:      hashAPIKey(plain),
+		Scopes:    scopes,
+		CIDRs:     cidrs,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	f.Keys = append(f.Keys, key)
+	return plain, key, nil
+}
+
+// Revoke 删除 API Key，之后使用该密钥的请求立即被拒绝
+func (f *APIKeyFile) Revoke(idOrName string) (*APIKey, error) {
+	key, err := f.Find(idOrName)
+	if err != nil {
+		return nil, err
+	}
+	f.Keys = slices.DeleteFunc(f.Keys, func(k *APIKey) bool { return k == key })
+	return key, nil
+}
+
+func (f *APIKeyFile) findID(id string) *APIKey {
+	for _, key := range f.Keys {
+		if key.ID == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// KeyUsage API Key 的最近使用记录
+type KeyUsage struct {
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	LastUsedIP string    `json:"lastUsedIp"`
+}
+
+// ReadKeyUsage 读取 auth.apiKeysUsageFile，文件不存在时返回空记录
+func ReadKeyUsage(path string) (map[string]KeyUsage, error) {
+	usage := make(map[string]KeyUsage)
+	if err := readJSON(path, &usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// APIKeys 服务端读取的 API Key；密钥文件只由命令行修改，最近使用记录由服务端单独保存，避免同时写一个文件
+type APIKeys struct {
+	file watchedFile[APIKeyFile]
+
+	mu     sync.Mutex
+	usage  map[string]KeyUsage // 延迟加载
+	dirty  bool
+	loaded string // usage 对应的文件路径
+}
+
+var APIKEYS = &APIKeys{file: watchedFile[APIKeyFile]{read: ReadAPIKeyFile}}
+
+// IsAPIKey 是否为 API Key 格式的凭证，用于区分 Authorization 中的管理令牌
+func IsAPIKey(value string) bool {
+	return strings.HasPrefix(value, apiKeyPrefix)
+}
+
+// Authenticate 校验 API Key 的哈希、有效期和来源地址，成功后记录最近使用时间
+func (a *APIKeys) Authenticate(value, ip string, now time.Time) (*APIKey, error) {
+	rest, ok := strings.CutPrefix(value, apiKeyPrefix)
+	if !ok || len(rest) <= apiKeyIDLen || rest[apiKeyIDLen] != '_' {
+		return nil, ErrInvalidAPIKey
+	}
+	file, err := a.file.load(config.Get().Auth.APIKeysFile)
+	if err != nil {
+		return nil, err
+	}
+	key := file.findID(rest[:apiKeyIDLen])
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashAPIKey(value))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.Expired(now) {
+		return key, ErrAPIKeyExpired
+	}
+	if !key.allowsSource(ip) {
+		return key, ErrSourceNotAllowed
+	}
+	a.touch(key.ID, ip, now)
+	return key, nil
+}
+
+func (a *APIKeys) touch(id, ip string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.loadUsage()
+	a.usage[id] = KeyUsage{LastUsedAt: now, LastUsedIP: ip}
+	a.dirty = true
+}
+
+// loadUsage 首次使用或文件路径变化时读取已有记录；调用方需持有锁
+func (a *APIKeys) loadUsage() {
+	path := config.Get().Auth.APIKeysUsageFile
+	if a.usage != nil && a.loaded == path {
+		return
+	}
+	usage, err := ReadKeyUsage(path)
+	if err != nil {
+		logx.Warn("Read api key usage failed | file: %s | error: %v", path, err)
+		usage = make(map[string]KeyUsage)
+	}
+	for id, u := range a.usage {
+		usage[id] = u
+	}
+	a.usage, a.loaded, a.dirty = usage, path, len(a.usage) > 0
+}
+
+// Flush 将最近使用记录写入文件，已吊销的密钥不再保留
+func (a *APIKeys) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.dirty {
+		return nil
+	}
+	if file, err := a.file.load(config.Get().Auth.APIKeysFile); err == nil {
+		for id := range a.usage {
+			if file.findID(id) == nil {
+				delete(a.usage, id)
+			}
+		}
+	}
+	if err := writeJSON(a.loaded, a.usage); err != nil {
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+// Run 定期保存最近使用记录，ctx 结束时返回；退出前应再调用一次 Flush
+func (a *APIKeys) Run(ctx context.Context) {
+	ticker := time.NewTicker(apiKeyUsageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.Flush(); err != nil {
+				logx.Error("Save api key usage failed | file: %s | error: %v", config.Get().Auth.APIKeysUsageFile, err)
+			}
+		}
+	}
+}
+
+// ParseCIDR 解析 CIDR，单个 IP 视为 /32 或 /128
+func ParseCIDR(value string) (netip.Prefix, error) {
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid cidr %q", value)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid cidr %q", value)
+	}
+	return prefix.Masked(), nil
+}
+
+func hashAPIKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"chihqiang/hoststat/config"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAPIKeysFile 使用临时目录中的 API Key 文件和最近使用记录文件
+func useAPIKeysFile(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Auth.APIKeysFile = filepath.Join(dir, "apikeys.json")
+	cfg.Auth.APIKeysUsageFile = filepath.Join(dir, "apikeys-usage.json")
+	config.Set(cfg)
+	return cfg
+}
+
+func newAPIKeys() *APIKeys {
+	return &APIKeys{file: watchedFile[APIKeyFile]{read: ReadAPIKeyFile}}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	cfg := useAPIKeysFile(t)
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	var file APIKeyFile
+	plain, key, err := file.Create("ci", []string{ScopeMetricsRead}, []string{"10.0.0.0/8"}, expiresAt, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Write(cfg.Auth.APIKeysFile); err != nil {
+		t.Fatal(err)
+	}
+	keys := newAPIKeys()
+
+	id := strings.TrimPrefix(plain, apiKeyPrefix)[:apiKeyIDLen]
+	for _, tc := range []struct {
+		name, value, ip string
+		now             time.Time
+		want            error
+	}{
+		{"valid", plain, "10.1.2.3", now, nil},
+		{"IPv4-mapped IPv6 source", plain, "::ffff:10.1.2.3", now, nil},
+		{"source outside cidrs", plain, "192.168.1.1", now, ErrSourceNotAllowed},
+		{"mapped source outside cidrs", plain, "::ffff:192.168.1.1", now, ErrSourceNotAllowed},
+		{"unparseable source", plain, "unknown", now, ErrSourceNotAllowed},
+		{"wrong secret", plain[:len(plain)-1] + "x", "10.1.2.3", now, ErrInvalidAPIKey},
+		{"unknown id", apiKeyPrefix + "00000000" + plain[len(apiKeyPrefix)+apiKeyIDLen:], "10.1.2.3", now, ErrInvalidAPIKey},
+		{"missing separator", apiKeyPrefix + id + "x" + plain[len(apiKeyPrefix)+apiKeyIDLen+1:], "10.1.2.3", now, ErrInvalidAPIKey},
+		{"id only", apiKeyPrefix + id, "10.1.2.3", now, ErrInvalidAPIKey},
+		{"missing prefix", strings.TrimPrefix(plain, apiKeyPrefix), "10.1.2.3", now, ErrInvalidAPIKey},
+		{"just before expiry", plain, "10.1.2.3", expiresAt.Add(-time.Nanosecond), nil},
+		{"at expiry", plain, "10.1.2.3", expiresAt, ErrAPIKeyExpired},
+	} {
+		got, err := keys.Authenticate(tc.value, tc.ip, tc.now)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: error = %v, want %v", tc.name, err, tc.want)
+			continue
+		}
+		if tc.want == nil && (got == nil || got.ID != key.ID) {
+			t.Errorf("%s: key = %+v, want %s", tc.name, got, key.ID)
+		}
+	}
+}
+
+func TestAPIKeyAllowsSource(t *testing.T) {
+	var file APIKeyFile
+	now := time.Now()
+	// 创建时 CIDR 被规范化：单个 IP 为 /32 或 /128，IPv4-mapped 地址还原为 IPv4
+	_, key, err := file.Create("ci", []string{ScopeAdmin}, []string{"192.168.1.7/24", "::ffff:10.0.0.1", "2001:db8::1"}, time.Time{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"192.168.1.0/24", "10.0.0.1/32", "2001:db8::1/128"}; strings.Join(key.CIDRs, ",") != strings.Join(want, ",") {
+		t.Fatalf("cidrs = %v, want %v", key.CIDRs, want)
+	}
+	for ip, want := range map[string]bool{
+		"192.168.1.200":      true,
+		"::ffff:192.168.1.1": true,
+		"10.0.0.1":           true,
+		"::ffff:10.0.0.1":    true,
+		"10.0.0.2":           false,
+		"2001:db8::1":        true,
+		"2001:db8::2":        false,
+		"":                   false,
+	} {
+		if got := key.allowsSource(ip); got != want {
+			t.Errorf("allowsSource(%q) = %v, want %v", ip, got, want)
+		}
+	}
+	if !(&APIKey{}).allowsSource("203.0.113.1") {
+		t.Error("key without cidrs rejects a source")
+	}
+	if _, err := ParseCIDR("10.0.0.0/33"); err == nil {
+		t.Error("invalid prefix length is accepted")
+	}
+	if _, _, err := file.Create("bad", []string{ScopeAdmin}, []string{"not-an-ip"}, time.Time{}, now); err == nil {
+		t.Error("invalid cidr is accepted")
+	}
+}
+
+func TestAPIKeyCreateValidation(t *testing.T) {
+	var file APIKeyFile
+	now := time.Now()
+	for name, create := range map[string]func() error{
+		"empty name":    func() error { _, _, err := file.Create("", []string{ScopeAdmin}, nil, time.Time{}, now); return err },
+		"no scopes":     func() error { _, _, err := file.Create("ci", nil, nil, time.Time{}, now); return err },
+		"unknown scope": func() error { _, _, err := file.Create("ci", []string{"root"}, nil, time.Time{}, now); return err },
+		"past expiry":   func() error { _, _, err := file.Create("ci", []string{ScopeAdmin}, nil, now, now); return err },
+	} {
+		if create() == nil {
+			t.Errorf("%s: key created", name)
+		}
+	}
+	if len(file.Keys) != 0 {
+		t.Fatalf("keys = %d after rejected creates, want 0", len(file.Keys))
+	}
+	plain, key, err := file.Create("ci", []string{ScopeAdmin}, nil, time.Time{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Hash == plain || key.Hash != hashAPIKey(plain) {
+		t.Error("key file does not store the hash of the plain key")
+	}
+}
+
+// 吊销后请求立即被拒绝，Flush 不再保存已吊销密钥的最近使用记录
+func TestAPIKeyRevokeDropsUsage(t *testing.T) {
+	cfg := useAPIKeysFile(t)
+	now := time.Now()
+	var file APIKeyFile
+	keepPlain, keep, err := file.Create("keep", []string{ScopeMetricsRead}, nil, time.Time{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropPlain, _, err := file.Create("drop", []string{ScopeMetricsRead}, nil, time.Time{}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Write(cfg.Auth.APIKeysFile); err != nil {
+		t.Fatal(err)
+	}
+	keys := newAPIKeys()
+	for _, plain := range []string{keepPlain, dropPlain} {
+		if _, err := keys.Authenticate(plain, "10.0.0.1", now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := file.Revoke("drop"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Revoke("drop"); err == nil {
+		t.Error("revoking a missing key succeeds")
+	}
+	if err := file.Write(cfg.Auth.APIKeysFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Authenticate(dropPlain, "10.0.0.1", now); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("revoked key error = %v, want %v", err, ErrInvalidAPIKey)
+	}
+
+	if err := keys.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := ReadKeyUsage(cfg.Auth.APIKeysUsageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 1 || usage[keep.ID].LastUsedIP != "10.0.0.1" || !usage[keep.ID].LastUsedAt.Equal(now) {
+		t.Fatalf("usage = %+v, want only %s", usage, keep.ID)
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"chihqiang/hoststat/config"
+	"path"
+	"strings"
+)
+
+// CertIdentity 按 auth.clientCerts 规则为通过 mTLS 校验的客户端证书确定身份和权限范围
+// names 为证书的 CN 与 SAN，规则按顺序匹配，第一条匹配的规则生效；没有规则匹配时返回 false
+func CertIdentity(names []string) (*Identity, bool) {
+	for _, rule := range config.Get().Auth.ClientCerts {
+		pattern, perms, ok := strings.Cut(rule, "=")
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			if matched, _ := path.Match(pattern, name); !matched {
+				continue
+			}
+			scopes := []string{}
+			for _, perm := range strings.Split(perms, "+") {
+				if perm == RoleViewer {
+					scopes = append(scopes, RoleScopes(RoleViewer)...)
+				} else {
+					scopes = append(scopes, perm)
+				}
+			}
+			return &Identity{Kind: KindCert, Name: name, Scopes: scopes}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// readJSON 读取 JSON 文件到 v，文件不存在时保持 v 不变
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSON 原子地写入 JSON 文件，权限 0600
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// watchedFile 按修改时间缓存的文件内容，命令行修改文件后服务端自动重新读取
+type watchedFile[T any] struct {
+	mu    sync.Mutex
+	read  func(path string) (*T, error)
+	path  string
+	stamp string
+	value *T
+	err   error
+}
+
+func (w *watchedFile[T]) load(path string) (*T, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamp := ""
+	if info, err := os.Stat(path); err == nil {
+		stamp = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	}
+	if w.value == nil || w.err != nil || path != w.path || stamp != w.stamp {
+		w.value, w.err = w.read(path)
+		w.path, w.stamp = path, stamp
+	}
+	return w.value, w.err
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+// 调用方类型
+const (
+	KindUser    = "user"    // 登录的用户
+	KindSession = "session" // 未配置用户时的匿名页面会话
+	KindAPIKey  = "apikey"
+	KindCert    = "cert" // 受信任的客户端证书（mTLS）
+)
+
+// Identity 通过认证的调用方，由 SecureMiddleware 写入请求上下文
+type Identity struct {
+	Kind   string
+	Name   string   // 用户名、API Key ID 或客户端证书主体，匿名会话为会话ID
+	Scopes []string // API Key、单点登录用户与客户端证书有权限范围，其他调用方为 nil，拥有全部权限
+}
+
+func (i *Identity) String() string {
+	return i.Kind + ":" + i.Name
+}
+
+// Restricted 是否受权限范围限制；API Key 始终受限
+func (i *Identity) Restricted() bool {
+	return i.Kind == KindAPIKey || i.Scopes != nil
+}
+
+// Allows 是否拥有 scope 权限；admin 包含全部权限
+func (i *Identity) Allows(scope string) bool {
+	if !i.Restricted() {
+		return true
+	}
+	return slices.Contains(i.Scopes, ScopeAdmin) || slices.Contains(i.Scopes, scope)
+}
+
+// 单点登录用户的角色
+const (
+	RoleViewer = "viewer" // 只读
+	RoleAdmin  = "admin"
+)
+
+// RoleScopes 角色对应的权限范围；空角色（本地用户与匿名会话）不受限制，返回 nil
+func RoleScopes(role string) []string {
+	switch role {
+	case RoleAdmin:
+		return []string{ScopeAdmin}
+	case RoleViewer:
+		return []string{ScopeMetricsRead, ScopeProcessesRead}
+	case "":
+		return nil
+	}
+	return []string{}
+}
+
+type identityKey struct{}
+
+// WithIdentity 返回携带调用方信息的请求
+func WithIdentity(r *http.Request, id *Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+// IdentityFrom 读取请求的调用方，未经过 SecureMiddleware 时返回 nil
+func IdentityFrom(r *http.Request) *Identity {
+	id, _ := r.Context().Value(identityKey{}).(*Identity)
+	return id
+}
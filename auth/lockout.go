@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"chihqiang/hoststat/config"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLocked             = errors.New("too many failed attempts, try again later")
+)
+
+// attempts 窗口内的失败次数；达到 auth.maxFailures 后锁定 auth.lockoutDuration
+type attempts struct {
+	failures    int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+// Lockout 按来源 IP 与用户名的组合、来源 IP 分别统计登录失败次数，防止暴力破解
+// 不单独按用户名锁定，避免攻击者故意输错密码把正常用户锁在外面
+type Lockout struct {
+	mu      sync.Mutex
+	entries map[string]*attempts
+}
+
+var LOCKOUT = &Lockout{entries: make(map[string]*attempts)}
+
+// Locked 返回 key 的锁定截止时间
+func (l *Lockout) Locked(key string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.entries[key]
+	if !ok || !now.Before(a.lockedUntil) {
+		return time.Time{}, false
+	}
+	return a.lockedUntil, true
+}
+
+// Fail 记录一次失败，返回是否因此被锁定
+func (l *Lockout) Fail(key string, now time.Time) bool {
+	cfg := config.Get().Auth
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now, cfg.FailureWindow.Std())
+	a, ok := l.entries[key]
+	if !ok || now.Sub(a.first) > cfg.FailureWindow.Std() {
+		a = &attempts{first: now}
+		l.entries[key] = a
+	}
+	a.failures++
+	if a.failures >= cfg.MaxFailures {
+		a.lockedUntil = now.Add(cfg.LockoutDuration.Std())
+		a.failures, a.first = 0, now
+		return true
+	}
+	return false
+}
+
+// Reset 登录成功后清除失败记录
+func (l *Lockout) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// prune 删除已过窗口且未锁定的记录，避免随机用户名占满内存；调用方需持有锁
+func (l *Lockout) prune(now time.Time, window time.Duration) {
+	for key, a := range l.entries {
+		if now.Sub(a.first) > window && !now.Before(a.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Authenticate 校验用户名和密码，成功时返回用户；来源 IP 对该用户名或来源 IP 本身被锁定时直接返回 ErrLocked，不校验密码
+// locked 为 true 表示本次失败触发了锁定
+func Authenticate(name, password, ip string, now time.Time) (user *User, locked bool, err error) {
+	userKey, ipKey := "user:"+name+"|ip:"+ip, "ip:"+ip
+	if _, ok := LOCKOUT.Locked(userKey, now); ok {
+		return nil, false, ErrLocked
+	}
+	if _, ok := LOCKOUT.Locked(ipKey, now); ok {
+		return nil, false, ErrLocked
+	}
+	hash := dummyHash
+	user, err = USERS.Get(name)
+	if err == nil {
+		hash = user.PasswordHash
+	}
+	ok, verr := VerifyPassword(hash, password)
+	if verr != nil {
+		return nil, false, verr
+	}
+	if !ok || user == nil {
+		lockedUser := LOCKOUT.Fail(userKey, now)
+		lockedIP := LOCKOUT.Fail(ipKey, now)
+		if lockedUser || lockedIP {
+			return nil, true, ErrLocked
+		}
+		return nil, false, ErrInvalidCredentials
+	}
+	LOCKOUT.Reset(userKey)
+	LOCKOUT.Reset(ipKey)
+	return user, false, nil
+}
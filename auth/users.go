@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"chihqiang/hoststat/config"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// User 本地用户；修改密码后，之前签发的会话全部失效
+type User struct {
+	Name              string    `json:"name"`
+	PasswordHash      string    `json:"passwordHash"`
+	CreatedAt         time.Time `json:"createdAt"`
+	PasswordChangedAt time.Time `json:"passwordChangedAt"`
+}
+
+// Generation 密码版本，写入会话令牌；修改密码、删除后重新添加用户都会改变
+// 使用纳秒精度，同一秒内修改密码之前签发的会话同样失效
+func (u *User) Generation() int64 {
+	return u.PasswordChangedAt.UnixNano()
+}
+
+// UserFile auth.usersFile 的内容
+type UserFile struct {
+	Users []*User `json:"users"`
+}
+
+// ReadUserFile 读取用户文件，文件不存在时返回空列表
+func ReadUserFile(path string) (*UserFile, error) {
+	var file UserFile
+	if err := readJSON(path, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Write 原子地写入用户文件，权限 0600
+func (f *UserFile) Write(path string) error {
+	return writeJSON(path, f)
+}
+
+func (f *UserFile) Find(name string) *User {
+	for _, user := range f.Users {
+		if user.Name == name {
+			return user
+		}
+	}
+	return nil
+}
+
+// Add 添加用户，用户名已存在时返回错误
+func (f *UserFile) Add(name, password string, now time.Time) error {
+	if err := validUsername(name); err != nil {
+		return err
+	}
+	if f.Find(name) != nil {
+		return fmt.Errorf("user %q already exists", name)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	f.Users = append(f.Users, &User{Name: name, PasswordHash: hash, CreatedAt: now, PasswordChangedAt: now})
+	return nil
+}
+
+// SetPassword 修改密码
+func (f *UserFile) SetPassword(name, password string, now time.Time) error {
+	user := f.Find(name)
+	if user == nil {
+		return fmt.Errorf("user %q not found", name)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash, user.PasswordChangedAt = hash, now
+	return nil
+}
+
+// Delete 删除用户
+func (f *UserFile) Delete(name string) error {
+	i := slices.IndexFunc(f.Users, func(u *User) bool { return u.Name == name })
+	if i < 0 {
+		return fmt.Errorf("user %q not found", name)
+	}
+	f.Users = slices.Delete(f.Users, i, i+1)
+	return nil
+}
+
+func validUsername(name string) error {
+	if name == "" || len(name) > 64 {
+		return errors.New("username must be 1 ~ 64 characters")
+	}
+	if strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r == ':' || r == 0x7f }) {
+		return errors.New("username must not contain spaces, control characters or ':'")
+	}
+	return nil
+}
+
+// Users 服务端读取的用户列表；文件修改时间变化后重新读取，命令行增删用户后无需重启
+type Users struct {
+	file watchedFile[UserFile]
+}
+
+var USERS = &Users{file: watchedFile[UserFile]{read: readServerUserFile}}
+
+// readServerUserFile 服务端读取用户文件，文件不存在时返回错误（命令行添加用户时由 ReadUserFile 创建）
+func readServerUserFile(path string) (*UserFile, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return ReadUserFile(path)
+}
+
+// load 返回当前的用户列表，读取失败时返回错误（此时拒绝所有登录）
+func (u *Users) load() (*UserFile, error) {
+	return u.file.load(config.Get().Auth.UsersFile)
+}
+
+// Check 用户文件可以读取且至少有一个用户时返回 nil
+func (u *Users) Check() error {
+	file, err := u.load()
+	if err != nil {
+		return err
+	}
+	if len(file.Users) == 0 {
+		return errors.New("no users in " + config.Get().Auth.UsersFile)
+	}
+	return nil
+}
+
+// Available 是否可以使用用户名密码登录
+func (u *Users) Available() bool {
+	return u.Check() == nil
+}
+
+// Required 访问页面和接口是否需要登录；只有开启 auth.anonymous 且用户文件不存在或没有用户时才允许匿名访问
+// 用户文件存在但无法读取时同样要求登录，避免配置错误导致认证被绕过
+func (u *Users) Required() bool {
+	if !config.Get().Auth.Anonymous {
+		return true
+	}
+	file, err := u.load()
+	if errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	return err != nil || len(file.Users) > 0
+}
+
+// Get 按用户名查找用户
+func (u *Users) Get(name string) (*User, error) {
+	file, err := u.load()
+	if err != nil {
+		return nil, err
+	}
+	user := file.Find(name)
+	if user == nil {
+		return nil, fmt.Errorf("user %q not found", name)
+	}
+	return user, nil
+}
+
+// CheckSession 校验会话所属的用户仍然存在，且会话签发时的密码版本与当前一致
+func (u *Users) CheckSession(name string, generation int64) error {
+	user, err := u.Get(name)
+	if err != nil {
+		return err
+	}
+	if generation != user.Generation() {
+		return errors.New("password changed after session was issued")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"chihqiang/hoststat/config"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useUsersFile 使用临时目录中的用户文件，users 非空时写入这些用户（密码与用户名相同）
+func useUsersFile(t *testing.T, anonymous bool, users ...string) string {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Auth.UsersFile = filepath.Join(t.TempDir(), "users.json")
+	cfg.Auth.Anonymous = anonymous
+	config.Set(cfg)
+	if len(users) > 0 {
+		var file UserFile
+		for _, name := range users {
+			if err := file.Add(name, name, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := file.Write(cfg.Auth.UsersFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg.Auth.UsersFile
+}
+
+func TestMissingUsersFileRequiresLogin(t *testing.T) {
+	useUsersFile(t, false)
+	if !USERS.Required() {
+		t.Error("missing users file allows anonymous access without auth.anonymous")
+	}
+	if err := USERS.Check(); err == nil {
+		t.Error("missing users file is not reported")
+	}
+
+	useUsersFile(t, true)
+	if USERS.Required() {
+		t.Error("auth.anonymous without users still requires login")
+	}
+
+	useUsersFile(t, true, "alice")
+	if !USERS.Required() {
+		t.Error("users exist but login is not required in anonymous mode")
+	}
+}
+
+// 与会话签发在同一秒内修改密码，旧会话同样失效
+func TestCheckSessionAfterPasswordChange(t *testing.T) {
+	path := useUsersFile(t, false, "alice")
+	user, err := USERS.Get("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	generation := user.Generation()
+	if err := USERS.CheckSession("alice", generation); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ReadUserFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.SetPassword("alice", "changed", user.PasswordChangedAt.Add(time.Nanosecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := USERS.CheckSession("alice", generation); err == nil {
+		t.Fatal("session issued before the password change in the same second is still valid")
+	}
+}
+
+// 锁定按来源 IP 与用户名的组合计算，其他来源仍然可以登录
+func TestLockoutIsPerClient(t *testing.T) {
+	useUsersFile(t, false, "alice")
+	now := time.Now()
+	for i := range config.Get().Auth.MaxFailures {
+		_, locked, err := Authenticate("alice", "wrong", "192.0.2.1", now)
+		if want := i == config.Get().Auth.MaxFailures-1; locked != want {
+			t.Fatalf("attempt %d: locked = %t, want %t (error %v)", i+1, locked, want, err)
+		}
+	}
+	if _, _, err := Authenticate("alice", "alice", "192.0.2.1", now); !errors.Is(err, ErrLocked) {
+		t.Fatalf("locked client: error = %v, want ErrLocked", err)
+	}
+	user, _, err := Authenticate("alice", "alice", "192.0.2.2", now)
+	if err != nil || user == nil || user.Name != "alice" {
+		t.Fatalf("other client: user = %v, error = %v, want alice", user, err)
+	}
+}
@@ -0,0 +1,192 @@
+package certs
+
+import (
+	"chihqiang/hoststat/config"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":     tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Reloader 持有当前的证书和客户端 CA，定时检查文件，变化后重新加载
+// 新文件无法解析时记录错误并继续使用旧证书
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+	stamp     string // 文件的修改时间和大小
+	failed    string // 上次加载失败时的 stamp，文件再次变化前不重复报错
+}
+
+// NewReloader 加载证书、私钥和可选的客户端 CA，任一文件无效时返回错误
+func NewReloader(certFile, keyFile, caFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, caFile: caFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Setup 根据配置准备证书（必要时生成自签名证书），返回服务端 TLS 配置并在后台监控证书文件
+func Setup(ctx context.Context, cfg config.TLSConfig) (*tls.Config, error) {
+	certFile, keyFile := cfg.CertFile, cfg.KeyFile
+	if certFile == "" {
+		var err error
+		if certFile, keyFile, err = EnsureSelfSigned(cfg.SelfSignedDir, cfg.SelfSignedHosts); err != nil {
+			return nil, err
+		}
+	}
+	r, err := NewReloader(certFile, keyFile, cfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	go r.Run(ctx, cfg.ReloadInterval.Std())
+	logx.Info("TLS enabled | cert: %s | fingerprint: %s | client_auth: %s | min_version: %s", certFile, r.Fingerprint(), cfg.ClientAuth, cfg.MinVersion)
+	return r.TLSConfig(clientAuthTypes[cfg.ClientAuth], tlsVersions[cfg.MinVersion]), nil
+}
+
+// Run 每隔 interval 检查一次证书文件，ctx 取消后退出
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				logx.Error("TLS certificate reload failed, keeping current certificate | cert: %s | error: %v", r.certFile, err)
+			} else if changed {
+				logx.Info("TLS certificate reloaded | cert: %s | fingerprint: %s", r.certFile, r.Fingerprint())
+			}
+		}
+	}
+}
+
+// TLSConfig 返回使用当前证书的服务端配置；握手时读取最新的证书和客户端 CA
+// NextProtos 需要显式设置：GetConfigForClient 返回的配置会替换 http.Server 补充了 h2 的配置
+func (r *Reloader) TLSConfig(clientAuth tls.ClientAuthType, minVersion uint16) *tls.Config {
+	base := &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.cert.Load(), nil
+		},
+	}
+	if clientAuth != tls.NoClientCert {
+		base.ClientAuth = clientAuth
+		base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := base.Clone()
+			cfg.GetConfigForClient = nil
+			cfg.ClientCAs = r.clientCAs.Load()
+			return cfg, nil
+		}
+	}
+	return base
+}
+
+// Fingerprint 当前证书的 SHA-256 指纹
+func (r *Reloader) Fingerprint() string {
+	cert := r.cert.Load()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// reload 文件的修改时间或大小变化时重新加载，返回是否已更新
+func (r *Reloader) reload() (bool, error) {
+	stamp, err := fileStamp(r.certFile, r.keyFile, r.caFile)
+	if err != nil {
+		return false, err
+	}
+	if stamp == r.stamp || stamp == r.failed {
+		return false, nil
+	}
+	cert, pool, err := r.load()
+	if err != nil {
+		r.failed = stamp
+		return false, err
+	}
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	r.stamp = stamp
+	return true, nil
+}
+
+func (r *Reloader) load() (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return cert, nil, err
+	}
+	if r.caFile == "" {
+		return cert, nil, nil
+	}
+	data, err := os.ReadFile(r.caFile)
+	if err != nil {
+		return cert, nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return cert, nil, fmt.Errorf("no certificate found in %s", r.caFile)
+	}
+	return cert, pool, nil
+}
+
+func fileStamp(files ...string) (string, error) {
+	var stamp string
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+// VerifiedClient 返回通过 mTLS 校验的客户端证书名称：CommonName 以及 SAN 中的 DNS、邮箱和 URI
+// 证书只说明客户端是谁，拥有哪些权限由 auth.clientCerts 决定
+func VerifiedClient(r *http.Request) ([]string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	var names []string
+	if leaf.Subject.CommonName != "" {
+		names = append(names, leaf.Subject.CommonName)
+	}
+	names = append(names, leaf.DNSNames...)
+	names = append(names, leaf.EmailAddresses...)
+	for _, uri := range leaf.URIs {
+		names = append(names, uri.String())
+	}
+	return names, true
+}
@@ -0,0 +1,98 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	selfSignedCertName = "selfsigned.crt"
+	selfSignedKeyName  = "selfsigned.key"
+	selfSignedValidity = 365 * 24 * time.Hour
+	// selfSignedRenewBefore 剩余有效期不足该时间时在启动时重新生成
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+)
+
+// EnsureSelfSigned 返回 dir 下的自签名证书和私钥路径；文件不存在、无法解析、即将过期或是旧版本生成的 CA 证书时重新生成
+// 证书保存在磁盘上，重启后指纹不变，浏览器信任一次即可
+func EnsureSelfSigned(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, selfSignedCertName)
+	keyFile := filepath.Join(dir, selfSignedKeyName)
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil && !leaf.IsCA && time.Until(leaf.NotAfter) > selfSignedRenewBefore {
+			return certFile, keyFile, nil
+		}
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+		if hostname, err := os.Hostname(); err == nil && hostname != "" {
+			hosts = append([]string{hostname}, hosts...)
+		}
+	}
+	certPEM, keyPEM, err := generateSelfSigned(hosts, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return "", "", err
+	}
+	logx.Warn("Generated self-signed TLS certificate, browsers will show a warning until it is trusted | cert: %s | hosts: %v", certFile, hosts)
+	return certFile, keyFile, nil
+}
+
+func generateSelfSigned(hosts []string, now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"hoststat self-signed"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature, // 只用作服务端证书；信任它不会让客户端同时信任一个可以签发证书的 CA
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,402 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config 全部可配置项
+// 优先级：命令行参数 > HOSTSTAT_* 环境变量 > 配置文件 > 默认值
+// 每个字段的 env 标签为对应的环境变量，命令行参数名为 <分组>.<字段>，如 --server.addr
+type Config struct {
+	Server    ServerConfig    `json:"server" yaml:"server" toml:"server"`
+	TLS       TLSConfig       `json:"tls" yaml:"tls" toml:"tls"`
+	Token     TokenConfig     `json:"token" yaml:"token" toml:"token"`
+	Auth      AuthConfig      `json:"auth" yaml:"auth" toml:"auth"`
+	OIDC      OIDCConfig      `json:"oidc" yaml:"oidc" toml:"oidc"`
+	RateLimit RateLimitConfig `json:"rateLimit" yaml:"rateLimit" toml:"rateLimit"`
+	Access    AccessConfig    `json:"access" yaml:"access" toml:"access"`
+	Audit     AuditConfig     `json:"audit" yaml:"audit" toml:"audit"`
+	History   HistoryConfig   `json:"history" yaml:"history" toml:"history"`
+	Storage   StorageConfig   `json:"storage" yaml:"storage" toml:"storage"`
+	Alerts    AlertsConfig    `json:"alerts" yaml:"alerts" toml:"alerts"`
+	Notify    NotifyConfig    `json:"notify" yaml:"notify" toml:"notify"`
+	Metrics   MetricsConfig   `json:"metrics" yaml:"metrics" toml:"metrics"`
+	Collect   CollectConfig   `json:"collect" yaml:"collect" toml:"collect"`
+	Disk      DiskConfig      `json:"disk" yaml:"disk" toml:"disk"`
+	Net       NetConfig       `json:"net" yaml:"net" toml:"net"`
+	Processes ProcessesConfig `json:"processes" yaml:"processes" toml:"processes"`
+	Actions   ActionsConfig   `json:"actions" yaml:"actions" toml:"actions"`
+	Stream    StreamConfig    `json:"stream" yaml:"stream" toml:"stream"`
+	WS        WSConfig        `json:"ws" yaml:"ws" toml:"ws"`
+}
+
+type ServerConfig struct {
+	Addr            string   `json:"addr" yaml:"addr" toml:"addr" env:"HOSTSTAT_SERVER_ADDR" usage:"HTTP 监听地址"`
+	ReadTimeout     Duration `json:"readTimeout" yaml:"readTimeout" toml:"readTimeout" env:"HOSTSTAT_SERVER_READ_TIMEOUT" usage:"读取请求超时"`
+	WriteTimeout    Duration `json:"writeTimeout" yaml:"writeTimeout" toml:"writeTimeout" env:"HOSTSTAT_SERVER_WRITE_TIMEOUT" usage:"写入响应超时"`
+	IdleTimeout     Duration `json:"idleTimeout" yaml:"idleTimeout" toml:"idleTimeout" env:"HOSTSTAT_SERVER_IDLE_TIMEOUT" usage:"空闲连接超时"`
+	ShutdownTimeout Duration `json:"shutdownTimeout" yaml:"shutdownTimeout" toml:"shutdownTimeout" env:"HOSTSTAT_SERVER_SHUTDOWN_TIMEOUT" usage:"优雅关闭的最长等待时间"`
+}
+
+// TLSConfig 设置证书文件或开启自签名后使用 HTTPS；clientAuth 不为 none 时校验客户端证书（mTLS）
+type TLSConfig struct {
+	CertFile        string   `json:"certFile" yaml:"certFile" toml:"certFile" env:"HOSTSTAT_TLS_CERT_FILE" usage:"证书文件（PEM），文件变化后自动重新加载"`
+	KeyFile         string   `json:"keyFile" yaml:"keyFile" toml:"keyFile" env:"HOSTSTAT_TLS_KEY_FILE" usage:"私钥文件（PEM）"`
+	SelfSigned      bool     `json:"selfSigned" yaml:"selfSigned" toml:"selfSigned" env:"HOSTSTAT_TLS_SELF_SIGNED" usage:"未设置证书文件时使用自动生成的自签名证书"`
+	SelfSignedDir   string   `json:"selfSignedDir" yaml:"selfSignedDir" toml:"selfSignedDir" env:"HOSTSTAT_TLS_SELF_SIGNED_DIR" usage:"自签名证书的保存目录"`
+	SelfSignedHosts []string `json:"selfSignedHosts" yaml:"selfSignedHosts" toml:"selfSignedHosts" env:"HOSTSTAT_TLS_SELF_SIGNED_HOSTS" usage:"自签名证书包含的域名和 IP，为空时使用主机名和回环地址"`
+	ClientAuth      string   `json:"clientAuth" yaml:"clientAuth" toml:"clientAuth" env:"HOSTSTAT_TLS_CLIENT_AUTH" usage:"客户端证书校验：none、optional（提供时校验）、require"`
+	ClientCAFile    string   `json:"clientCAFile" yaml:"clientCAFile" toml:"clientCAFile" env:"HOSTSTAT_TLS_CLIENT_CA_FILE" usage:"校验客户端证书的 CA 证书（PEM），文件变化后自动重新加载"`
+	MinVersion      string   `json:"minVersion" yaml:"minVersion" toml:"minVersion" env:"HOSTSTAT_TLS_MIN_VERSION" usage:"最低 TLS 版本：1.2、1.3"`
+	ReloadInterval  Duration `json:"reloadInterval" yaml:"reloadInterval" toml:"reloadInterval" env:"HOSTSTAT_TLS_RELOAD_INTERVAL" usage:"检查证书文件变化的间隔"`
+}
+
+// Enabled 是否启用 HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.SelfSigned
+}
+
+// TokenConfig 会话令牌使用 HMAC-SHA256 签名；未配置 secret 时自动生成密钥并保存在 stateFile 中，按 rotateInterval 轮换
+type TokenConfig struct {
+	MaxAge          Duration `json:"maxAge" yaml:"maxAge" toml:"maxAge" env:"HOSTSTAT_TOKEN_MAX_AGE" usage:"会话令牌有效期"`
+	Secret          string   `json:"secret" yaml:"secret" toml:"secret" env:"HOSTSTAT_TOKEN_SECRET" secret:"true" usage:"会话签名密钥（至少 32 字节），为空时自动生成"`
+	PreviousSecrets []string `json:"previousSecrets" yaml:"previousSecrets" toml:"previousSecrets" env:"HOSTSTAT_TOKEN_PREVIOUS_SECRETS" secret:"true" usage:"更换 secret 后仍接受的旧密钥，首次加载后 token.rotateGrace 内有效"`
+	StateFile       string   `json:"stateFile" yaml:"stateFile" toml:"stateFile" env:"HOSTSTAT_TOKEN_STATE_FILE" usage:"自动生成的签名密钥与吊销记录的保存文件"`
+	RotateInterval  Duration `json:"rotateInterval" yaml:"rotateInterval" toml:"rotateInterval" env:"HOSTSTAT_TOKEN_ROTATE_INTERVAL" usage:"自动生成的签名密钥的轮换周期"`
+	RotateGrace     Duration `json:"rotateGrace" yaml:"rotateGrace" toml:"rotateGrace" env:"HOSTSTAT_TOKEN_ROTATE_GRACE" usage:"轮换后旧密钥继续有效的时间"`
+}
+
+// AuthConfig 用户文件中存在用户时，访问页面和接口需要先登录；用户通过 hoststat user 子命令管理
+// 机器客户端使用 API Key（Authorization: Bearer hsk_...），通过 hoststat apikey 子命令管理
+type AuthConfig struct {
+	UsersFile        string   `json:"usersFile" yaml:"usersFile" toml:"usersFile" env:"HOSTSTAT_AUTH_USERS_FILE" usage:"本地用户文件，文件变化后自动重新读取；未开启 auth.anonymous 时文件不存在视为错误"`
+	Anonymous        bool     `json:"anonymous" yaml:"anonymous" toml:"anonymous" env:"HOSTSTAT_AUTH_ANONYMOUS" usage:"没有本地用户且未启用单点登录时允许不登录访问；关闭时缺少用户文件或没有用户将拒绝启动"`
+	MaxFailures      int      `json:"maxFailures" yaml:"maxFailures" toml:"maxFailures" env:"HOSTSTAT_AUTH_MAX_FAILURES" usage:"同一来源 IP 对同一用户名或全部用户名连续登录失败多少次后锁定"`
+	FailureWindow    Duration `json:"failureWindow" yaml:"failureWindow" toml:"failureWindow" env:"HOSTSTAT_AUTH_FAILURE_WINDOW" usage:"统计登录失败次数的时间窗口"`
+	LockoutDuration  Duration `json:"lockoutDuration" yaml:"lockoutDuration" toml:"lockoutDuration" env:"HOSTSTAT_AUTH_LOCKOUT_DURATION" usage:"锁定时长"`
+	APIKeysFile      string   `json:"apiKeysFile" yaml:"apiKeysFile" toml:"apiKeysFile" env:"HOSTSTAT_AUTH_API_KEYS_FILE" usage:"API Key 文件（只保存哈希），由 hoststat apikey 子命令维护，文件变化后自动重新读取"`
+	APIKeysUsageFile string   `json:"apiKeysUsageFile" yaml:"apiKeysUsageFile" toml:"apiKeysUsageFile" env:"HOSTSTAT_AUTH_API_KEYS_USAGE_FILE" usage:"API Key 最近使用时间和来源 IP 的保存文件"`
+	ClientCerts      []string `json:"clientCerts" yaml:"clientCerts" toml:"clientCerts" env:"HOSTSTAT_AUTH_CLIENT_CERTS" usage:"接受的客户端证书及其权限：<名称>=<权限>[+<权限>]，名称（glob）匹配证书的 CN 或 SAN，权限为 viewer、admin 或 metrics:read、processes:read；为空时不接受任何客户端证书"`
+}
+
+// OIDCConfig 设置 issuer 后首页支持通过 OpenID Connect（授权码 + PKCE）单点登录
+// 用户所在的组决定角色：adminGroups 为 admin，viewerGroups 为 viewer（只读），都不匹配时拒绝登录
+type OIDCConfig struct {
+	Issuer        string   `json:"issuer" yaml:"issuer" toml:"issuer" env:"HOSTSTAT_OIDC_ISSUER" usage:"OIDC 提供方地址（从 <issuer>/.well-known/openid-configuration 读取端点），为空时关闭单点登录"`
+	ClientID      string   `json:"clientId" yaml:"clientId" toml:"clientId" env:"HOSTSTAT_OIDC_CLIENT_ID" usage:"客户端ID"`
+	ClientSecret  string   `json:"clientSecret" yaml:"clientSecret" toml:"clientSecret" env:"HOSTSTAT_OIDC_CLIENT_SECRET" secret:"true" usage:"客户端密钥，公开客户端可为空"`
+	RedirectURL   string   `json:"redirectUrl" yaml:"redirectUrl" toml:"redirectUrl" env:"HOSTSTAT_OIDC_REDIRECT_URL" usage:"回调地址（<外部地址>/oidc/callback），为空时按请求的 Host 生成"`
+	Scopes        []string `json:"scopes" yaml:"scopes" toml:"scopes" env:"HOSTSTAT_OIDC_SCOPES" usage:"申请的 scope，需包含 openid"`
+	UsernameClaim string   `json:"usernameClaim" yaml:"usernameClaim" toml:"usernameClaim" env:"HOSTSTAT_OIDC_USERNAME_CLAIM" usage:"作为用户名的 ID Token 字段，缺失时使用 sub"`
+	GroupsClaim   string   `json:"groupsClaim" yaml:"groupsClaim" toml:"groupsClaim" env:"HOSTSTAT_OIDC_GROUPS_CLAIM" usage:"ID Token 中的组字段"`
+	AdminGroups   []string `json:"adminGroups" yaml:"adminGroups" toml:"adminGroups" env:"HOSTSTAT_OIDC_ADMIN_GROUPS" usage:"映射为 admin 角色的组"`
+	ViewerGroups  []string `json:"viewerGroups" yaml:"viewerGroups" toml:"viewerGroups" env:"HOSTSTAT_OIDC_VIEWER_GROUPS" usage:"映射为 viewer 角色的组；不属于 adminGroups 和 viewerGroups 的用户拒绝登录"`
+	SessionMaxAge Duration `json:"sessionMaxAge" yaml:"sessionMaxAge" toml:"sessionMaxAge" env:"HOSTSTAT_OIDC_SESSION_MAX_AGE" usage:"单点登录会话的最长有效期，超过 token.maxAge 时按 token.maxAge"`
+}
+
+// Enabled 是否启用单点登录
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// RateLimitConfig 每个调用方（API Key、登录用户、客户端证书，其他按来源 IP）一个令牌桶，接口按开销扣除令牌；
+// 遍历全部进程等重型采集另外限制全局并发数；超出时返回 429 和 Retry-After
+type RateLimitConfig struct {
+	Rate          int      `json:"rate" yaml:"rate" toml:"rate" env:"HOSTSTAT_RATE_LIMIT_RATE" usage:"每个调用方每秒补充的令牌数，0 表示不限流"`
+	Burst         int      `json:"burst" yaml:"burst" toml:"burst" env:"HOSTSTAT_RATE_LIMIT_BURST" usage:"令牌桶容量（允许的突发开销）"`
+	MaxConcurrent int      `json:"maxConcurrent" yaml:"maxConcurrent" toml:"maxConcurrent" env:"HOSTSTAT_RATE_LIMIT_MAX_CONCURRENT" usage:"同时执行的重型采集上限，0 表示不限制"`
+	QueueTimeout  Duration `json:"queueTimeout" yaml:"queueTimeout" toml:"queueTimeout" env:"HOSTSTAT_RATE_LIMIT_QUEUE_TIMEOUT" usage:"重型采集等待空闲名额的最长时间"`
+	IPRate        int      `json:"ipRate" yaml:"ipRate" toml:"ipRate" env:"HOSTSTAT_RATE_LIMIT_IP_RATE" usage:"认证之前每个来源 IP 每秒允许的请求数，0 表示不限流"`
+	IPBurst       int      `json:"ipBurst" yaml:"ipBurst" toml:"ipBurst" env:"HOSTSTAT_RATE_LIMIT_IP_BURST" usage:"认证之前每个来源 IP 允许的突发请求数"`
+}
+
+// AccessConfig 按客户端地址限制访问，列表项为 CIDR 或单个 IP
+// 直接连接的对端属于 trustedProxies 时，客户端地址取自 forwardedHeader 指定的请求头，否则使用连接地址
+type AccessConfig struct {
+	Allow           []string `json:"allow" yaml:"allow" toml:"allow" env:"HOSTSTAT_ACCESS_ALLOW" usage:"允许访问的客户端地址，为空时不限制"`
+	Deny            []string `json:"deny" yaml:"deny" toml:"deny" env:"HOSTSTAT_ACCESS_DENY" usage:"拒绝访问的客户端地址，优先于 allow"`
+	TrustedProxies  []string `json:"trustedProxies" yaml:"trustedProxies" toml:"trustedProxies" env:"HOSTSTAT_ACCESS_TRUSTED_PROXIES" usage:"受信任的反向代理地址，只有来自这些地址的 forwardedHeader 才会被采用"`
+	ForwardedHeader string   `json:"forwardedHeader" yaml:"forwardedHeader" toml:"forwardedHeader" env:"HOSTSTAT_ACCESS_FORWARDED_HEADER" usage:"代理设置的客户端地址请求头：X-Forwarded-For、Forwarded 或 X-Real-IP，其他请求头一律忽略"`
+}
+
+// AuditConfig 登录、退出、认证失败、API Key 使用、配置重新加载和各类写操作以 JSON Lines 格式追加到审计文件，按大小轮转
+type AuditConfig struct {
+	File       string `json:"file" yaml:"file" toml:"file" env:"HOSTSTAT_AUDIT_FILE" usage:"审计日志文件，为空时不记录"`
+	MaxSize    Size   `json:"maxSize" yaml:"maxSize" toml:"maxSize" env:"HOSTSTAT_AUDIT_MAX_SIZE" usage:"单个审计日志文件的大小上限，超过后轮转为 <file>.1，0 表示不轮转"`
+	MaxBackups int    `json:"maxBackups" yaml:"maxBackups" toml:"maxBackups" env:"HOSTSTAT_AUDIT_MAX_BACKUPS" usage:"保留的轮转文件数量，audit.maxSize 不为 0 时至少为 1"`
+}
+
+type HistoryConfig struct {
+	Resolution Duration `json:"resolution" yaml:"resolution" toml:"resolution" env:"HOSTSTAT_HISTORY_RESOLUTION" usage:"采样间隔"`
+	Retention  Duration `json:"retention" yaml:"retention" toml:"retention" env:"HOSTSTAT_HISTORY_RETENTION" usage:"内存历史缓冲区保留时长"`
+}
+
+type StorageConfig struct {
+	Dir             string   `json:"dir" yaml:"dir" toml:"dir" env:"HOSTSTAT_STORAGE_DIR" usage:"磁盘存储目录，为空时不持久化"`
+	RawRetention    Duration `json:"rawRetention" yaml:"rawRetention" toml:"rawRetention" env:"HOSTSTAT_STORAGE_RAW_RETENTION" usage:"原始精度数据保留时长"`
+	MinuteRetention Duration `json:"minuteRetention" yaml:"minuteRetention" toml:"minuteRetention" env:"HOSTSTAT_STORAGE_MINUTE_RETENTION" usage:"1分钟汇总数据保留时长"`
+	HourRetention   Duration `json:"hourRetention" yaml:"hourRetention" toml:"hourRetention" env:"HOSTSTAT_STORAGE_HOUR_RETENTION" usage:"1小时汇总数据保留时长"`
+	MaxBytes        Size     `json:"maxBytes" yaml:"maxBytes" toml:"maxBytes" env:"HOSTSTAT_STORAGE_MAX_BYTES" usage:"磁盘存储占用上限，如 512MB，0 表示不限制"`
+}
+
+type AlertsConfig struct {
+	RulesFile string `json:"rulesFile" yaml:"rulesFile" toml:"rulesFile" env:"HOSTSTAT_ALERT_RULES" usage:"告警规则文件（JSON）"`
+}
+
+type NotifyConfig struct {
+	ConfigFile string `json:"configFile" yaml:"configFile" toml:"configFile" env:"HOSTSTAT_NOTIFY_CONFIG" usage:"告警通知配置文件（JSON）"`
+}
+
+type MetricsConfig struct {
+	Token     string `json:"token" yaml:"token" toml:"token" env:"HOSTSTAT_METRICS_TOKEN" secret:"true" usage:"/metrics 的 Bearer Token"`
+	User      string `json:"user" yaml:"user" toml:"user" env:"HOSTSTAT_METRICS_USER" usage:"/metrics 的 Basic Auth 用户名"`
+	Password  string `json:"password" yaml:"password" toml:"password" env:"HOSTSTAT_METRICS_PASSWORD" secret:"true" usage:"/metrics 的 Basic Auth 密码"`
+	Anonymous bool   `json:"anonymous" yaml:"anonymous" toml:"anonymous" env:"HOSTSTAT_METRICS_ANONYMOUS" usage:"未设置 token 和 password 时允许不认证访问 /metrics，默认拒绝"`
+}
+
+// CollectConfig 系统指标采集的缓存时间
+type CollectConfig struct {
+	CPUInterval       Duration `json:"cpuInterval" yaml:"cpuInterval" toml:"cpuInterval" env:"HOSTSTAT_COLLECT_CPU_INTERVAL" usage:"CPU、网卡、磁盘I/O 两次采样的最小间隔，间隔内返回缓存"`
+	CPUResetInterval  Duration `json:"cpuResetInterval" yaml:"cpuResetInterval" toml:"cpuResetInterval" env:"HOSTSTAT_COLLECT_CPU_RESET_INTERVAL" usage:"CPU 基线超过该时间后重新建立"`
+	HostInfoInterval  Duration `json:"hostInfoInterval" yaml:"hostInfoInterval" toml:"hostInfoInterval" env:"HOSTSTAT_COLLECT_HOST_INFO_INTERVAL" usage:"主机信息缓存时间"`
+	DiskUsageInterval Duration `json:"diskUsageInterval" yaml:"diskUsageInterval" toml:"diskUsageInterval" env:"HOSTSTAT_COLLECT_DISK_USAGE_INTERVAL" usage:"磁盘使用量缓存时间"`
+	DiskUsageTimeout  Duration `json:"diskUsageTimeout" yaml:"diskUsageTimeout" toml:"diskUsageTimeout" env:"HOSTSTAT_COLLECT_DISK_USAGE_TIMEOUT" usage:"读取单个挂载点使用量的超时"`
+	PartitionInterval Duration `json:"partitionInterval" yaml:"partitionInterval" toml:"partitionInterval" env:"HOSTSTAT_COLLECT_PARTITION_INTERVAL" usage:"分区列表缓存时间"`
+	InterfaceInterval Duration `json:"interfaceInterval" yaml:"interfaceInterval" toml:"interfaceInterval" env:"HOSTSTAT_COLLECT_INTERFACE_INTERVAL" usage:"网卡元信息缓存时间"`
+}
+
+type DiskConfig struct {
+	ExcludeMounts []string `json:"excludeMounts" yaml:"excludeMounts" toml:"excludeMounts" env:"HOSTSTAT_DISK_EXCLUDE_MOUNTS" usage:"不显示的挂载点"`
+	ExcludeTypes  []string `json:"excludeTypes" yaml:"excludeTypes" toml:"excludeTypes" env:"HOSTSTAT_DISK_EXCLUDE_TYPES" usage:"不显示的文件系统类型"`
+	MaxMountDepth int      `json:"maxMountDepth" yaml:"maxMountDepth" toml:"maxMountDepth" env:"HOSTSTAT_DISK_MAX_MOUNT_DEPTH" usage:"挂载点路径超过该层级时不显示"`
+	IOExclude     []string `json:"ioExclude" yaml:"ioExclude" toml:"ioExclude" env:"HOSTSTAT_DISK_IO_EXCLUDE" usage:"不显示I/O统计的块设备（glob）"`
+}
+
+type NetConfig struct {
+	Exclude []string `json:"exclude" yaml:"exclude" toml:"exclude" env:"HOSTSTAT_NET_EXCLUDE" usage:"不显示的网卡（glob）"`
+}
+
+type ProcessesConfig struct {
+	CacheInterval    Duration `json:"cacheInterval" yaml:"cacheInterval" toml:"cacheInterval" env:"HOSTSTAT_PROCESSES_CACHE_INTERVAL" usage:"进程表缓存时间"`
+	TopCacheInterval Duration `json:"topCacheInterval" yaml:"topCacheInterval" toml:"topCacheInterval" env:"HOSTSTAT_PROCESSES_TOP_CACHE_INTERVAL" usage:"WebSocket 进程排行缓存时间"`
+	CPUResetInterval Duration `json:"cpuResetInterval" yaml:"cpuResetInterval" toml:"cpuResetInterval" env:"HOSTSTAT_PROCESSES_CPU_RESET_INTERVAL" usage:"距上次扫描超过该时间时重新建立 CPU 基线"`
+	CPUBaselineDelay Duration `json:"cpuBaselineDelay" yaml:"cpuBaselineDelay" toml:"cpuBaselineDelay" env:"HOSTSTAT_PROCESSES_CPU_BASELINE_DELAY" usage:"建立 CPU 基线后等待的时间"`
+	EnvRedact        []string `json:"envRedact" yaml:"envRedact" toml:"envRedact" env:"HOSTSTAT_ENV_REDACT" usage:"进程详情中隐藏值的环境变量名（glob，不区分大小写）"`
+}
+
+type ActionsConfig struct {
+	AdminToken       string   `json:"adminToken" yaml:"adminToken" toml:"adminToken" env:"HOSTSTAT_ADMIN_TOKEN" secret:"true" usage:"页面进行进程操作和会话管理的管理令牌，为空时只允许 admin 权限的 API Key"`
+	AllowUsers       []string `json:"allowUsers" yaml:"allowUsers" toml:"allowUsers" env:"HOSTSTAT_ACTION_ALLOW_USERS" usage:"允许操作的进程属主（glob）"`
+	AllowExecutables []string `json:"allowExecutables" yaml:"allowExecutables" toml:"allowExecutables" env:"HOSTSTAT_ACTION_ALLOW_EXECUTABLES" usage:"允许操作的进程可执行文件路径（glob，匹配解析符号链接后的 exe 路径）"`
+	ConfirmTTL       Duration `json:"confirmTTL" yaml:"confirmTTL" toml:"confirmTTL" env:"HOSTSTAT_ACTION_CONFIRM_TTL" usage:"确认令牌有效期"`
+}
+
+type StreamConfig struct {
+	Heartbeat    Duration `json:"heartbeat" yaml:"heartbeat" toml:"heartbeat" env:"HOSTSTAT_STREAM_HEARTBEAT" usage:"SSE 心跳间隔"`
+	Retry        Duration `json:"retry" yaml:"retry" toml:"retry" env:"HOSTSTAT_STREAM_RETRY" usage:"SSE 客户端重连间隔"`
+	WriteTimeout Duration `json:"writeTimeout" yaml:"writeTimeout" toml:"writeTimeout" env:"HOSTSTAT_STREAM_WRITE_TIMEOUT" usage:"SSE 单次写入超时"`
+}
+
+type WSConfig struct {
+	PingInterval Duration `json:"pingInterval" yaml:"pingInterval" toml:"pingInterval" env:"HOSTSTAT_WS_PING_INTERVAL" usage:"WebSocket ping 间隔"`
+	PongTimeout  Duration `json:"pongTimeout" yaml:"pongTimeout" toml:"pongTimeout" env:"HOSTSTAT_WS_PONG_TIMEOUT" usage:"WebSocket 未收到 pong 的断开时间"`
+	WriteTimeout Duration `json:"writeTimeout" yaml:"writeTimeout" toml:"writeTimeout" env:"HOSTSTAT_WS_WRITE_TIMEOUT" usage:"WebSocket 单次写入超时"`
+	MaxInterval  Duration `json:"maxInterval" yaml:"maxInterval" toml:"maxInterval" env:"HOSTSTAT_WS_MAX_INTERVAL" usage:"客户端可订阅的最大推送间隔"`
+}
+
+// Default 返回默认配置，与之前代码中的常量保持一致
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     Duration(15 * time.Second),
+			WriteTimeout:    Duration(15 * time.Second),
+			IdleTimeout:     Duration(60 * time.Second),
+			ShutdownTimeout: Duration(5 * time.Second),
+		},
+		TLS: TLSConfig{
+			SelfSignedDir:   "tls",
+			SelfSignedHosts: []string{},
+			ClientAuth:      "none",
+			MinVersion:      "1.2",
+			ReloadInterval:  Duration(30 * time.Second),
+		},
+		Token: TokenConfig{
+			MaxAge:          Duration(24 * time.Hour),
+			PreviousSecrets: []string{},
+			StateFile:       "hoststat-session.json",
+			RotateInterval:  Duration(7 * 24 * time.Hour),
+			RotateGrace:     Duration(24 * time.Hour),
+		},
+		Auth: AuthConfig{
+			UsersFile:        "hoststat-users.json",
+			MaxFailures:      5,
+			FailureWindow:    Duration(15 * time.Minute),
+			LockoutDuration:  Duration(15 * time.Minute),
+			APIKeysFile:      "hoststat-apikeys.json",
+			APIKeysUsageFile: "hoststat-apikeys-usage.json",
+		},
+		OIDC: OIDCConfig{
+			Scopes:        []string{"openid", "profile", "email"},
+			UsernameClaim: "email",
+			GroupsClaim:   "groups",
+			AdminGroups:   []string{},
+			ViewerGroups:  []string{},
+			SessionMaxAge: Duration(8 * time.Hour),
+		},
+		RateLimit: RateLimitConfig{
+			Rate:          5,
+			Burst:         50,
+			MaxConcurrent: 4,
+			QueueTimeout:  Duration(2 * time.Second),
+			IPRate:        20,
+			IPBurst:       100,
+		},
+		Access: AccessConfig{
+			Allow:           []string{},
+			Deny:            []string{},
+			TrustedProxies:  []string{},
+			ForwardedHeader: "X-Forwarded-For",
+		},
+		Audit: AuditConfig{
+			File:       "hoststat-audit.jsonl",
+			MaxSize:    10 << 20,
+			MaxBackups: 5,
+		},
+		History: HistoryConfig{
+			Resolution: Duration(5 * time.Second),
+			Retention:  Duration(1 * time.Hour),
+		},
+		Storage: StorageConfig{
+			RawRetention:    Duration(24 * time.Hour),
+			MinuteRetention: Duration(7 * 24 * time.Hour),
+			HourRetention:   Duration(90 * 24 * time.Hour),
+			MaxBytes:        512 << 20,
+		},
+		Collect: CollectConfig{
+			CPUInterval:       Duration(3 * time.Second),
+			CPUResetInterval:  Duration(1 * time.Minute),
+			HostInfoInterval:  Duration(4 * time.Hour),
+			DiskUsageInterval: Duration(30 * time.Second),
+			DiskUsageTimeout:  Duration(5 * time.Second),
+			PartitionInterval: Duration(10 * time.Minute),
+			InterfaceInterval: Duration(1 * time.Minute),
+		},
+		Disk: DiskConfig{
+			ExcludeMounts: []string{"/mnt/cdrom", "/boot", "/boot/efi", "/dev", "/dev/shm", "/run/lock", "/run", "/run/shm", "/run/user", "/snap"},
+			ExcludeTypes:  []string{"tmpfs", "overlay", "proc", "cgroup", "sysfs", "mqueue", "devpts"},
+			MaxMountDepth: 10,
+			IOExclude:     []string{"loop*", "ram*", "zram*", "sr*", "fd*"},
+		},
+		Net: NetConfig{
+			Exclude: []string{"lo", "veth*", "docker*", "br-*", "virbr*", "cni*", "flannel*"},
+		},
+		Processes: ProcessesConfig{
+			CacheInterval:    Duration(2 * time.Second),
+			TopCacheInterval: Duration(5 * time.Second),
+			CPUResetInterval: Duration(1 * time.Minute),
+			CPUBaselineDelay: Duration(500 * time.Millisecond),
+			EnvRedact:        []string{"*PASSWORD*", "*PASSWD*", "*SECRET*", "*TOKEN*", "*KEY*", "*CREDENTIAL*", "*AUTH*", "*COOKIE*", "*SESSION*", "*DSN*", "*URL*", "*URI*", "*CONN*", "*PASS*", "*PWD*", "*PRIVATE*", "*CERT*"},
+		},
+		Actions: ActionsConfig{
+			AllowUsers:       []string{},
+			AllowExecutables: []string{},
+			ConfirmTTL:       Duration(60 * time.Second),
+		},
+		Stream: StreamConfig{
+			Heartbeat:    Duration(15 * time.Second),
+			Retry:        Duration(3 * time.Second),
+			WriteTimeout: Duration(10 * time.Second),
+		},
+		WS: WSConfig{
+			PingInterval: Duration(25 * time.Second),
+			PongTimeout:  Duration(60 * time.Second),
+			WriteTimeout: Duration(10 * time.Second),
+			MaxInterval:  Duration(10 * time.Minute),
+		},
+	}
+}
+
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(Default())
+}
+
+// Get 返回当前生效的配置，调用方不应修改返回值
+func Get() *Config {
+	return current.Load()
+}
+
+// Set 替换当前生效的配置
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
+
+// Duration 配置中的时长，使用 time.ParseDuration 的格式，如 "15s"、"1h30m"
+type Duration time.Duration
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(strings.TrimSpace(string(text)))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Size 配置中的字节数，支持 B、KB、MB、GB、TB 后缀（按 1024 进制），不带后缀时为字节
+type Size int64
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+func (s Size) MarshalText() ([]byte, error) {
+	for _, unit := range sizeUnits {
+		if s != 0 && int64(s)%unit.factor == 0 {
+			return []byte(strconv.FormatInt(int64(s)/unit.factor, 10) + unit.suffix), nil
+		}
+	}
+	return []byte("0"), nil
+}
+
+func (s *Size) UnmarshalText(text []byte) error {
+	value := strings.ToUpper(strings.TrimSpace(string(text)))
+	// 同时接受 MiB 这种写法
+	if number, ok := strings.CutSuffix(value, "IB"); ok {
+		value = number + "B"
+	}
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, factor = number, unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", text)
+	}
+	if n > math.MaxInt64/factor {
+		return fmt.Errorf("size %q is too large", text)
+	}
+	*s = Size(n * factor)
+	return nil
+}
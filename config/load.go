@@ -0,0 +1,385 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const secretMask = "******"
+
+// Flags 解析后的命令行参数；重新加载配置时复用同一份参数，保证命令行始终优先
+type Flags struct {
+	ConfigFile  string
+	PrintConfig bool
+	Args        []string          // 位置参数，如 hoststat user add <用户名> 中的 add 与用户名
+	overrides   map[string]string // 字段路径 -> 命令行中的原始值
+}
+
+// field 配置中的一个叶子字段
+type field struct {
+	key    string // 如 server.addr
+	env    string
+	usage  string
+	secret bool
+	value  reflect.Value
+}
+
+// fields 按声明顺序列出配置的全部叶子字段
+func fields(cfg *Config) []field {
+	var list []field
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		sectionKey := root.Type().Field(i).Tag.Get("yaml")
+		for j := 0; j < section.NumField(); j++ {
+			sf := section.Type().Field(j)
+			list = append(list, field{
+				key:    sectionKey + "." + sf.Tag.Get("yaml"),
+				env:    sf.Tag.Get("env"),
+				usage:  sf.Tag.Get("usage"),
+				secret: sf.Tag.Get("secret") == "true",
+				value:  section.Field(j),
+			})
+		}
+	}
+	return list
+}
+
+// set 将字符串形式的值写入字段；列表使用逗号分隔，空字符串表示空列表
+func (f field) set(raw string) error {
+	if u, ok := f.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		f.value.SetInt(int64(n))
+	case reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", f.value.Type())
+	}
+	return nil
+}
+
+// flagValue 只记录命令行中的原始值，在读取配置文件和环境变量之后再应用
+type flagValue struct {
+	key       string
+	isBool    bool
+	overrides map[string]string
+}
+
+func (v *flagValue) String() string { return "" }
+
+// IsBoolFlag 布尔字段允许只写 --tls.selfSigned
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+func (v *flagValue) Set(raw string) error {
+	v.overrides[v.key] = raw
+	return nil
+}
+
+// ParseFlags 解析命令行参数：--config、--print-config 以及每个配置项对应的 --<分组>.<字段>
+// 位置参数与选项可以交替出现，按顺序保存在 Flags.Args 中；extra 用于注册子命令自己的选项
+func ParseFlags(name string, args []string, extra ...func(fs *flag.FlagSet)) (*Flags, error) {
+	flags := &Flags{overrides: make(map[string]string)}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&flags.ConfigFile, "config", os.Getenv("HOSTSTAT_CONFIG"), "配置文件路径（.yaml/.yml/.toml/.json），也可通过 HOSTSTAT_CONFIG 指定")
+	fs.BoolVar(&flags.PrintConfig, "print-config", false, "打印生效的配置（YAML）后退出")
+	defaults := Default()
+	for _, f := range fields(defaults) {
+		usage := f.usage
+		if f.env != "" {
+			usage += "（环境变量 " + f.env + "）"
+		}
+		if !f.secret {
+			text, _ := formatValue(f.value)
+			usage += "，默认 " + strconv.Quote(text)
+		}
+		isBool := f.value.Kind() == reflect.Bool
+		fs.Var(&flagValue{key: f.key, isBool: isBool, overrides: flags.overrides}, f.key, usage)
+	}
+	for _, register := range extra {
+		register(fs)
+	}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return flags, nil
+		}
+		if n := len(args) - fs.NArg(); n > 0 && args[n-1] == "--" {
+			// "--" 之后全部作为位置参数
+			flags.Args = append(flags.Args, fs.Args()...)
+			return flags, nil
+		}
+		flags.Args = append(flags.Args, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// Load 按 默认值 -> 配置文件 -> 环境变量 -> 命令行参数 的顺序合并配置并校验
+func Load(flags *Flags) (*Config, error) {
+	cfg := Default()
+	if flags.ConfigFile != "" {
+		if err := decodeFile(flags.ConfigFile, cfg); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range fields(cfg) {
+		if f.env == "" {
+			continue
+		}
+		if raw, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(raw); err != nil {
+				return nil, fmt.Errorf("environment %s: %w", f.env, err)
+			}
+		}
+	}
+	for _, f := range fields(cfg) {
+		if raw, ok := flags.overrides[f.key]; ok {
+			if err := f.set(raw); err != nil {
+				return nil, fmt.Errorf("flag --%s: %w", f.key, err)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decodeFile 根据扩展名解析配置文件，出现未知字段时报错，避免拼写错误被静默忽略
+func decodeFile(file string, cfg *Config) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse config %s: %w", file, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("parse config %s: %w", file, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parse config %s: unknown keys %v", file, undecoded)
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return fmt.Errorf("parse config %s: %w", file, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config format %q, expected .yaml, .yml, .toml or .json", filepath.Ext(file))
+	}
+	return nil
+}
+
+// Validate 校验配置，返回全部错误
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+	for _, f := range fields(c) {
+		switch v := f.value.Interface().(type) {
+		case Duration:
+			check(v > 0, f.key, "must be positive")
+		case Size:
+			// 大小为 0 表示不限制
+			check(v >= 0, f.key, "must not be negative")
+		case []string:
+			if f.secret {
+				continue
+			}
+			for _, pattern := range v {
+				_, err := path.Match(pattern, "")
+				check(err == nil, f.key, "invalid pattern %q", pattern)
+			}
+		}
+	}
+	check(c.Server.Addr != "", "server.addr", "must not be empty")
+	check(c.Token.Secret == "" || len(c.Token.Secret) >= 32, "token.secret", "must be at least 32 bytes")
+	for _, secret := range c.Token.PreviousSecrets {
+		check(len(secret) >= 32, "token.previousSecrets", "must be at least 32 bytes")
+	}
+	check(c.Token.StateFile != "", "token.stateFile", "must not be empty")
+	check(c.Auth.UsersFile != "", "auth.usersFile", "must not be empty")
+	check(c.Auth.MaxFailures > 0, "auth.maxFailures", "must be positive")
+	check(c.Auth.APIKeysFile != "", "auth.apiKeysFile", "must not be empty")
+	check(c.Auth.APIKeysUsageFile != "", "auth.apiKeysUsageFile", "must not be empty")
+	check(c.RateLimit.Rate >= 0, "rateLimit.rate", "must not be negative")
+	check(c.RateLimit.Rate == 0 || c.RateLimit.Burst > 0, "rateLimit.burst", "must be positive")
+	check(c.RateLimit.MaxConcurrent >= 0, "rateLimit.maxConcurrent", "must not be negative")
+	check(c.RateLimit.IPRate >= 0, "rateLimit.ipRate", "must not be negative")
+	check(c.RateLimit.IPRate == 0 || c.RateLimit.IPBurst > 0, "rateLimit.ipBurst", "must be positive")
+	for _, list := range []struct {
+		key   string
+		items []string
+	}{{"access.allow", c.Access.Allow}, {"access.deny", c.Access.Deny}, {"access.trustedProxies", c.Access.TrustedProxies}} {
+		for _, item := range list.items {
+			check(isCIDR(item), list.key, "invalid CIDR or IP %q", item)
+		}
+	}
+	check(slices.ContainsFunc(forwardedHeaders, func(h string) bool { return strings.EqualFold(h, c.Access.ForwardedHeader) }), "access.forwardedHeader", "expected %s", strings.Join(forwardedHeaders, ", "))
+	for _, rule := range c.Auth.ClientCerts {
+		check(isClientCertRule(rule), "auth.clientCerts", "invalid rule %q, expected <name>=<permission>[+<permission>] with permissions %s", rule, strings.Join(clientCertPermissions, ", "))
+	}
+	check(!c.Metrics.Anonymous || c.Metrics.Token == "" && c.Metrics.Password == "", "metrics.anonymous", "must not be set together with metrics.token or metrics.password")
+	check(c.Audit.MaxBackups >= 0, "audit.maxBackups", "must not be negative")
+	check(c.Audit.MaxSize == 0 || c.Audit.MaxBackups > 0, "audit.maxBackups", "must be positive when audit.maxSize is set, set audit.maxSize to 0 to disable rotation")
+	if c.OIDC.Enabled() {
+		check(isHTTPURL(c.OIDC.Issuer), "oidc.issuer", "must be an http(s) URL")
+		check(c.OIDC.ClientID != "", "oidc.clientId", "required when oidc.issuer is set")
+		check(slices.Contains(c.OIDC.Scopes, "openid"), "oidc.scopes", "must include openid")
+		check(c.OIDC.RedirectURL == "" || isHTTPURL(c.OIDC.RedirectURL), "oidc.redirectUrl", "must be an http(s) URL")
+		check(c.OIDC.GroupsClaim != "", "oidc.groupsClaim", "must not be empty")
+		check(len(c.OIDC.AdminGroups)+len(c.OIDC.ViewerGroups) > 0, "oidc.viewerGroups", "oidc.adminGroups or oidc.viewerGroups is required, users in neither are denied")
+	}
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.certFile", "tls.certFile and tls.keyFile must be set together")
+	check(slices.Contains([]string{"none", "optional", "require"}, c.TLS.ClientAuth), "tls.clientAuth", "expected none, optional or require")
+	check(c.TLS.ClientAuth == "none" || c.TLS.ClientCAFile != "", "tls.clientCAFile", "required when tls.clientAuth is %s", c.TLS.ClientAuth)
+	check(c.TLS.ClientCAFile == "" || c.TLS.Enabled(), "tls.clientCAFile", "requires tls.certFile or tls.selfSigned")
+	check(slices.Contains([]string{"1.2", "1.3"}, c.TLS.MinVersion), "tls.minVersion", "expected 1.2 or 1.3")
+	check(!c.TLS.SelfSigned || c.TLS.CertFile != "" || c.TLS.SelfSignedDir != "", "tls.selfSignedDir", "must not be empty")
+	check(c.History.Resolution.Std() >= 100*time.Millisecond, "history.resolution", "must be at least 100ms")
+	check(c.History.Retention >= c.History.Resolution, "history.retention", "must not be shorter than history.resolution")
+	check(c.Storage.RawRetention >= c.History.Resolution, "storage.rawRetention", "must not be shorter than history.resolution")
+	check(c.Storage.MinuteRetention.Std() >= time.Minute, "storage.minuteRetention", "must be at least 1m")
+	check(c.Storage.HourRetention.Std() >= time.Hour, "storage.hourRetention", "must be at least 1h")
+	check(c.Disk.MaxMountDepth > 0, "disk.maxMountDepth", "must be positive")
+	check(c.WS.PingInterval < c.WS.PongTimeout, "ws.pingInterval", "must be shorter than ws.pongTimeout")
+	check((c.Metrics.User == "") == (c.Metrics.Password == ""), "metrics.user", "metrics.user and metrics.password must be set together")
+	files := map[string]string{
+		"alerts.rulesFile":  c.Alerts.RulesFile,
+		"notify.configFile": c.Notify.ConfigFile,
+		"tls.certFile":      c.TLS.CertFile,
+		"tls.keyFile":       c.TLS.KeyFile,
+		"tls.clientCAFile":  c.TLS.ClientCAFile,
+	}
+	for key, file := range files {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(err == nil, key, "%v", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// forwardedHeaders 支持的客户端地址请求头
+var forwardedHeaders = []string{"X-Forwarded-For", "Forwarded", "X-Real-IP"}
+
+// clientCertPermissions 客户端证书可以授予的角色和权限范围，与 auth 包一致
+var clientCertPermissions = []string{"viewer", "admin", "metrics:read", "processes:read"}
+
+// isClientCertRule 是否为 <名称>=<权限>[+<权限>] 形式的客户端证书规则
+func isClientCertRule(rule string) bool {
+	name, perms, ok := strings.Cut(rule, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for _, perm := range strings.Split(perms, "+") {
+		if !slices.Contains(clientCertPermissions, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// isCIDR 是否为 CIDR 或单个 IP
+func isCIDR(raw string) bool {
+	if _, err := netip.ParsePrefix(raw); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(raw)
+	return err == nil
+}
+
+// Print 以 YAML 格式输出配置，敏感字段打码
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+	for _, f := range fields(&masked) {
+		if !f.secret {
+			continue
+		}
+		switch v := f.value.Interface().(type) {
+		case string:
+			if v != "" {
+				f.value.SetString(secretMask)
+			}
+		case []string:
+			list := make([]string, len(v))
+			for i := range list {
+				list[i] = secretMask
+			}
+			f.value.Set(reflect.ValueOf(list))
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func formatValue(v reflect.Value) (string, error) {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+	if list, ok := v.Interface().([]string); ok {
+		return strings.Join(list, ","), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// 默认值 < 配置文件 < 环境变量 < 命令行参数
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv("HOSTSTAT_CONFIG", "")
+	file := writeConfig(t, "hoststat.yaml", `
+server:
+  addr: ":9000"
+  readTimeout: 20s
+  writeTimeout: 30s
+`)
+	t.Setenv("HOSTSTAT_SERVER_ADDR", ":9100")
+	t.Setenv("HOSTSTAT_SERVER_READ_TIMEOUT", "40s")
+	flags, err := ParseFlags("hoststat", []string{"--config", file, "--server.addr", ":9200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		key       string
+		got, want any
+	}{
+		{"server.addr", cfg.Server.Addr, ":9200"},
+		{"server.readTimeout", cfg.Server.ReadTimeout, Duration(40 * time.Second)},
+		{"server.writeTimeout", cfg.Server.WriteTimeout, Duration(30 * time.Second)},
+		{"server.idleTimeout", cfg.Server.IdleTimeout, Default().Server.IdleTimeout},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s = %v, want %v", tc.key, tc.got, tc.want)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	t.Setenv("HOSTSTAT_CONFIG", "")
+	for name, content := range map[string]string{
+		"hoststat.yaml": "server:\n  adr: \":9000\"\n",
+		"hoststat.toml": "[server]\nadr = \":9000\"\n",
+		"hoststat.json": `{"server": {"adr": ":9000"}}`,
+	} {
+		flags, err := ParseFlags("hoststat", []string{"--config", writeConfig(t, name, content)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(flags); err == nil || !strings.Contains(err.Error(), "adr") {
+			t.Errorf("%s: error = %v, want unknown key adr", name, err)
+		}
+	}
+}
+
+func TestValidateCrossFieldChecks(t *testing.T) {
+	for _, tc := range []struct {
+		key  string
+		edit func(c *Config)
+	}{
+		{"tls.certFile", func(c *Config) { c.TLS.KeyFile = "key.pem" }},
+		{"tls.clientCAFile", func(c *Config) { c.TLS.ClientAuth = "require" }},
+		{"history.retention", func(c *Config) { c.History.Retention = c.History.Resolution / 2 }},
+		{"storage.rawRetention", func(c *Config) { c.Storage.RawRetention = c.History.Resolution / 2 }},
+		{"ws.pingInterval", func(c *Config) { c.WS.PingInterval = c.WS.PongTimeout }},
+		{"metrics.user", func(c *Config) { c.Metrics.User = "prometheus" }},
+		{"metrics.anonymous", func(c *Config) { c.Metrics.Anonymous, c.Metrics.Token = true, "secret" }},
+		{"rateLimit.burst", func(c *Config) { c.RateLimit.Rate, c.RateLimit.Burst = 10, 0 }},
+		{"audit.maxBackups", func(c *Config) { c.Audit.MaxSize, c.Audit.MaxBackups = 1<<20, 0 }},
+		{"oidc.clientId", func(c *Config) { c.OIDC.Issuer, c.OIDC.ViewerGroups = "https://idp.example.com", []string{"ops"} }},
+	} {
+		cfg := Default()
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("default config: %v", err)
+		}
+		tc.edit(cfg)
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), tc.key+":") {
+			t.Errorf("%s: error = %v", tc.key, err)
+		}
+	}
+}
+
+func TestSizeUnmarshalText(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want Size
+		ok   bool
+	}{
+		{"512", 512, true},
+		{"10MB", 10 << 20, true},
+		{"10 MiB", 10 << 20, true},
+		{"8388607TB", 8388607 << 40, true},
+		{"8388608TB", 0, false},
+		{"9223372036854775807KB", 0, false},
+		{"-1KB", 0, false},
+		{"ten", 0, false},
+	} {
+		var s Size
+		err := s.UnmarshalText([]byte(tc.text))
+		if (err == nil) != tc.ok || s != tc.want {
+			t.Errorf("%q = %d (err %v), want %d ok %v", tc.text, s, err, tc.want, tc.ok)
+		}
+	}
+}
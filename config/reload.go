@@ -0,0 +1,41 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// restartSections 这些分组只在启动时读取一次（监听地址、TLS、历史缓冲区、磁盘存储），修改后需要重启才能生效
+// 证书文件的内容变化由 certs 包自动重新加载，不需要重启
+var restartSections = []string{"server", "tls", "history", "storage"}
+
+// Diff 返回两份配置中取值不同的字段路径，如 net.exclude
+func Diff(old, cur *Config) []string {
+	oldFields, curFields := fields(old), fields(cur)
+	var changed []string
+	for i, f := range curFields {
+		if !reflect.DeepEqual(oldFields[i].value.Interface(), f.value.Interface()) {
+			changed = append(changed, f.key)
+		}
+	}
+	return changed
+}
+
+// KeepStartupValues 将需要重启才能生效的字段恢复为 old 中的值，返回被恢复的字段路径
+// 这样 Get() 返回的始终是实际生效的配置
+func (c *Config) KeepStartupValues(old *Config) []string {
+	oldFields := fields(old)
+	var kept []string
+	for i, f := range fields(c) {
+		section, _, _ := strings.Cut(f.key, ".")
+		if !slices.Contains(restartSections, section) {
+			continue
+		}
+		if !reflect.DeepEqual(oldFields[i].value.Interface(), f.value.Interface()) {
+			f.value.Set(oldFields[i].value)
+			kept = append(kept, f.key)
+		}
+	}
+	return kept
+}
@@ -3,8 +3,13 @@ module chihqiang/hoststat
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/chihqiang/logx v0.0.0-20251218085236-fa4e219d0ac9
+	github.com/gorilla/websocket v1.5.3
 	github.com/shirou/gopsutil/v4 v4.25.11
+	golang.org/x/crypto v0.45.0
+	golang.org/x/term v0.37.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
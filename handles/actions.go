@@ -0,0 +1,297 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+const maxActionBodyBytes = 4096
+
+// actionRequest 进程操作请求体；confirm 为空时只返回确认令牌，不执行操作
+type actionRequest struct {
+	Signal  string `json:"signal,omitempty"` // TERM、KILL、HUP、STOP、CONT
+	Nice    *int   `json:"nice,omitempty"`   // -20 ~ 19
+	Class   string `json:"class,omitempty"`  // ionice 调度类：realtime、best-effort、idle
+	Level   *int   `json:"level,omitempty"`  // ionice 优先级 0 ~ 7，idle 类不需要
+	Confirm string `json:"confirm,omitempty"`
+}
+
+type actionResponse struct {
+	Status       string     `json:"status"` // confirm：需要携带 confirmToken 再次提交；done：已执行
+	Action       string     `json:"action"`
+	Pid          int32      `json:"pid"`
+	Name         string     `json:"name"`
+	Exe          string     `json:"exe"`
+	User         string     `json:"user"`
+	Params       string     `json:"params"`
+	ConfirmToken string     `json:"confirmToken,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+// processAction 一种进程操作：validate 校验参数并返回用于审计和确认绑定的描述，run 执行操作
+type processAction struct {
+	name     string
+	validate func(req *actionRequest) (string, error)
+	run      func(pid int32, req *actionRequest) error
+}
+
+var processActions = map[string]processAction{
+	"signal": {
+		name: "signal",
+		validate: func(req *actionRequest) (string, error) {
+			req.Signal = strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG")
+			if !isProcessSignal(req.Signal) {
+				return "", errors.New("invalid signal, expected one of TERM, KILL, HUP, STOP, CONT")
+			}
+			return "signal=" + req.Signal, nil
+		},
+		run: func(pid int32, req *actionRequest) error { return sendProcessSignal(pid, req.Signal) },
+	},
+	"renice": {
+		name: "renice",
+		validate: func(req *actionRequest) (string, error) {
+			if req.Nice == nil || *req.Nice < -20 || *req.Nice > 19 {
+				return "", errors.New("invalid nice, expected -20 ~ 19")
+			}
+			return "nice=" + strconv.Itoa(*req.Nice), nil
+		},
+		run: func(pid int32, req *actionRequest) error { return setProcessNice(pid, *req.Nice) },
+	},
+	"ionice": {
+		name: "ionice",
+		validate: func(req *actionRequest) (string, error) {
+			switch req.Class {
+			case "idle":
+				req.Level = nil
+				return "class=idle", nil
+			case "realtime", "best-effort":
+				if req.Level == nil || *req.Level < 0 || *req.Level > 7 {
+					return "", errors.New("invalid level, expected 0 ~ 7")
+				}
+				return fmt.Sprintf("class=%s level=%d", req.Class, *req.Level), nil
+			}
+			return "", errors.New("invalid class, expected realtime, best-effort or idle")
+		},
+		run: func(pid int32, req *actionRequest) error {
+			level := 0
+			if req.Level != nil {
+				level = *req.Level
+			}
+			return setProcessIOPriority(pid, req.Class, level)
+		},
+	},
+}
+
+// actionConfirmations 已签发、尚未使用的确认令牌，令牌与调用方、操作、进程（含启动时间）和参数绑定，只能使用一次
+type actionConfirmations struct {
+	mu      sync.Mutex
+	pending map[string]pendingAction
+}
+
+type pendingAction struct {
+	binding string
+	expires time.Time
+}
+
+var confirmations = &actionConfirmations{pending: make(map[string]pendingAction)}
+
+func (c *actionConfirmations) issue(binding string, now time.Time) (string, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for token, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, token)
+		}
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	token := hex.EncodeToString(b)
+	expires := now.Add(config.Get().Actions.ConfirmTTL.Std())
+	c.pending[token] = pendingAction{binding: binding, expires: expires}
+	return token, expires
+}
+
+func (c *actionConfirmations) consume(token, binding string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[token]
+	if !ok {
+		return false
+	}
+	delete(c.pending, token)
+	return p.binding == binding && !now.After(p.expires)
+}
+
+// HandlerProcessAction 进程操作：POST /processes/{pid}/signal|renice|ionice
+// 首次提交返回确认令牌，携带 confirm 再次提交后才执行；每次请求都会记录审计日志
+func HandlerProcessAction(name string) http.HandlerFunc {
+	action := processActions[name]
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkAdmin(w, r) {
+			auditAction(r, action.name, nil, "", "unauthorized", nil)
+			return
+		}
+
+		pid, err := strconv.ParseInt(r.PathValue("pid"), 10, 32)
+		if err != nil || pid <= 0 {
+			http.Error(w, "invalid pid", http.StatusBadRequest)
+			return
+		}
+		var req actionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxActionBodyBytes)).Decode(&req); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		params, err := action.validate(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, err := process.NewProcess(int32(pid))
+		if err != nil {
+			http.Error(w, "process not found", http.StatusNotFound)
+			return
+		}
+		target, ok := loadProcessRow(p)
+		if !ok {
+			http.Error(w, "process not found", http.StatusNotFound)
+			return
+		}
+		// 进程名可以由进程自己修改，允许列表匹配内核解析出的可执行文件路径；读取失败（内核线程、权限不足）时为空
+		exe, _ := p.Exe()
+		if err := actionAllowed(&target, exe); err != nil {
+			auditAction(r, action.name, &target, params, "denied", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		now := time.Now()
+		binding := actionBinding(caller(r), action.name, &target, params)
+		resp := actionResponse{Action: action.name, Pid: target.Pid, Name: target.Name, Exe: exe, User: target.User, Params: params}
+		if req.Confirm == "" {
+			token, expires := confirmations.issue(binding, now)
+			resp.Status, resp.ConfirmToken, resp.ExpiresAt = "confirm", token, &expires
+			auditAction(r, action.name, &target, params, "confirm-issued", nil)
+			writeActionResponse(w, r, http.StatusAccepted, resp)
+			return
+		}
+		if !confirmations.consume(req.Confirm, binding, now) {
+			auditAction(r, action.name, &target, params, "confirm-rejected", nil)
+			http.Error(w, "invalid or expired confirmation token", http.StatusConflict)
+			return
+		}
+		if err := action.run(target.Pid, &req); err != nil {
+			auditAction(r, action.name, &target, params, "failed", err)
+			http.Error(w, "action failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		auditAction(r, action.name, &target, params, "done", nil)
+		resp.Status = "done"
+		writeActionResponse(w, r, http.StatusOK, resp)
+	}
+}
+
+// checkAdmin 校验管理权限，失败时写入错误响应：
+// 受权限范围限制的调用方（API Key、客户端证书、单点登录用户）需要 admin 权限；
+// API Key 与客户端证书是机器凭据，拥有 admin 权限即可，页面会话（本地用户、单点登录的 admin、匿名会话）
+// 都还需要携带 Authorization: Bearer <actions.adminToken>，未配置管理令牌时不能进行管理操作
+func checkAdmin(w http.ResponseWriter, r *http.Request) bool {
+	id := auth.IdentityFrom(r)
+	if id != nil && id.Restricted() && !id.Allows(auth.ScopeAdmin) {
+		http.Error(w, "Admin scope required", http.StatusForbidden)
+		return false
+	}
+	if id != nil && (id.Kind == auth.KindAPIKey || id.Kind == auth.KindCert) {
+		return true
+	}
+	admin := config.Get().Actions.AdminToken
+	if admin == "" {
+		http.Error(w, "Admin operations are disabled", http.StatusForbidden)
+		return false
+	}
+	if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); !ok || !secureEqual(got, admin) {
+		http.Error(w, "Admin token required", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// actionAllowed 检查进程是否在允许列表中：属主匹配 actions.allowUsers、可执行文件路径匹配 actions.allowExecutables（glob），
+// 两者都未配置时拒绝；init、kthreadd 及其内核线程和 hoststat 自身始终禁止操作
+func actionAllowed(target *ProcessRow, exe string) error {
+	cfg := config.Get().Actions
+	switch {
+	case target.Pid == 1 || target.Pid == kthreaddPid || target.Ppid == kthreaddPid:
+		return errors.New("system process cannot be touched")
+	case target.Pid == int32(os.Getpid()):
+		return errors.New("hoststat itself cannot be touched")
+	case len(cfg.AllowUsers) == 0 && len(cfg.AllowExecutables) == 0:
+		return errors.New("no process is allowed, configure actions.allowUsers or actions.allowExecutables")
+	case len(cfg.AllowUsers) > 0 && !matchAny(cfg.AllowUsers, target.User):
+		return fmt.Errorf("user %q is not allowed", target.User)
+	case len(cfg.AllowExecutables) > 0 && exe == "":
+		return errors.New("executable path cannot be resolved")
+	case len(cfg.AllowExecutables) > 0 && !matchAny(cfg.AllowExecutables, exe):
+		return fmt.Errorf("executable %q is not allowed", exe)
+	}
+	return nil
+}
+
+// actionBinding 确认令牌绑定的内容；包含调用方，其他用户或 API Key 不能使用；包含启动时间，pid 被复用后令牌失效
+func actionBinding(caller, action string, target *ProcessRow, params string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%d|%s", caller, action, target.Pid, target.StartTime, params)))
+	return hex.EncodeToString(sum[:])
+}
+
+func auditAction(r *http.Request, action string, target *ProcessRow, params, result string, err error) {
+	var pid int32
+	var name, user string
+	if target != nil {
+		pid, name, user = target.Pid, target.Name, target.User
+	}
+	logx.Info(
+		"[AUDIT] Process action | remote_ip: %s | caller: %s | action: %s | pid: %d | name: %s | user: %s | params: %s | result: %s | error: %v",
+		ClientIP(r), caller(r), action, pid, name, user, params, result, err,
+	)
+	details := map[string]any{"result": result}
+	if target != nil {
+		details["pid"], details["name"], details["user"], details["params"] = pid, name, user, params
+	}
+	recordAudit(r, "process."+action, actionOutcome(result), "", err, details)
+}
+
+// actionOutcome 执行成功或签发确认令牌为 success，执行出错为 failure，其余（未授权、不允许、确认令牌无效）为 denied
+func actionOutcome(result string) string {
+	switch result {
+	case "done", "confirm-issued":
+		return audit.OutcomeSuccess
+	case "failed":
+		return audit.OutcomeFailure
+	}
+	return audit.OutcomeDenied
+}
+
+func writeActionResponse(w http.ResponseWriter, r *http.Request, status int, resp actionResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logx.Error("Failed to encode action response JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
@@ -0,0 +1,46 @@
+package handles
+
+import (
+	"syscall"
+)
+
+var processSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"HUP":  syscall.SIGHUP,
+	"STOP": syscall.SIGSTOP,
+	"CONT": syscall.SIGCONT,
+}
+
+// ioprio_set 的调度类，见 linux/ioprio.h
+var ioPriorityClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+func isProcessSignal(name string) bool {
+	_, ok := processSignals[name]
+	return ok
+}
+
+func sendProcessSignal(pid int32, name string) error {
+	return syscall.Kill(int(pid), processSignals[name])
+}
+
+func setProcessNice(pid int32, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, int(pid), nice)
+}
+
+func setProcessIOPriority(pid int32, class string, level int) error {
+	prio := ioPriorityClasses[class]<<ioprioClassShift | level
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(prio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
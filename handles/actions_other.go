@@ -0,0 +1,25 @@
+//go:build !linux
+
+package handles
+
+import "errors"
+
+func isProcessSignal(name string) bool {
+	switch name {
+	case "TERM", "KILL", "HUP", "STOP", "CONT":
+		return true
+	}
+	return false
+}
+
+func sendProcessSignal(pid int32, name string) error {
+	return errors.ErrUnsupported
+}
+
+func setProcessNice(pid int32, nice int) error {
+	return errors.ErrUnsupported
+}
+
+func setProcessIOPriority(pid int32, class string, level int) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,129 @@
+package handles
+
+import (
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+func TestActionAllowed(t *testing.T) {
+	self := int32(os.Getpid())
+	tests := []struct {
+		name   string
+		users  []string
+		exes   []string
+		target ProcessRow
+		exe    string
+		want   string
+	}{
+		{"init", []string{"*"}, nil, ProcessRow{Pid: 1, User: "root"}, "/sbin/init", "system process"},
+		{"kernel thread", []string{"*"}, nil, ProcessRow{Pid: 300, Ppid: kthreaddPid, User: "root"}, "", "system process"},
+		{"hoststat itself", []string{"*"}, nil, ProcessRow{Pid: self, User: "root"}, "/usr/bin/hoststat", "hoststat itself"},
+		{"nothing configured", nil, nil, ProcessRow{Pid: 300, User: "app"}, "/usr/bin/app", "no process is allowed"},
+		{"user not allowed", []string{"app"}, nil, ProcessRow{Pid: 300, User: "root"}, "/usr/bin/app", `user "root" is not allowed`},
+		{"user allowed", []string{"app"}, nil, ProcessRow{Pid: 300, User: "app"}, "/usr/bin/app", ""},
+		{"unresolved executable", nil, []string{"/usr/bin/*"}, ProcessRow{Pid: 300, User: "app", Name: "app"}, "", "cannot be resolved"},
+		{"renamed process", nil, []string{"/usr/bin/app"}, ProcessRow{Pid: 300, User: "app", Name: "app"}, "/tmp/evil", `executable "/tmp/evil" is not allowed`},
+		{"executable glob", nil, []string{"/usr/bin/*"}, ProcessRow{Pid: 300, User: "app"}, "/usr/bin/app", ""},
+		{"both must match", []string{"app"}, []string{"/usr/bin/*"}, ProcessRow{Pid: 300, User: "app"}, "/opt/app", "is not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, func(cfg *config.Config) {
+				cfg.Actions.AllowUsers = tt.users
+				cfg.Actions.AllowExecutables = tt.exes
+			})
+			err := actionAllowed(&tt.target, tt.exe)
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// startTarget 启动一个属于当前用户的子进程作为操作目标
+func startTarget(t *testing.T) int {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("process actions are only supported on linux")
+	}
+	path, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not found")
+	}
+	cmd := exec.Command(path, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	return cmd.Process.Pid
+}
+
+func postAction(t *testing.T, pid int, apiKey, body string) (*httptest.ResponseRecorder, actionResponse) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/processes/"+strconv.Itoa(pid)+"/signal", strings.NewReader(body))
+	r.SetPathValue("pid", strconv.Itoa(pid))
+	r = auth.WithIdentity(r, &auth.Identity{Kind: auth.KindAPIKey, Name: apiKey, Scopes: []string{auth.ScopeAdmin}})
+	w := httptest.NewRecorder()
+	HandlerProcessAction("signal")(w, r)
+	var resp actionResponse
+	if w.Code == http.StatusOK || w.Code == http.StatusAccepted {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, resp
+}
+
+// 确认令牌只能由签发时的调用方使用一次，参数变化后失效
+func TestProcessActionConfirmFlow(t *testing.T) {
+	pid := startTarget(t)
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, ok := loadProcessRow(p)
+	if !ok {
+		t.Fatal("target process not found")
+	}
+	useConfig(t, func(cfg *config.Config) { cfg.Actions.AllowUsers = []string{target.User} })
+	const cont = `{"signal":"CONT"}`
+	confirm := func(token, signal string) string {
+		return `{"signal":"` + signal + `","confirm":"` + token + `"}`
+	}
+
+	w, issued := postAction(t, pid, "k1", cont)
+	if w.Code != http.StatusAccepted || issued.Status != "confirm" || issued.ConfirmToken == "" {
+		t.Fatalf("first submit: status %d, response %+v, want 202 with a token", w.Code, issued)
+	}
+	if w, _ := postAction(t, pid, "k2", confirm(issued.ConfirmToken, "CONT")); w.Code != http.StatusConflict {
+		t.Fatalf("token replayed by another API key: status %d, want 409", w.Code)
+	}
+
+	_, issued = postAction(t, pid, "k1", cont)
+	if w, _ := postAction(t, pid, "k1", confirm(issued.ConfirmToken, "STOP")); w.Code != http.StatusConflict {
+		t.Fatalf("token used with other params: status %d, want 409", w.Code)
+	}
+
+	_, issued = postAction(t, pid, "k1", cont)
+	w, done := postAction(t, pid, "k1", confirm(issued.ConfirmToken, "CONT"))
+	if w.Code != http.StatusOK || done.Status != "done" {
+		t.Fatalf("confirmed action: status %d, response %+v, want 200 done", w.Code, done)
+	}
+	if w, _ := postAction(t, pid, "k1", confirm(issued.ConfirmToken, "CONT")); w.Code != http.StatusConflict {
+		t.Fatalf("token reused: status %d, want 409", w.Code)
+	}
+}
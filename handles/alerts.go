@@ -0,0 +1,141 @@
+package handles
+
+import (
+	"chihqiang/hoststat/alert"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/notify"
+	"chihqiang/hoststat/psutil"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/chihqiang/logx"
+)
+
+var (
+	alerts   = alert.NewEngine(nil)
+	notifier atomic.Pointer[notify.Notifier]
+
+	// notifierCtx 投递协程的父上下文；notifierStop 停止当前投递协程，notifierDone 在其退出后关闭，重新加载配置时使用
+	notifierCtx  context.Context
+	notifierStop context.CancelFunc
+	notifierDone chan struct{}
+)
+
+type AlertsResponse struct {
+	Active   []alert.Alert `json:"active"`
+	Resolved []alert.Alert `json:"resolved"`
+	Rules    []*alert.Rule `json:"rules"`
+}
+
+// loadAlertRules 从 alerts.rulesFile 指定的文件加载告警规则
+func loadAlertRules() error {
+	path := config.Get().Alerts.RulesFile
+	if path == "" {
+		return nil
+	}
+	rules, err := alert.LoadRules(path, knownField)
+	if err != nil {
+		return err
+	}
+	alerts.SetRules(rules)
+	logx.Info("Alert rules loaded | file: %s | rules: %d", path, len(rules))
+	return nil
+}
+
+// startNotifier 从 notify.configFile 指定的文件加载 Webhook 配置并启动投递协程
+func startNotifier(ctx context.Context) error {
+	notifierCtx = ctx
+	path := config.Get().Notify.ConfigFile
+	if path == "" {
+		return nil
+	}
+	cfg, err := notify.LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	n, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	runNotifier(n)
+	logx.Info("Alert notifier started | file: %s | targets: %d | pending: %d", path, len(cfg.Targets), n.Pending())
+	return nil
+}
+
+func newNotifier(cfg *notify.Config) (*notify.Notifier, error) {
+	hostname := ""
+	if hostInfo, err := psutil.HOST.GetHostInfo(false); err == nil {
+		hostname = hostInfo.Hostname
+	}
+	return notify.New(cfg, hostname)
+}
+
+// runNotifier 启动投递协程并替换当前的通知模块
+func runNotifier(n *notify.Notifier) {
+	ctx, cancel := context.WithCancel(notifierCtx)
+	done := make(chan struct{})
+	notifierStop, notifierDone = cancel, done
+	notifier.Store(n)
+	sampler.wg.Add(1)
+	go func() {
+		defer sampler.wg.Done()
+		defer close(done)
+		n.Run(ctx)
+	}()
+}
+
+// replaceNotifier 停止当前的投递协程并等待正在进行的投递结束，再把等待合并的告警交给 next 并启动；
+// next 为空时只停止，发件箱中未投递的消息保留在磁盘上
+func replaceNotifier(next *notify.Notifier) {
+	if current := notifier.Load(); current != nil {
+		if notifierStop != nil {
+			notifierStop()
+			<-notifierDone
+			notifierStop, notifierDone = nil, nil
+		}
+		current.Handover(next)
+	}
+	if next == nil {
+		notifier.Store(nil)
+		return
+	}
+	runNotifier(next)
+}
+
+// evaluateAlerts 每次采样后评估告警规则，记录状态变化并交给通知模块
+func evaluateAlerts(info *CurrentInfo, fields map[string]float64) {
+	events := alerts.Evaluate(info.ShotTime, fields)
+	if n := notifier.Load(); n != nil && len(events) > 0 {
+		n.Notify(events)
+	}
+	for _, event := range events {
+		a := event.Alert
+		switch a.State {
+		case alert.StateFiring:
+			logx.Warn("[ALERT] Firing | rule: %s | instance: %s | severity: %s | value: %.2f | summary: %s", a.Rule, a.Instance, a.Severity, a.Value, a.Summary)
+		case alert.StateResolved:
+			logx.Info("[ALERT] Resolved | rule: %s | instance: %s | value: %.2f", a.Rule, a.Instance, a.Value)
+		default:
+			logx.Debug("[ALERT] Pending | rule: %s | instance: %s | value: %.2f", a.Rule, a.Instance, a.Value)
+		}
+	}
+}
+
+func HandlerAlerts(w http.ResponseWriter, r *http.Request) {
+	resp := AlertsResponse{
+		Active:   alerts.Active(),
+		Resolved: alerts.Resolved(),
+		Rules:    alerts.Rules(),
+	}
+	if resp.Rules == nil {
+		resp.Rules = []*alert.Rule{}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logx.Error("Failed to encode alerts JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+		http.Error(w, "Failed to encode response data", http.StatusInternalServerError)
+	}
+}
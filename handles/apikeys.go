@@ -0,0 +1,80 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/token"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// bearerAPIKey 读取 Authorization: Bearer hsk_...；其他 Bearer 值（如页面携带的管理令牌）不视为 API Key
+func bearerAPIKey(r *http.Request) (string, bool) {
+	value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !auth.IsAPIKey(value) {
+		return "", false
+	}
+	return value, true
+}
+
+// authenticateAPIKey 校验 API Key 的有效期、来源地址和权限范围，失败时记录日志并返回不含原因的 401/403
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, value, scope string) (*auth.Identity, bool) {
+	key, err := auth.APIKEYS.Authenticate(value, ClientIP(r), time.Now())
+	status := http.StatusUnauthorized
+	var id *auth.Identity
+	if err == nil {
+		id = &auth.Identity{Kind: auth.KindAPIKey, Name: key.ID, Scopes: key.Scopes}
+		if !id.Allows(scope) {
+			err, status = fmt.Errorf("missing scope %s", scope), http.StatusForbidden
+		}
+	} else if errors.Is(err, auth.ErrSourceNotAllowed) {
+		status = http.StatusForbidden
+	}
+	if err != nil {
+		keyID, actor, outcome := "-", "", audit.OutcomeFailure
+		if key != nil {
+			keyID, actor = key.ID, auth.KindAPIKey+":"+key.ID
+		}
+		if status == http.StatusForbidden {
+			outcome = audit.OutcomeDenied
+		}
+		recordAudit(r, "apikey.rejected", outcome, actor, err, map[string]any{"scope": scope})
+		logx.Warn(
+			"[SECURITY] API key rejected | remote_ip: %s | path: %s | method: %s | key_id: %s | error: %v | timestamp: %s",
+			ClientIP(r),
+			r.URL.Path,
+			r.Method,
+			keyID,
+			err,
+			time.Now().Format("2006-01-02 15:04:05.000"),
+		)
+		// 具体原因（过期、来源地址、权限范围）只写入日志，避免向调用方泄露密钥状态
+		http.Error(w, http.StatusText(status), status)
+		return nil, false
+	}
+	if auditedKeyUses.due(key.ID+"|"+ClientIP(r), time.Now()) {
+		recordAudit(r, "apikey.use", audit.OutcomeSuccess, id.String(), nil, map[string]any{"name": key.Name})
+	}
+	return id, true
+}
+
+// sessionIdentity 页面会话对应的调用方：登录用户（单点登录用户带角色权限）或匿名会话
+func sessionIdentity(claims *token.Claims) *auth.Identity {
+	if claims.Subject != "" {
+		return &auth.Identity{Kind: auth.KindUser, Name: claims.Subject, Scopes: auth.RoleScopes(claims.Role)}
+	}
+	return &auth.Identity{Kind: auth.KindSession, Name: claims.SessionID}
+}
+
+// caller 审计日志中的调用方，未经过认证时为 -
+func caller(r *http.Request) string {
+	if id := auth.IdentityFrom(r); id != nil {
+		return id.String()
+	}
+	return "-"
+}
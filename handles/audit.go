@@ -0,0 +1,203 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	// apiKeyAuditInterval 同一 API Key 从同一地址的成功使用在该间隔内只记录一次，避免定时抓取占满审计日志
+	apiKeyAuditInterval = time.Hour
+	// failureAuditInterval 同一地址的同类认证失败在该间隔内只记录第一次，其余计数后汇总为一条记录
+	failureAuditInterval = time.Minute
+)
+
+// recordAudit 记录一条审计事件，客户端地址、User-Agent、请求方法和路径取自请求；actor 为空时使用请求上下文中的调用方
+func recordAudit(r *http.Request, action, outcome, actor string, err error, details map[string]any) {
+	if actor == "" && caller(r) != "-" {
+		actor = caller(r)
+	}
+	e := audit.Event{
+		Action:    action,
+		Outcome:   outcome,
+		Actor:     actor,
+		IP:        ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Details:   details,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	audit.LOG.Record(e)
+}
+
+// recordFailure 记录无效令牌、/metrics 认证失败等可由任意客户端反复触发的事件，按地址和操作聚合，避免占满审计日志
+func recordFailure(r *http.Request, action string, err error) {
+	e := audit.Event{
+		Time:      time.Now(),
+		Action:    action,
+		Outcome:   audit.OutcomeFailure,
+		IP:        ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	for _, e := range auditedFailures.add(e) {
+		audit.LOG.Record(e)
+	}
+}
+
+// failureWindow 一个聚合窗口：窗口内的第一条记录和之后被合并的次数
+type failureWindow struct {
+	first      audit.Event
+	last       time.Time
+	suppressed int
+}
+
+// failureEvents 按 <操作>|<地址> 聚合的认证失败
+type failureEvents struct {
+	mu      sync.Mutex
+	windows map[string]*failureWindow
+}
+
+var auditedFailures = &failureEvents{windows: make(map[string]*failureWindow)}
+
+// add 返回需要写入的记录：新窗口的第一条，以及已结束窗口中被合并事件的汇总（details.suppressed 为合并的次数）
+func (f *failureEvents) add(e audit.Event) []audit.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var events []audit.Event
+	for key, w := range f.windows {
+		if e.Time.Sub(w.first.Time) < failureAuditInterval {
+			continue
+		}
+		if w.suppressed > 0 {
+			events = append(events, failureSummary(w))
+		}
+		delete(f.windows, key)
+	}
+	key := e.Action + "|" + e.IP
+	if w, ok := f.windows[key]; ok {
+		w.suppressed++
+		w.last = e.Time
+		return events
+	}
+	f.windows[key] = &failureWindow{first: e, last: e.Time}
+	return append(events, e)
+}
+
+// FlushAudit 退出前写入尚未结束的聚合窗口的汇总
+func FlushAudit() {
+	auditedFailures.mu.Lock()
+	var events []audit.Event
+	for key, w := range auditedFailures.windows {
+		if w.suppressed > 0 {
+			events = append(events, failureSummary(w))
+		}
+		delete(auditedFailures.windows, key)
+	}
+	auditedFailures.mu.Unlock()
+	for _, e := range events {
+		audit.LOG.Record(e)
+	}
+}
+
+func failureSummary(w *failureWindow) audit.Event {
+	e := w.first
+	e.Time = w.last
+	e.Error = ""
+	e.Details = map[string]any{"suppressed": w.suppressed, "since": w.first.Time.Format(time.RFC3339)}
+	return e
+}
+
+// apiKeyUses 最近记录过的 API Key 使用，键为 <ID>|<地址>
+type apiKeyUses struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var auditedKeyUses = &apiKeyUses{seen: make(map[string]time.Time)}
+
+// due 距离上次记录超过 apiKeyAuditInterval 时返回 true 并更新记录时间
+func (u *apiKeyUses) due(key string, now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if last, ok := u.seen[key]; ok && now.Sub(last) < apiKeyAuditInterval {
+		return false
+	}
+	for k, last := range u.seen {
+		if now.Sub(last) >= apiKeyAuditInterval {
+			delete(u.seen, k)
+		}
+	}
+	u.seen[key] = now
+	return true
+}
+
+// HandlerAudit 查询审计日志：/audit?from=&to=&actor=&action=&outcome=&limit=
+// from/to 与 /history 相同，支持 Unix 秒、RFC3339 或相对当前时间的负时长（如 -24h）；结果按时间从新到旧排列
+func HandlerAudit(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r) {
+		recordAudit(r, "audit.query", audit.OutcomeDenied, "", nil, nil)
+		return
+	}
+	query := r.URL.Query()
+	now := time.Now()
+	from, err := parseHistoryTime(query.Get("from"), now, time.Time{})
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseHistoryTime(query.Get("to"), now, time.Time{})
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	events, err := audit.LOG.Query(audit.Filter{
+		Since:   from,
+		Until:   to,
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		Outcome: query.Get("outcome"),
+		Limit:   limit,
+	})
+	if errors.Is(err, audit.ErrDisabled) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logx.Error("Failed to query audit log | remote_ip: %s | error: %v", ClientIP(r), err)
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, "audit.query", audit.OutcomeSuccess, "", nil, map[string]any{"query": r.URL.RawQuery, "events": len(events)})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := json.NewEncoder(w).Encode(struct {
+		Events []audit.Event `json:"events"`
+	}{events}); err != nil {
+		logx.Error("Failed to encode audit JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
@@ -0,0 +1,36 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"testing"
+	"time"
+)
+
+// 同一地址的同类认证失败在窗口内只记录第一次，窗口结束后汇总被合并的次数
+func TestFailureEventsAggregatePerClient(t *testing.T) {
+	failures := &failureEvents{windows: make(map[string]*failureWindow)}
+	now := time.Now()
+	event := func(ip string, at time.Time) audit.Event {
+		return audit.Event{Time: at, Action: "token.invalid", Outcome: audit.OutcomeFailure, IP: ip}
+	}
+
+	if got := failures.add(event("192.0.2.1", now)); len(got) != 1 {
+		t.Fatalf("first failure: %d events, want 1", len(got))
+	}
+	for i := range 100 {
+		if got := failures.add(event("192.0.2.1", now.Add(time.Duration(i)*time.Millisecond))); len(got) != 0 {
+			t.Fatalf("repeated failure %d written: %v", i, got)
+		}
+	}
+	if got := failures.add(event("192.0.2.2", now)); len(got) != 1 || got[0].IP != "192.0.2.2" {
+		t.Fatalf("failure from another client: %v, want one event", got)
+	}
+
+	got := failures.add(event("192.0.2.1", now.Add(failureAuditInterval)))
+	if len(got) != 2 {
+		t.Fatalf("after the window: %d events, want summary and new failure", len(got))
+	}
+	if got[0].Details["suppressed"] != 100 || got[0].IP != "192.0.2.1" {
+		t.Fatalf("summary = %+v, want 100 suppressed failures from 192.0.2.1", got[0])
+	}
+}
@@ -0,0 +1,64 @@
+package handles
+
+import (
+	"chihqiang/hoststat/history"
+	"sync"
+	"sync/atomic"
+)
+
+// subscriber 一个实时数据订阅者；缓冲区满时丢弃旧快照只保留最新的，慢客户端不会阻塞采集
+type subscriber struct {
+	ch      chan history.Entry[*CurrentInfo]
+	dropped atomic.Uint64
+}
+
+// broadcaster 将采集器的每个新快照分发给所有订阅者
+type broadcaster struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+func (b *broadcaster) subscribe() *subscriber {
+	s := &subscriber{ch: make(chan history.Entry[*CurrentInfo], 1)}
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[*subscriber]struct{})
+	}
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+	return s
+}
+
+func (b *broadcaster) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	delete(b.subs, s)
+	b.mu.Unlock()
+}
+
+func (b *broadcaster) publish(entry history.Entry[*CurrentInfo]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		select {
+		case s.ch <- entry:
+			continue
+		default:
+		}
+		// 缓冲区已满：丢弃未读取的旧快照，换成最新的
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+		select {
+		case s.ch <- entry:
+		default:
+		}
+	}
+}
+
+func (b *broadcaster) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -0,0 +1,162 @@
+package handles
+
+import (
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chihqiang/logx"
+)
+
+// accessRules 解析后的 access 配置，重新加载配置后重新解析
+type accessRules struct {
+	source  *config.Config
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	proxies []netip.Prefix
+	header  string
+}
+
+var access atomic.Pointer[accessRules]
+
+func currentAccess() *accessRules {
+	cfg := config.Get()
+	if rules := access.Load(); rules != nil && rules.source == cfg {
+		return rules
+	}
+	rules := &accessRules{
+		source:  cfg,
+		allow:   parsePrefixes(cfg.Access.Allow),
+		deny:    parsePrefixes(cfg.Access.Deny),
+		proxies: parsePrefixes(cfg.Access.TrustedProxies),
+		header:  http.CanonicalHeaderKey(cfg.Access.ForwardedHeader),
+	}
+	access.Store(rules)
+	return rules
+}
+
+// parsePrefixes 配置已在加载时校验，无效项直接忽略
+func parsePrefixes(list []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, item := range list {
+		if prefix, err := auth.ParseCIDR(item); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	return slices.ContainsFunc(prefixes, func(p netip.Prefix) bool { return p.Contains(addr) })
+}
+
+// clientAddr 客户端地址：直接连接的对端是受信任的代理时，沿 access.forwardedHeader 从右向左跳过受信任的代理，
+// 取第一个不受信任的地址；对端不受信任时忽略请求头，防止伪造。无法解析的地址返回 false，不回退到代理地址
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	rules := currentAccess()
+	if !containsAddr(rules.proxies, addr) {
+		return addr, true
+	}
+	hops := forwardedFor(r.Header, rules.header)
+	for i := len(hops) - 1; i >= 0 && containsAddr(rules.proxies, addr); i-- {
+		hop, err := parseForwardedAddr(hops[i])
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop
+	}
+	return addr, true
+}
+
+// unknownClient 无法确定客户端地址时使用，这些请求共用同一个限流桶和登录失败计数
+const unknownClient = "unknown"
+
+// ClientIP 去掉端口的客户端地址，用于日志、登录失败统计、API Key 来源限制和限流
+func ClientIP(r *http.Request) string {
+	if addr, ok := clientAddr(r); ok {
+		return addr.String()
+	}
+	return unknownClient
+}
+
+// forwardedFor 代理链上的地址，从左到右依次为原始客户端和各级代理；只读取 header 指定的请求头，
+// 其他请求头可能由客户端伪造，一律忽略
+func forwardedFor(h http.Header, header string) []string {
+	var hops []string
+	for _, value := range h.Values(header) {
+		switch header {
+		case "Forwarded":
+			// RFC 7239：每个元素对应一跳，缺少 for= 的元素记为空地址，解析失败
+			for elem := range strings.SplitSeq(value, ",") {
+				hop := ""
+				for pair := range strings.SplitSeq(elem, ";") {
+					key, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+					if ok && strings.EqualFold(key, "for") {
+						hop = strings.Trim(v, `"`)
+					}
+				}
+				hops = append(hops, hop)
+			}
+		case "X-Real-Ip":
+			hops = append(hops, strings.TrimSpace(value))
+		default:
+			for hop := range strings.SplitSeq(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+	return hops
+}
+
+// parseForwardedAddr 解析 1.2.3.4、1.2.3.4:80、[::1]:80、[::1]；unknown、_hidden 等混淆标识返回错误
+func parseForwardedAddr(value string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	return addr.Unmap(), err
+}
+
+// allowClient 按 access.allow/access.deny 检查客户端地址，拒绝时记录日志并返回 403；deny 优先
+func allowClient(w http.ResponseWriter, r *http.Request) bool {
+	rules := currentAccess()
+	if len(rules.allow) == 0 && len(rules.deny) == 0 {
+		return true
+	}
+	addr, ok := clientAddr(r)
+	if ok && !containsAddr(rules.deny, addr) && (len(rules.allow) == 0 || containsAddr(rules.allow, addr)) {
+		return true
+	}
+	logx.Warn(
+		"[SECURITY] Client address denied | remote_ip: %s | peer: %s | path: %s | method: %s",
+		ClientIP(r),
+		r.RemoteAddr,
+		r.URL.Path,
+		r.Method,
+	)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+// AccessMiddleware 不经过 SecureMiddleware 的首页、登录、/ws 和 /metrics 同样按客户端地址限制访问，并在认证前按来源 IP 限流
+func AccessMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if allowClient(w, r) && allowRequest(w, r) {
+			next(w, r)
+		}
+	}
+}
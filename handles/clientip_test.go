@@ -0,0 +1,77 @@
+package handles
+
+import (
+	"chihqiang/hoststat/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer ignores headers", "X-Forwarded-For", "192.0.2.9:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.1", "Forwarded": "for=203.0.113.2"}, "192.0.2.9"},
+		{"spoofed Forwarded ignored when proxy sets X-Forwarded-For", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "198.51.100.7", "Forwarded": "for=203.0.113.2"}, "198.51.100.7"},
+		{"spoofed X-Forwarded-For ignored when proxy sets Forwarded", "Forwarded", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.1", "Forwarded": "for=198.51.100.7;proto=https"}, "198.51.100.7"},
+		{"only Forwarded from client", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"Forwarded": "for=203.0.113.2"}, "10.0.0.1"},
+		{"X-Real-IP", "X-Real-IP", "10.0.0.1:1234",
+			map[string]string{"X-Real-IP": "198.51.100.7", "X-Forwarded-For": "203.0.113.1"}, "198.51.100.7"},
+		{"leftmost spoofed hop", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "203.0.113.1, 198.51.100.7"}, "198.51.100.7"},
+		{"trusted intermediate proxies skipped", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.2, 10.0.0.3"}, "198.51.100.7"},
+		{"Forwarded IPv6 with port", "Forwarded", "10.0.0.1:1234",
+			map[string]string{"Forwarded": `for="[2001:db8::1]:4711", for=10.0.0.2`}, "2001:db8::1"},
+		{"unknown hop", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "198.51.100.7, unknown"}, unknownClient},
+		{"obfuscated Forwarded hop", "Forwarded", "10.0.0.1:1234",
+			map[string]string{"Forwarded": "for=_hidden"}, unknownClient},
+		{"Forwarded element without for", "Forwarded", "10.0.0.1:1234",
+			map[string]string{"Forwarded": "for=198.51.100.7, proto=https"}, unknownClient},
+		{"garbage hop", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "not-an-ip"}, unknownClient},
+		{"unknown hop behind trusted proxy skipped", "X-Forwarded-For", "10.0.0.1:1234",
+			map[string]string{"X-Forwarded-For": "unknown, 198.51.100.7"}, "198.51.100.7"},
+		{"missing header", "X-Forwarded-For", "10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, func(cfg *config.Config) {
+				cfg.Access.TrustedProxies = []string{"10.0.0.0/8"}
+				cfg.Access.ForwardedHeader = tt.header
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.peer
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+			if got := ClientIP(r); got != tt.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 无法识别客户端地址时不回退到代理地址，设置了访问列表的请求直接拒绝
+func TestAllowClientDeniesUnknownHop(t *testing.T) {
+	useConfig(t, func(cfg *config.Config) {
+		cfg.Access.TrustedProxies = []string{"10.0.0.1"}
+		cfg.Access.Allow = []string{"10.0.0.0/8"}
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "unknown")
+	w := httptest.NewRecorder()
+	if allowClient(w, r) || w.Code != http.StatusForbidden {
+		t.Fatalf("unknown hop behind an allowed proxy: status = %d, want 403", w.Code)
+	}
+}
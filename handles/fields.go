@@ -0,0 +1,129 @@
+package handles
+
+import (
+	"chihqiang/hoststat/psutil"
+	"strconv"
+	"strings"
+)
+
+// Fields 将快照展开为 字段名->数值，字段名与JSON字段保持一致
+// 每核心、每个网卡、每个块设备与每个挂载点的数据分别使用
+// cpuPercent.<n>、net.<网卡>.<字段>、diskio.<设备>.<字段> 与 disk.<挂载点>.<字段> 形式
+func (c *CurrentInfo) Fields() map[string]float64 {
+	fields := map[string]float64{
+		"uptime":                float64(c.Uptime),
+		"procs":                 float64(c.Procs),
+		"cpuUsedPercent":        c.CPUUsedPercent,
+		"cpuUsed":               c.CPUUsed,
+		"cpuTotal":              float64(c.CPUTotal),
+		"cpuUser":               c.CPUDetailed.User,
+		"cpuSystem":             c.CPUDetailed.System,
+		"cpuNice":               c.CPUDetailed.Nice,
+		"cpuIdle":               c.CPUDetailed.Idle,
+		"cpuIowait":             c.CPUDetailed.Iowait,
+		"cpuIrq":                c.CPUDetailed.Irq,
+		"cpuSoftirq":            c.CPUDetailed.Softirq,
+		"cpuSteal":              c.CPUDetailed.Steal,
+		"cpuGuest":              c.CPUDetailed.Guest,
+		"cpuGuestNice":          c.CPUDetailed.GuestNice,
+		"load1":                 c.Load1,
+		"load5":                 c.Load5,
+		"load15":                c.Load15,
+		"loadUsagePercent":      c.LoadUsagePercent,
+		"memoryTotal":           float64(c.MemoryTotal),
+		"memoryUsed":            float64(c.MemoryUsed),
+		"memoryFree":            float64(c.MemoryFree),
+		"memoryShard":           float64(c.MemoryShard),
+		"memoryCache":           float64(c.MemoryCache),
+		"memoryAvailable":       float64(c.MemoryAvailable),
+		"memoryUsedPercent":     c.MemoryUsedPercent,
+		"swapMemoryTotal":       float64(c.SwapMemoryTotal),
+		"swapMemoryAvailable":   float64(c.SwapMemoryAvailable),
+		"swapMemoryUsed":        float64(c.SwapMemoryUsed),
+		"swapMemoryUsedPercent": c.SwapMemoryUsedPercent,
+		"ioReadBytes":           float64(c.IOReadBytes),
+		"ioWriteBytes":          float64(c.IOWriteBytes),
+		"ioCount":               float64(c.IOCount),
+		"ioReadTime":            float64(c.IOReadTime),
+		"ioWriteTime":           float64(c.IOWriteTime),
+		"netBytesSent":          float64(c.NetBytesSent),
+		"netBytesRecv":          float64(c.NetBytesRecv),
+		"netBytesSentRate":      c.NetBytesSentRate,
+		"netBytesRecvRate":      c.NetBytesRecvRate,
+	}
+	for i, percent := range c.CPUPercent {
+		fields["cpuPercent."+strconv.Itoa(i)] = percent
+	}
+	for _, iface := range c.NetInterfaces {
+		prefix := "net." + iface.Name + "."
+		fields[prefix+"bytesSentRate"] = iface.BytesSentRate
+		fields[prefix+"bytesRecvRate"] = iface.BytesRecvRate
+		fields[prefix+"packetsSentRate"] = iface.PacketsSentRate
+		fields[prefix+"packetsRecvRate"] = iface.PacketsRecvRate
+		fields[prefix+"errinRate"] = iface.ErrinRate
+		fields[prefix+"erroutRate"] = iface.ErroutRate
+		fields[prefix+"dropinRate"] = iface.DropinRate
+		fields[prefix+"dropoutRate"] = iface.DropoutRate
+	}
+	for _, d := range c.DiskIO {
+		prefix := "diskio." + d.Name + "."
+		fields[prefix+"readIops"] = d.ReadIOPS
+		fields[prefix+"writeIops"] = d.WriteIOPS
+		fields[prefix+"readBytesRate"] = d.ReadBytesRate
+		fields[prefix+"writeBytesRate"] = d.WriteBytesRate
+		fields[prefix+"readAwait"] = d.ReadAwait
+		fields[prefix+"writeAwait"] = d.WriteAwait
+		fields[prefix+"await"] = d.Await
+		fields[prefix+"utilPercent"] = d.UtilPercent
+		fields[prefix+"queueDepth"] = d.QueueDepth
+	}
+	for _, d := range c.DiskData {
+		prefix := "disk." + d.Path + "."
+		fields[prefix+"total"] = float64(d.Total)
+		fields[prefix+"free"] = float64(d.Free)
+		fields[prefix+"used"] = float64(d.Used)
+		fields[prefix+"usedPercent"] = d.UsedPercent
+		fields[prefix+"inodesUsedPercent"] = d.InodesUsedPercent
+	}
+	return fields
+}
+
+// fieldInstance 探测用的实例名，替换为 "*" 后得到按实例展开的字段模式
+const fieldInstance = "\x00"
+
+// staticFields 与 instanceFields 由 Fields 的输出推导，告警规则加载时据此检查字段名
+var staticFields, instanceFields = func() (map[string]struct{}, []string) {
+	probe := CurrentInfo{
+		CPUPercent:    []float64{0},
+		NetInterfaces: []psutil.NetInterfaceStat{{Name: fieldInstance}},
+		DiskIO:        []DiskIOInfo{{DiskIOStat: psutil.DiskIOStat{Name: fieldInstance}}},
+		DiskData:      []DiskInfo{{Path: fieldInstance}},
+	}
+	static := make(map[string]struct{})
+	var patterns []string
+	for name := range probe.Fields() {
+		switch {
+		case strings.Contains(name, fieldInstance):
+			patterns = append(patterns, name)
+		case strings.HasPrefix(name, "cpuPercent."):
+			patterns = append(patterns, "cpuPercent."+fieldInstance)
+		default:
+			static[name] = struct{}{}
+		}
+	}
+	return static, patterns
+}()
+
+// knownField 字段名是否由 Fields 产生；核心编号、网卡、设备与挂载点部分可以是任意非空值或通配符
+func knownField(name string) bool {
+	if _, ok := staticFields[name]; ok {
+		return true
+	}
+	for _, pattern := range instanceFields {
+		prefix, suffix, _ := strings.Cut(pattern, fieldInstance)
+		if len(name) > len(prefix)+len(suffix) && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package handles
+
+import "testing"
+
+func TestKnownField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"memoryUsedPercent", true},
+		{"cpuPercent.3", true},
+		{"cpuPercent.*", true},
+		{"disk.*.usedPercent", true},
+		{"disk./var/lib.inodesUsedPercent", true},
+		{"net.eth0.bytesRecvRate", true},
+		{"diskio.*.utilPercent", true},
+		{"memoryUsedPrecent", false},
+		{"disk..usedPercent", false},
+		{"disk.*.used_percent", false},
+		{"cpuPercent.", false},
+	}
+	for _, tt := range tests {
+		if got := knownField(tt.field); got != tt.want {
+			t.Errorf("knownField(%q) = %t, want %t", tt.field, got, tt.want)
+		}
+	}
+}
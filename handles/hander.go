@@ -1,76 +1,173 @@
 package handles
 
 import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/certs"
 	"chihqiang/hoststat/token"
 	"encoding/json"
 	"github.com/chihqiang/logx"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// route 需要认证的路由；API Key 需要拥有 scope 权限，每次请求按 cost 扣除调用方的令牌
+type route struct {
+	scope   string
+	cost    routeCost
+	handler http.HandlerFunc
+}
+
 func BusinessRoutes() {
-	routes := map[string]http.HandlerFunc{
-		"/base":       HandlerBase,
-		"/current":    HandlerCurrent,
-		"/top/cpu/ps": HandlerTopCpuPs,
-		"/top/mem/ps": HandlerTopMemPs,
+	routes := map[string]route{
+		"/base":            {auth.ScopeMetricsRead, costHeavy, HandlerBase},
+		"/current":         {auth.ScopeMetricsRead, costLight, HandlerCurrent},
+		"/history":         {auth.ScopeMetricsRead, costMedium, HandlerHistory},
+		"/alerts":          {auth.ScopeMetricsRead, costLight, HandlerAlerts},
+		"/stream":          {auth.ScopeMetricsRead, costLight, HandlerStream},
+		"/processes":       {auth.ScopeProcessesRead, costHeavy, HandlerProcesses},
+		"/processes/tree":  {auth.ScopeProcessesRead, costHeavy, HandlerProcessTree},
+		"/processes/{pid}": {auth.ScopeProcessesRead, costMedium, HandlerProcessDetail},
+		// 进程操作默认关闭，见 actions.go
+		"POST /processes/{pid}/signal": {auth.ScopeAdmin, costLight, HandlerProcessAction("signal")},
+		"POST /processes/{pid}/renice": {auth.ScopeAdmin, costLight, HandlerProcessAction("renice")},
+		"POST /processes/{pid}/ionice": {auth.ScopeAdmin, costLight, HandlerProcessAction("ionice")},
+		// 会话管理，需要管理令牌或 admin 权限的 API Key
+		"POST /sessions/rotate": {auth.ScopeAdmin, costLight, HandlerSessionRotate},
+		"POST /sessions/revoke": {auth.ScopeAdmin, costLight, HandlerSessionRevoke},
+		"/top/cpu/ps":           {auth.ScopeProcessesRead, costHeavy, HandlerTopCpuPs},
+		"/top/mem/ps":           {auth.ScopeProcessesRead, costHeavy, HandlerTopMemPs},
+		// 审计日志，需要管理令牌或 admin 权限
+		"/audit": {auth.ScopeAdmin, costHeavy, HandlerAudit},
 	}
-	for path, handler := range routes {
-		http.HandleFunc(path, SecureMiddleware(handler))
-		logx.Debug("Registered route | path: %s | handler: %T", path, handler)
+	for path, rt := range routes {
+		http.HandleFunc(path, SecureMiddleware(rt.scope, RateLimitMiddleware(rt.cost, rt.handler)))
+		logx.Debug("Registered route | path: %s | scope: %s | cost: %d", path, rt.scope, rt.cost.tokens)
 	}
+	// /ws 握手请求不带 Referer，在处理函数内单独校验 token
+	http.HandleFunc("/ws", AccessMiddleware(HandlerWS))
+	// /metrics 供Prometheus抓取，抓取端不会访问首页拿Cookie，因此使用独立认证
+	http.HandleFunc("/metrics", AccessMiddleware(MetricsAuthMiddleware(RateLimitMiddleware(costScrape, HandlerMetrics))))
 }
 
 // SecureMiddleware 安全中间件 - 检查Cookie确保只能从页面本身访问
-func SecureMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// 先按 access.allow/access.deny 检查客户端地址（位于受信任的代理之后时取自 access.forwardedHeader），不允许的地址返回 403；
+// 认证之前再按来源 IP 限流（rateLimit.ipRate），超出时返回 429
+// 存在本地用户或启用单点登录时，会话必须属于已登录的用户，未登录或会话失效返回 401；单点登录用户按角色限制权限
+// 机器客户端可以使用 API Key（Authorization: Bearer hsk_...，需要拥有 scope 权限），
+// 开启 mTLS 时持有受信任客户端证书的客户端同样无需 Cookie，权限由 auth.clientCerts 决定；调用方写入请求上下文，见 auth.IdentityFrom
+func SecureMiddleware(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowClient(w, r) || !allowRequest(w, r) {
+			return
+		}
 		// 处理OPTIONS请求
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
 			return
 		}
+		if id, ok := certIdentity(r); ok {
+			if !id.Allows(scope) {
+				denyScope(w, r, id, scope)
+				return
+			}
+			next(w, auth.WithIdentity(r, id))
+			return
+		}
+		if value, ok := bearerAPIKey(r); ok {
+			id, ok := authenticateAPIKey(w, r, value, scope)
+			if !ok {
+				return
+			}
+			next(w, auth.WithIdentity(r, id))
+			return
+		}
 		// 使用token包验证令牌
-		if err := token.ValidateToken(r); err != nil {
+		claims, err := token.ValidateToken(r)
+		if err == nil {
+			err = checkUser(claims)
+		}
+		if err != nil {
 			logx.Warn(
 				"[SECURITY] Token validation failed | remote_ip: %s | path: %s | method: %s | error: %v | timestamp: %s",
-				r.RemoteAddr,
+				ClientIP(r),
 				r.URL.Path,
 				r.Method,
 				err,
 				time.Now().Format("2006-01-02 15:04:05.000"),
 			)
+			recordFailure(r, "token.invalid", err)
+			// 带 Referer 的页面请求失败说明未登录或会话失效，返回 401 由页面跳转到登录页
+			if LoginRequired() && r.Header.Get("Referer") != "" {
+				http.Error(w, "Login required", http.StatusUnauthorized)
+				return
+			}
 			http.Error(w, "Token validation failed", http.StatusForbidden)
 			return
 		}
+		// 单点登录用户按角色限制权限
+		id := sessionIdentity(claims)
+		if !id.Allows(scope) {
+			logx.Warn("[SECURITY] Permission denied | remote_ip: %s | path: %s | caller: %s | role: %s | scope: %s", ClientIP(r), r.URL.Path, id, claims.Role, scope)
+			recordAudit(r, "permission.denied", audit.OutcomeDenied, id.String(), nil, map[string]any{"role": claims.Role, "scope": scope})
+			http.Error(w, "Permission denied", http.StatusForbidden)
+			return
+		}
 		// 继续处理请求
-		next(w, r)
+		next(w, auth.WithIdentity(r, id))
+	}
+}
+
+// certIdentity 按 auth.clientCerts 确定受信任客户端证书的身份；证书不在允许列表中时记录日志，
+// 返回 false 由调用方继续尝试其他认证方式
+func certIdentity(r *http.Request) (*auth.Identity, bool) {
+	names, ok := certs.VerifiedClient(r)
+	if !ok {
+		return nil, false
+	}
+	id, ok := auth.CertIdentity(names)
+	if !ok {
+		logx.Warn("[SECURITY] Client certificate not allowed | remote_ip: %s | path: %s | names: %s", ClientIP(r), r.URL.Path, strings.Join(names, ","))
+		return nil, false
 	}
+	logx.Debug("Client certificate accepted | remote_ip: %s | client: %s | path: %s", ClientIP(r), id.Name, r.URL.Path)
+	return id, true
+}
+
+// denyScope 调用方缺少 scope 权限时返回 403 并记录审计日志
+func denyScope(w http.ResponseWriter, r *http.Request, id *auth.Identity, scope string) {
+	logx.Warn("[SECURITY] Permission denied | remote_ip: %s | path: %s | caller: %s | scope: %s", ClientIP(r), r.URL.Path, id, scope)
+	recordAudit(r, "permission.denied", audit.OutcomeDenied, id.String(), nil, map[string]any{"scope": scope})
+	http.Error(w, "Permission denied", http.StatusForbidden)
 }
 
 func HandlerBase(w http.ResponseWriter, r *http.Request) {
 	info, err := getBaseInfo()
 	if err != nil {
-		logx.Error("get base info error: %v", err)
+		logx.Error("Failed to get base info | remote_ip: %s | error: %v", ClientIP(r), err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	if err := json.NewEncoder(w).Encode(info); err != nil {
-		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", r.RemoteAddr, err)
+		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", ClientIP(r), err)
 		http.Error(w, "Failed to encode response data", http.StatusInternalServerError)
 	}
 }
 
 func HandlerCurrent(w http.ResponseWriter, r *http.Request) {
-	info, err := getCurrentInfo()
+	info, err := sampler.current()
 	if err != nil {
-		logx.Error("Failed to get current info | remote_ip: %s | error: %v", r.RemoteAddr, err)
+		logx.Error("Failed to get current info | remote_ip: %s | error: %v", ClientIP(r), err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	if err := json.NewEncoder(w).Encode(info); err != nil {
-		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", r.RemoteAddr, err)
+		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", ClientIP(r), err)
 		http.Error(w, "Failed to encode response data", http.StatusInternalServerError)
 	}
 }
@@ -79,7 +176,7 @@ func HandlerTopCpuPs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	if err := json.NewEncoder(w).Encode(info); err != nil {
-		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", r.RemoteAddr, err)
+		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", ClientIP(r), err)
 		http.Error(w, "Failed to encode response data", http.StatusInternalServerError)
 	}
 }
@@ -88,7 +185,7 @@ func HandlerTopMemPs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	if err := json.NewEncoder(w).Encode(info); err != nil {
-		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", r.RemoteAddr, err)
+		logx.Error("Failed to encode current info JSON | remote_ip: %s | error: %v", ClientIP(r), err)
 		http.Error(w, "Failed to encode response data", http.StatusInternalServerError)
 	}
 }
@@ -0,0 +1,157 @@
+package handles
+
+import (
+	"chihqiang/hoststat/history"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// maxHistoryPoints 未指定 step 时，自动选择步长使每个序列不超过该点数
+const maxHistoryPoints = 300
+
+type HistoryResponse struct {
+	Source string           `json:"source"` // memory 或 storage
+	From   time.Time        `json:"from"`
+	To     time.Time        `json:"to"`
+	Step   string           `json:"step"`
+	Series []history.Series `json:"series"`
+}
+
+// HandlerHistory 查询历史数据：/history?from=&to=&step=&fields=
+// from/to 支持 Unix 秒、RFC3339 或相对当前时间的负时长（如 -15m）
+func HandlerHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	now := time.Now()
+
+	to, err := parseHistoryTime(query.Get("to"), now, now)
+	if err != nil {
+		http.Error(w, "invalid to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	oldest, ok := sampler.history.Oldest()
+	if !ok {
+		oldest = now
+	}
+	defaultFrom := oldest
+	if sampler.store != nil {
+		if stored, ok := sampler.store.Oldest(); ok && stored.Before(defaultFrom) {
+			defaultFrom = stored
+		}
+	}
+	from, err := parseHistoryTime(query.Get("from"), now, defaultFrom)
+	if err != nil {
+		http.Error(w, "invalid from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	step := autoHistoryStep(to.Sub(from), sampler.resolution)
+	if value := query.Get("step"); value != "" {
+		step, err = time.ParseDuration(value)
+		if err != nil || step <= 0 {
+			http.Error(w, "invalid step", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Sub(from)/step > 10*maxHistoryPoints {
+		http.Error(w, "step too small for requested range", http.StatusBadRequest)
+		return
+	}
+
+	resp := HistoryResponse{From: from, To: to, Step: step.String()}
+	// 内存缓冲区覆盖不到起始时间时，改从磁盘存储查询
+	if sampler.store != nil && from.Before(oldest) {
+		resp.Source = "storage"
+		resp.Series, err = sampler.store.Query(from, to, step, parseHistoryFields(query.Get("fields"), nil), maxHistoryPoints)
+		if err != nil {
+			logx.Error("Failed to query storage | remote_ip: %s | error: %v", ClientIP(r), err)
+			http.Error(w, "Failed to query history", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		entries := sampler.history.Range(from, to)
+		samples := make([]history.Sample, 0, len(entries))
+		for _, entry := range entries {
+			samples = append(samples, history.Sample{Time: entry.Time, Values: entry.Value.Fields()})
+		}
+		resp.Source = "memory"
+		resp.Series = history.Downsample(samples, from, to, step, parseHistoryFields(query.Get("fields"), samples))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logx.Error("Failed to encode history JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+		http.Error(w, "Failed to encode response data", http.StatusInternalServerError)
+	}
+}
+
+func parseHistoryTime(value string, now, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if strings.HasPrefix(value, "-") {
+		// 以 - 开头的只能是相对时间，负的 Unix 秒数与其他格式一样不支持 1970 年之前
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return time.Time{}, errors.New("expect unix seconds, RFC3339 or negative duration")
+		}
+		return now.Add(d), nil
+	}
+	var t time.Time
+	if sec, err := strconv.ParseFloat(value, 64); err == nil {
+		if math.IsNaN(sec) || math.IsInf(sec, 0) {
+			return time.Time{}, errors.New("expect unix seconds, RFC3339 or negative duration")
+		}
+		t = time.Unix(0, int64(sec*float64(time.Second)))
+	} else if t, err = time.Parse(time.RFC3339, value); err != nil {
+		return time.Time{}, errors.New("expect unix seconds, RFC3339 or negative duration")
+	}
+	if t.Before(time.Unix(0, 0)) {
+		return time.Time{}, errors.New("time before 1970-01-01 is not supported")
+	}
+	return t, nil
+}
+
+// autoHistoryStep 按范围自动选择步长，不小于采样分辨率
+func autoHistoryStep(span, resolution time.Duration) time.Duration {
+	step := span / maxHistoryPoints
+	if step < resolution {
+		return resolution
+	}
+	return step.Round(time.Second)
+}
+
+// parseHistoryFields 解析逗号分隔的字段列表，未指定时返回样本中出现的全部字段
+func parseHistoryFields(value string, samples []history.Sample) []string {
+	var fields []string
+	if value != "" {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" && !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+		return fields
+	}
+	seen := make(map[string]struct{})
+	for _, sample := range samples {
+		for field := range sample.Values {
+			if _, ok := seen[field]; !ok {
+				seen[field] = struct{}{}
+				fields = append(fields, field)
+			}
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
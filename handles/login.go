@@ -0,0 +1,191 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/token"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// errLoginRequired 需要登录但会话未登录
+var errLoginRequired = errors.New("login required")
+
+// loginTemplate 登录页，由 LoginRoutes 设置
+var loginTemplate *template.Template
+
+// loginPage 登录页模板数据
+type loginPage struct {
+	Username string
+	Error    string
+	Password bool // 存在本地用户，显示用户名密码表单
+	SSO      bool // 启用了单点登录，显示单点登录按钮
+}
+
+// LoginRoutes 注册登录、退出与单点登录路由
+func LoginRoutes(page *template.Template) {
+	loginTemplate = page
+	http.HandleFunc("/login", AccessMiddleware(HandlerLogin))
+	http.HandleFunc("POST /logout", AccessMiddleware(HandlerLogout))
+	http.HandleFunc("GET /oidc/login", AccessMiddleware(HandlerOIDCLogin))
+	http.HandleFunc("GET /oidc/callback", AccessMiddleware(HandlerOIDCCallback))
+}
+
+// LoginRequired 未开启 auth.anonymous、存在本地用户或启用了单点登录时，访问页面和接口需要登录
+func LoginRequired() bool {
+	return auth.USERS.Required() || config.Get().OIDC.Enabled()
+}
+
+// checkUser 需要登录时，会话必须属于已登录的用户：
+// 本地用户必须仍然存在，且会话签发后该用户没有修改过密码；单点登录的会话要求单点登录仍然启用、
+// 提供方与客户端ID未改变且未超过 oidc.sessionMaxAge
+func checkUser(claims *token.Claims) error {
+	if !LoginRequired() {
+		return nil
+	}
+	if claims.Subject == "" {
+		return errLoginRequired
+	}
+	if claims.Method == token.MethodOIDC {
+		cfg := config.Get().OIDC
+		switch {
+		case !cfg.Enabled():
+			return errors.New("single sign-on is disabled")
+		case claims.Issuer != strings.TrimSuffix(cfg.Issuer, "/") || claims.ClientID != cfg.ClientID:
+			return errors.New("single sign-on provider changed after session was issued")
+		case time.Since(time.Unix(claims.IssuedAt, 0)) > cfg.SessionMaxAge.Std():
+			return errors.New("single sign-on session exceeded oidc.sessionMaxAge")
+		}
+		return nil
+	}
+	return auth.USERS.CheckSession(claims.Subject, claims.PwdGen)
+}
+
+// EnsureSession 首页使用：需要登录而会话无效时跳转到 /login 并返回 false，否则返回当前用户名（匿名模式为空）
+func EnsureSession(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if !LoginRequired() {
+		token.SetToken(w, r, ClientIP(r))
+		return "", true
+	}
+	claims, err := token.Session(r)
+	if err == nil {
+		err = checkUser(claims)
+	}
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return "", false
+	}
+	return claims.Subject, true
+}
+
+// renderLogin 输出登录页
+func renderLogin(w http.ResponseWriter, r *http.Request, status int, data loginPage) {
+	data.Password = auth.USERS.Available()
+	data.SSO = config.Get().OIDC.Enabled()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := loginTemplate.Execute(w, data); err != nil {
+		logx.Error("Execute login template failed | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
+
+// HandlerLogin GET 显示登录页，POST 校验用户名和密码后签发会话并跳转到首页
+func HandlerLogin(w http.ResponseWriter, r *http.Request) {
+	if !LoginRequired() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if r.Method != http.MethodPost {
+		if claims, err := token.Session(r); err == nil && checkUser(claims) == nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		renderLogin(w, r, http.StatusOK, loginPage{})
+		return
+	}
+	if !auth.USERS.Available() {
+		renderLogin(w, r, http.StatusBadRequest, loginPage{Error: "未启用用户名密码登录"})
+		return
+	}
+	// 登录不依赖已有会话，要求同源以防止跨站提交
+	if err := token.SameOrigin(r); err != nil {
+		logx.Warn("[SECURITY] Login rejected | remote_ip: %s | error: %v", ClientIP(r), err)
+		recordAudit(r, "login", audit.OutcomeDenied, "", err, map[string]any{"method": token.MethodPassword})
+		http.Error(w, "Cross-origin login rejected", http.StatusForbidden)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4<<10)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	name, password := r.PostForm.Get("username"), r.PostForm.Get("password")
+	user, locked, err := auth.Authenticate(name, password, ClientIP(r), time.Now())
+	switch {
+	case errors.Is(err, auth.ErrLocked):
+		if locked {
+			logx.Warn("[SECURITY] Login locked out | remote_ip: %s | user: %s", ClientIP(r), name)
+			recordAudit(r, "login", audit.OutcomeDenied, auth.KindUser+":"+name, err, map[string]any{"method": token.MethodPassword, "locked": locked})
+		} else {
+			// 锁定期间客户端可以无限次提交，按地址聚合记录
+			logx.Warn("[SECURITY] Login attempt while locked out | remote_ip: %s | user: %s", ClientIP(r), name)
+			recordFailure(r, "login.locked", err)
+		}
+		renderLogin(w, r, http.StatusTooManyRequests, loginPage{Username: name, Error: "登录失败次数过多，请稍后再试"})
+		return
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		logx.Warn("[SECURITY] Login failed | remote_ip: %s | user: %s", ClientIP(r), name)
+		recordAudit(r, "login", audit.OutcomeFailure, auth.KindUser+":"+name, err, map[string]any{"method": token.MethodPassword})
+		renderLogin(w, r, http.StatusUnauthorized, loginPage{Username: name, Error: "用户名或密码错误"})
+		return
+	case err != nil:
+		logx.Error("Login failed | remote_ip: %s | user: %s | error: %v", ClientIP(r), name, err)
+		recordAudit(r, "login", audit.OutcomeFailure, auth.KindUser+":"+name, err, map[string]any{"method": token.MethodPassword})
+		renderLogin(w, r, http.StatusInternalServerError, loginPage{Username: name, Error: "登录失败，请查看服务端日志"})
+		return
+	}
+	claims, err := startSession(w, r, token.Claims{Subject: name, Method: token.MethodPassword, PwdGen: user.Generation()})
+	if err != nil {
+		logx.Error("Issue session token failed | remote_ip: %s | user: %s | error: %v", ClientIP(r), name, err)
+		recordAudit(r, "login", audit.OutcomeFailure, auth.KindUser+":"+name, err, map[string]any{"method": token.MethodPassword})
+		renderLogin(w, r, http.StatusInternalServerError, loginPage{Username: name, Error: "登录失败，请查看服务端日志"})
+		return
+	}
+	logx.Info("[AUDIT] Login succeeded | remote_ip: %s | user: %s | method: %s | sid: %s", ClientIP(r), name, claims.Method, claims.SessionID)
+	recordAudit(r, "login", audit.OutcomeSuccess, auth.KindUser+":"+name, nil, map[string]any{"method": claims.Method, "sid": claims.SessionID})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// startSession 登录成功后吊销登录前的会话并签发新会话
+func startSession(w http.ResponseWriter, r *http.Request, claims token.Claims) (*token.Claims, error) {
+	if old, err := token.Session(r); err == nil {
+		_ = token.Revoke(old.SessionID, old.Expires())
+	}
+	return token.Issue(w, r, ClientIP(r), claims)
+}
+
+// HandlerLogout 吊销当前会话并清除 Cookie：POST /logout
+func HandlerLogout(w http.ResponseWriter, r *http.Request) {
+	if err := token.SameOrigin(r); err != nil {
+		logx.Warn("[SECURITY] Logout rejected | remote_ip: %s | error: %v", ClientIP(r), err)
+		recordAudit(r, "logout", audit.OutcomeDenied, "", err, nil)
+		http.Error(w, "Cross-origin logout rejected", http.StatusForbidden)
+		return
+	}
+	if claims, err := token.Session(r); err == nil {
+		if err := token.Revoke(claims.SessionID, claims.Expires()); err != nil {
+			logx.Error("Revoke session failed | sid: %s | error: %v", claims.SessionID, err)
+		}
+		logx.Info("[AUDIT] Logout | remote_ip: %s | user: %s | sid: %s", ClientIP(r), claims.Subject, claims.SessionID)
+		recordAudit(r, "logout", audit.OutcomeSuccess, sessionIdentity(claims).String(), nil, map[string]any{"sid": claims.SessionID})
+	}
+	token.Clear(w, r)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
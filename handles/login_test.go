@@ -0,0 +1,85 @@
+package handles
+
+import (
+	"bufio"
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 锁定期间反复提交登录只写入一条审计记录，其余按地址聚合
+func TestLoginWhileLockedOutIsAggregated(t *testing.T) {
+	dir := t.TempDir()
+	cfg := useConfig(t, func(cfg *config.Config) {
+		cfg.Auth.UsersFile = filepath.Join(dir, "users.json")
+		cfg.Audit.File = filepath.Join(dir, "audit.log")
+	})
+	var users auth.UserFile
+	if err := users.Add("alice", "correct horse", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Write(cfg.Auth.UsersFile); err != nil {
+		t.Fatal(err)
+	}
+	loginTemplate = template.Must(template.New("login").Parse("{{.Error}}"))
+
+	post := func() int {
+		form := url.Values{"username": {"alice"}, "password": {"wrong"}}
+		r := httptest.NewRequest(http.MethodPost, "http://hoststat.example/login", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Origin", "http://hoststat.example")
+		r.RemoteAddr = "192.0.2.41:40000"
+		w := httptest.NewRecorder()
+		HandlerLogin(w, r)
+		return w.Code
+	}
+	for i := range cfg.Auth.MaxFailures - 1 {
+		if code := post(); code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status %d, want %d", i, code, http.StatusUnauthorized)
+		}
+	}
+	for i := range 20 {
+		if code := post(); code != http.StatusTooManyRequests {
+			t.Fatalf("locked attempt %d: status %d, want %d", i, code, http.StatusTooManyRequests)
+		}
+	}
+
+	file, err := os.Open(cfg.Audit.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	actions := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e audit.Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		actions[e.Action+"/"+e.Outcome]++
+	}
+	want := map[string]int{
+		"login/" + audit.OutcomeFailure:        cfg.Auth.MaxFailures - 1,
+		"login/" + audit.OutcomeDenied:         1, // 触发锁定的那次失败
+		"login.locked/" + audit.OutcomeFailure: 1,
+	}
+	if len(actions) != len(want) {
+		t.Fatalf("audit events = %v, want %v", actions, want)
+	}
+	for key, n := range want {
+		if actions[key] != n {
+			t.Errorf("audit events = %v, want %v", actions, want)
+			break
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package handles
+
+import (
+	"bytes"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/ratelimit"
+	"crypto/subtle"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	metricsNamespace   = "hoststat"
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// metricSample 指标中的一个样本（标签+数值）
+type metricSample struct {
+	labels []metricLabel
+	value  float64
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+// metricFamily 同名指标集合，对应一组 HELP/TYPE 行
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+// metricsWriter 按 Prometheus 文本格式输出指标，保持注册顺序
+type metricsWriter struct {
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+func newMetricsWriter() *metricsWriter {
+	return &metricsWriter{index: make(map[string]*metricFamily)}
+}
+
+func (m *metricsWriter) add(typ, name, help string, value float64, labels ...metricLabel) {
+	fullName := metricsNamespace + "_" + name
+	family, ok := m.index[fullName]
+	if !ok {
+		family = &metricFamily{name: fullName, help: help, typ: typ}
+		m.index[fullName] = family
+		m.families = append(m.families, family)
+	}
+	family.samples = append(family.samples, metricSample{labels: labels, value: value})
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...metricLabel) {
+	m.add("gauge", name, help, value, labels...)
+}
+
+func (m *metricsWriter) counter(name, help string, value float64, labels ...metricLabel) {
+	m.add("counter", name, help, value, labels...)
+}
+
+func (m *metricsWriter) bytes() []byte {
+	var buf bytes.Buffer
+	for _, family := range m.families {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", family.name, escapeMetricHelp(family.help))
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", family.name, family.typ)
+		for _, sample := range family.samples {
+			buf.WriteString(family.name)
+			if len(sample.labels) > 0 {
+				buf.WriteByte('{')
+				for i, label := range sample.labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					buf.WriteString(label.name)
+					buf.WriteString(`="`)
+					buf.WriteString(escapeMetricLabel(label.value))
+					buf.WriteByte('"')
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(formatMetricValue(sample.value))
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func label(name, value string) metricLabel {
+	return metricLabel{name: name, value: value}
+}
+
+func escapeMetricHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeMetricLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// collectMetrics 将 BaseInfo/CurrentInfo 转换为指标集合
+func collectMetrics(base *BaseInfo, current *CurrentInfo) *metricsWriter {
+	m := newMetricsWriter()
+
+	if base != nil {
+		m.gauge("host_info", "Host information, value is always 1.", 1,
+			label("hostname", base.Hostname),
+			label("os", base.OS),
+			label("platform", base.Platform),
+			label("platform_family", base.PlatformFamily),
+			label("platform_version", base.PlatformVersion),
+			label("distro", base.PrettyDistro),
+			label("kernel_arch", base.KernelArch),
+			label("kernel_version", base.KernelVersion),
+			label("ipv4", base.IPV4Addr),
+		)
+		m.gauge("cpu_info", "CPU information, value is always 1.", 1,
+			label("model_name", base.CPUModelName),
+		)
+		m.gauge("cpu_frequency_mhz", "CPU frequency in MHz.", base.CPUMhz)
+		m.gauge("cpu_physical_cores", "Number of physical CPU cores.", float64(base.CPUCores))
+		m.gauge("cpu_logical_cores", "Number of logical CPU cores.", float64(base.CPULogicalCores))
+	}
+	if current == nil {
+		return m
+	}
+
+	m.gauge("uptime_seconds", "System uptime in seconds.", float64(current.Uptime))
+	m.gauge("processes", "Number of processes.", float64(current.Procs))
+
+	m.gauge("cpu_usage_percent", "Total CPU usage in percent.", current.CPUUsedPercent)
+	m.gauge("cpu_used_cores", "CPU usage expressed in cores.", current.CPUUsed)
+	m.gauge("cpu_cores", "Number of CPU cores used for usage calculation.", float64(current.CPUTotal))
+	for i, percent := range current.CPUPercent {
+		m.gauge("cpu_core_usage_percent", "Per core CPU usage in percent.", percent, label("cpu", strconv.Itoa(i)))
+	}
+	for _, mode := range cpuModes(current.CPUDetailed.GetCPUDetailedPercent()) {
+		m.gauge("cpu_mode_percent", "Share of CPU time spent in each mode, in percent.", mode.value, label("mode", mode.name))
+	}
+	for i, detailed := range current.CPUPerCoreDetailed {
+		for _, mode := range cpuModes(detailed.GetCPUDetailedPercent()) {
+			m.gauge("cpu_core_mode_percent", "Share of per core CPU time spent in each mode, in percent.", mode.value,
+				label("cpu", strconv.Itoa(i)), label("mode", mode.name))
+		}
+	}
+
+	m.gauge("load1", "1 minute load average.", current.Load1)
+	m.gauge("load5", "5 minute load average.", current.Load5)
+	m.gauge("load15", "15 minute load average.", current.Load15)
+	m.gauge("load_usage_percent", "1 minute load relative to CPU capacity, in percent.", current.LoadUsagePercent)
+
+	m.gauge("memory_total_bytes", "Total physical memory in bytes.", float64(current.MemoryTotal))
+	m.gauge("memory_used_bytes", "Used physical memory in bytes.", float64(current.MemoryUsed))
+	m.gauge("memory_free_bytes", "Free physical memory in bytes.", float64(current.MemoryFree))
+	m.gauge("memory_shared_bytes", "Shared memory in bytes.", float64(current.MemoryShard))
+	m.gauge("memory_cache_bytes", "Cache and buffer memory in bytes.", float64(current.MemoryCache))
+	m.gauge("memory_available_bytes", "Available memory in bytes.", float64(current.MemoryAvailable))
+	m.gauge("memory_used_percent", "Used physical memory in percent.", current.MemoryUsedPercent)
+
+	m.gauge("swap_total_bytes", "Total swap in bytes.", float64(current.SwapMemoryTotal))
+	m.gauge("swap_free_bytes", "Free swap in bytes.", float64(current.SwapMemoryAvailable))
+	m.gauge("swap_used_bytes", "Used swap in bytes.", float64(current.SwapMemoryUsed))
+	m.gauge("swap_used_percent", "Used swap in percent.", current.SwapMemoryUsedPercent)
+
+	for _, d := range current.DiskData {
+		labels := []metricLabel{label("mountpoint", d.Path), label("device", d.Device), label("fstype", d.Type)}
+		m.gauge("filesystem_size_bytes", "Filesystem size in bytes.", float64(d.Total), labels...)
+		m.gauge("filesystem_free_bytes", "Filesystem free space in bytes.", float64(d.Free), labels...)
+		m.gauge("filesystem_used_bytes", "Filesystem used space in bytes.", float64(d.Used), labels...)
+		m.gauge("filesystem_used_percent", "Filesystem used space in percent.", d.UsedPercent, labels...)
+		m.gauge("filesystem_inodes", "Filesystem total inodes.", float64(d.InodesTotal), labels...)
+		m.gauge("filesystem_inodes_used", "Filesystem used inodes.", float64(d.InodesUsed), labels...)
+		m.gauge("filesystem_inodes_free", "Filesystem free inodes.", float64(d.InodesFree), labels...)
+		m.gauge("filesystem_inodes_used_percent", "Filesystem used inodes in percent.", d.InodesUsedPercent, labels...)
+	}
+
+	m.counter("disk_read_bytes_total", "Total bytes read from all disks.", float64(current.IOReadBytes))
+	m.counter("disk_written_bytes_total", "Total bytes written to all disks.", float64(current.IOWriteBytes))
+	m.counter("disk_io_operations_total", "Total read and write operations on all disks.", float64(current.IOCount))
+	m.counter("disk_read_time_seconds_total", "Total time spent reading from all disks.", float64(current.IOReadTime)/1000)
+	m.counter("disk_write_time_seconds_total", "Total time spent writing to all disks.", float64(current.IOWriteTime)/1000)
+	for _, d := range current.DiskIO {
+		device := label("device", d.Name)
+		m.counter("disk_device_reads_completed_total", "Reads completed on the device.", float64(d.ReadCount), device)
+		m.counter("disk_device_writes_completed_total", "Writes completed on the device.", float64(d.WriteCount), device)
+		m.counter("disk_device_read_bytes_total", "Bytes read from the device.", float64(d.ReadBytes), device)
+		m.counter("disk_device_written_bytes_total", "Bytes written to the device.", float64(d.WriteBytes), device)
+		m.counter("disk_device_read_time_seconds_total", "Time spent on reads by the device.", float64(d.ReadTime)/1000, device)
+		m.counter("disk_device_write_time_seconds_total", "Time spent on writes by the device.", float64(d.WriteTime)/1000, device)
+		m.counter("disk_device_io_time_seconds_total", "Time the device spent doing I/O.", float64(d.IoTime)/1000, device)
+		m.gauge("disk_device_io_now", "I/O requests currently in progress on the device.", float64(d.IopsInProgress), device)
+		m.gauge("disk_device_read_iops", "Read requests per second.", d.ReadIOPS, device)
+		m.gauge("disk_device_write_iops", "Write requests per second.", d.WriteIOPS, device)
+		m.gauge("disk_device_read_bytes_per_second", "Read throughput of the device.", d.ReadBytesRate, device)
+		m.gauge("disk_device_write_bytes_per_second", "Write throughput of the device.", d.WriteBytesRate, device)
+		m.gauge("disk_device_await_milliseconds", "Average time per I/O request.", d.Await, device)
+		m.gauge("disk_device_utilization_percent", "Percentage of time the device was busy.", d.UtilPercent, device)
+		m.gauge("disk_device_queue_depth", "Average I/O queue length.", d.QueueDepth, device)
+	}
+
+	m.counter("network_transmit_bytes_total", "Total bytes sent on all interfaces.", float64(current.NetBytesSent))
+	m.counter("network_receive_bytes_total", "Total bytes received on all interfaces.", float64(current.NetBytesRecv))
+	for _, iface := range current.NetInterfaces {
+		device := label("device", iface.Name)
+		up := 0.0
+		if iface.Up {
+			up = 1
+		}
+		m.gauge("network_interface_info", "Network interface information, value is always 1.", 1,
+			device, label("address", iface.HardwareAddr), label("mtu", strconv.Itoa(iface.MTU)))
+		m.gauge("network_interface_up", "Whether the network interface is up.", up, device)
+		m.counter("network_interface_receive_bytes_total", "Bytes received on the interface.", float64(iface.BytesRecv), device)
+		m.counter("network_interface_transmit_bytes_total", "Bytes sent on the interface.", float64(iface.BytesSent), device)
+		m.counter("network_interface_receive_packets_total", "Packets received on the interface.", float64(iface.PacketsRecv), device)
+		m.counter("network_interface_transmit_packets_total", "Packets sent on the interface.", float64(iface.PacketsSent), device)
+		m.counter("network_interface_receive_errors_total", "Receive errors on the interface.", float64(iface.Errin), device)
+		m.counter("network_interface_transmit_errors_total", "Transmit errors on the interface.", float64(iface.Errout), device)
+		m.counter("network_interface_receive_drop_total", "Dropped incoming packets on the interface.", float64(iface.Dropin), device)
+		m.counter("network_interface_transmit_drop_total", "Dropped outgoing packets on the interface.", float64(iface.Dropout), device)
+		m.gauge("network_interface_receive_bytes_per_second", "Receive throughput of the interface.", iface.BytesRecvRate, device)
+		m.gauge("network_interface_transmit_bytes_per_second", "Transmit throughput of the interface.", iface.BytesSentRate, device)
+		m.gauge("network_interface_receive_packets_per_second", "Receive packet rate of the interface.", iface.PacketsRecvRate, device)
+		m.gauge("network_interface_transmit_packets_per_second", "Transmit packet rate of the interface.", iface.PacketsSentRate, device)
+	}
+
+	m.gauge("scrape_timestamp_seconds", "Unix time the snapshot was taken.", float64(current.ShotTime.UnixNano())/1e9)
+	return m
+}
+
+type cpuModeValue struct {
+	name  string
+	value float64
+}
+
+// cpuModes 与 CPUDetailedPercent.GetCPUDetailedPercent 的顺序保持一致
+func cpuModes(values []float64) []cpuModeValue {
+	names := []string{"user", "system", "nice", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice"}
+	modes := make([]cpuModeValue, 0, len(names))
+	for i, name := range names {
+		if i >= len(values) {
+			break
+		}
+		modes = append(modes, cpuModeValue{name: name, value: values[i]})
+	}
+	return modes
+}
+
+func HandlerMetrics(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	base, err := cachedBaseInfo()
+	if err != nil {
+		logx.Error("Failed to get base info for metrics | remote_ip: %s | error: %v", ClientIP(r), err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m := collectMetrics(base, base.CurrentInfo)
+	m.gauge("stream_clients", "Number of connected live stream clients.", float64(sampler.subscribers.len()))
+	m.gauge("ratelimit_clients", "Clients whose token bucket is not full.", float64(ratelimit.LIMITER.Len()))
+	m.gauge("ratelimit_ip_clients", "Source addresses whose pre-authentication token bucket is not full.", float64(ratelimit.CLIENTS.Len()))
+	m.gauge("ratelimit_heavy_in_flight", "Heavy collector requests currently running.", float64(ratelimit.HEAVY.InFlight()))
+	throttled.each(func(route, reason string, n uint64) {
+		m.counter("ratelimit_throttled_total", "Requests rejected with 429 by rate limiting.", float64(n), label("route", route), label("reason", reason))
+	})
+	m.gauge("scrape_duration_seconds", "Time spent collecting metrics.", time.Since(start).Seconds())
+
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if _, err := w.Write(m.bytes()); err != nil {
+		logx.Error("Failed to write metrics response | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
+
+// MetricsAuthMiddleware /metrics 独立的可选认证，不依赖页面Cookie
+// 配置 metrics.token 后要求 Bearer Token；配置 metrics.user/metrics.password 后要求 Basic Auth
+// 两者都未设置时只有开启 metrics.anonymous 才不做认证，否则拒绝；拥有 metrics:read 权限的客户端证书、API Key 始终可以访问
+func MetricsAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.Get().Metrics
+		bearer, user, password := cfg.Token, cfg.User, cfg.Password
+		if bearer == "" && password == "" && cfg.Anonymous {
+			next(w, r)
+			return
+		}
+		if id, ok := certIdentity(r); ok {
+			if !id.Allows(auth.ScopeMetricsRead) {
+				denyScope(w, r, id, auth.ScopeMetricsRead)
+				return
+			}
+			next(w, auth.WithIdentity(r, id))
+			return
+		}
+		if value, ok := bearerAPIKey(r); ok {
+			if id, ok := authenticateAPIKey(w, r, value, auth.ScopeMetricsRead); ok {
+				next(w, auth.WithIdentity(r, id))
+			}
+			return
+		}
+		if bearer != "" {
+			if got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(got, bearer) {
+				next(w, r)
+				return
+			}
+		}
+		if password != "" {
+			if u, p, ok := r.BasicAuth(); ok && secureEqual(u, user) && secureEqual(p, password) {
+				next(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="hoststat metrics"`)
+		}
+		logx.Warn(
+			"[SECURITY] Metrics authentication failed | remote_ip: %s | path: %s | method: %s | timestamp: %s",
+			ClientIP(r),
+			r.URL.Path,
+			r.Method,
+			time.Now().Format("2006-01-02 15:04:05.000"),
+		)
+		recordFailure(r, "metrics.unauthorized", nil)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	}
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,39 @@
+package handles
+
+import (
+	"chihqiang/hoststat/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 未配置认证时 /metrics 默认拒绝，只有开启 metrics.anonymous 才允许匿名抓取
+func TestMetricsAuthFailsClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(cfg *config.Config)
+		header string
+		want   int
+	}{
+		{"nothing configured", nil, "", http.StatusUnauthorized},
+		{"anonymous", func(cfg *config.Config) { cfg.Metrics.Anonymous = true }, "", http.StatusOK},
+		{"missing bearer", func(cfg *config.Config) { cfg.Metrics.Token = "scrape" }, "", http.StatusUnauthorized},
+		{"wrong bearer", func(cfg *config.Config) { cfg.Metrics.Token = "scrape" }, "Bearer other", http.StatusUnauthorized},
+		{"bearer", func(cfg *config.Config) { cfg.Metrics.Token = "scrape" }, "Bearer scrape", http.StatusOK},
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, tt.edit)
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			MetricsAuthMiddleware(ok)(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
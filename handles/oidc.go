@@ -0,0 +1,228 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/oidc"
+	"chihqiang/hoststat/token"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	// oidcLoginTTL 从跳转到提供方到回调的最长时间
+	oidcLoginTTL = 10 * time.Minute
+	// oidcContinuePage 回调后通过本站页面跳转到首页：从提供方跳转回来属于跨站导航，
+	// 浏览器不会在随后的重定向中携带 SameSite=Strict 的会话 Cookie
+	oidcContinuePage = `<!DOCTYPE html><html lang="zh-CN"><head><meta charset="UTF-8"/><meta http-equiv="refresh" content="0;url=/"/><title>登录成功</title></head><body><a href="/">继续</a></body></html>`
+)
+
+// oidcLogin 进行中的单点登录，以 state 为键，回调时取出并删除
+type oidcLogin struct {
+	verifier    string
+	nonce       string
+	redirectURL string
+	expires     time.Time
+}
+
+type oidcLogins struct {
+	mu      sync.Mutex
+	pending map[string]oidcLogin
+}
+
+var ssoLogins = &oidcLogins{pending: make(map[string]oidcLogin)}
+
+func (l *oidcLogins) add(state string, login oidcLogin, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s, p := range l.pending {
+		if now.After(p.expires) {
+			delete(l.pending, s)
+		}
+	}
+	l.pending[state] = login
+}
+
+func (l *oidcLogins) take(state string, now time.Time) (oidcLogin, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.pending[state]
+	delete(l.pending, state)
+	return p, ok && !now.After(p.expires)
+}
+
+var ssoProvider atomic.Pointer[oidc.Provider]
+
+// currentProvider 返回配置的提供方，重新加载配置修改 issuer 后重新创建（重新获取发现文档与 JWKS）
+func currentProvider(issuer string) *oidc.Provider {
+	if p := ssoProvider.Load(); p != nil && p.Issuer() == strings.TrimSuffix(issuer, "/") {
+		return p
+	}
+	p := oidc.NewProvider(issuer)
+	ssoProvider.Store(p)
+	return p
+}
+
+// HandlerOIDCLogin 生成 state、nonce 与 PKCE 参数后跳转到提供方：GET /oidc/login
+func HandlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get().OIDC
+	if !cfg.Enabled() {
+		http.NotFound(w, r)
+		return
+	}
+	state, nonce, verifier := oidc.NewVerifier(), oidc.NewVerifier(), oidc.NewVerifier()
+	redirectURL := oidcRedirectURL(r, cfg)
+	authURL, err := currentProvider(cfg.Issuer).AuthCodeURL(r.Context(), cfg.ClientID, redirectURL, cfg.Scopes, state, nonce, verifier)
+	if err != nil {
+		logx.Error("OIDC login failed | remote_ip: %s | issuer: %s | error: %v", ClientIP(r), cfg.Issuer, err)
+		recordAudit(r, "login", audit.OutcomeFailure, "", err, map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusBadGateway, loginPage{Error: "单点登录暂不可用，请稍后再试"})
+		return
+	}
+	now := time.Now()
+	ssoLogins.add(state, oidcLogin{verifier: verifier, nonce: nonce, redirectURL: redirectURL, expires: now.Add(oidcLoginTTL)}, now)
+	// state 同时保存在浏览器中，回调必须来自发起登录的同一个浏览器；回调是跨站导航，只能使用 Lax
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/oidc/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   r.TLS != nil,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandlerOIDCCallback 用授权码换取 ID Token，校验后按组映射角色并签发会话：GET /oidc/callback
+func HandlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get().OIDC
+	if !cfg.Enabled() {
+		http.NotFound(w, r)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/oidc/", HttpOnly: true, Secure: r.TLS != nil, MaxAge: -1})
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		logx.Warn("[SECURITY] OIDC login failed | remote_ip: %s | error: %s | description: %s", ClientIP(r), e, q.Get("error_description"))
+		recordAudit(r, "login", audit.OutcomeFailure, "", errors.New(e), map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusUnauthorized, loginPage{Error: "单点登录失败：" + e})
+		return
+	}
+	now := time.Now()
+	state := q.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		logx.Warn("[SECURITY] OIDC callback state mismatch | remote_ip: %s", ClientIP(r))
+		recordAudit(r, "login", audit.OutcomeDenied, "", errors.New("state mismatch"), map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusBadRequest, loginPage{Error: "登录请求已失效，请重新登录"})
+		return
+	}
+	login, ok := ssoLogins.take(state, now)
+	if !ok {
+		logx.Warn("[SECURITY] OIDC callback with unknown or expired state | remote_ip: %s", ClientIP(r))
+		recordAudit(r, "login", audit.OutcomeDenied, "", errors.New("unknown or expired state"), map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusBadRequest, loginPage{Error: "登录请求已失效，请重新登录"})
+		return
+	}
+	provider := currentProvider(cfg.Issuer)
+	rawIDToken, err := provider.Exchange(r.Context(), cfg.ClientID, cfg.ClientSecret, login.redirectURL, q.Get("code"), login.verifier)
+	if err != nil {
+		logx.Error("OIDC code exchange failed | remote_ip: %s | issuer: %s | error: %v", ClientIP(r), cfg.Issuer, err)
+		recordAudit(r, "login", audit.OutcomeFailure, "", err, map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusBadGateway, loginPage{Error: "单点登录失败，请查看服务端日志"})
+		return
+	}
+	claims, err := provider.Verify(r.Context(), rawIDToken, cfg.ClientID, login.nonce, now)
+	if err != nil {
+		logx.Warn("[SECURITY] OIDC id token rejected | remote_ip: %s | issuer: %s | error: %v", ClientIP(r), cfg.Issuer, err)
+		recordAudit(r, "login", audit.OutcomeFailure, "", err, map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusUnauthorized, loginPage{Error: "单点登录失败，请查看服务端日志"})
+		return
+	}
+	name, err := oidcUsername(cfg, claims)
+	if err != nil {
+		logx.Warn("[SECURITY] OIDC login denied | remote_ip: %s | user: %s | error: %v", ClientIP(r), name, err)
+		recordAudit(r, "login", audit.OutcomeDenied, auth.KindUser+":"+name, err, map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusForbidden, loginPage{Error: "没有访问权限，请联系管理员"})
+		return
+	}
+	groups := oidc.StringsClaim(claims, cfg.GroupsClaim)
+	role := oidcRole(cfg, groups)
+	if role == "" {
+		logx.Warn("[SECURITY] OIDC login denied, no matching group | remote_ip: %s | user: %s | groups: %v", ClientIP(r), name, groups)
+		recordAudit(r, "login", audit.OutcomeDenied, auth.KindUser+":"+name, errors.New("no matching group"), map[string]any{"method": token.MethodOIDC, "groups": groups})
+		renderLogin(w, r, http.StatusForbidden, loginPage{Error: "没有访问权限，请联系管理员"})
+		return
+	}
+	session, err := startSession(w, r, token.Claims{
+		Subject:   name,
+		Method:    token.MethodOIDC,
+		Role:      role,
+		Issuer:    provider.Issuer(),
+		ClientID:  cfg.ClientID,
+		ExpiresAt: now.Add(cfg.SessionMaxAge.Std()).Unix(),
+	})
+	if err != nil {
+		logx.Error("Issue session token failed | remote_ip: %s | user: %s | error: %v", ClientIP(r), name, err)
+		recordAudit(r, "login", audit.OutcomeFailure, auth.KindUser+":"+name, err, map[string]any{"method": token.MethodOIDC})
+		renderLogin(w, r, http.StatusInternalServerError, loginPage{Error: "登录失败，请查看服务端日志"})
+		return
+	}
+	logx.Info("[AUDIT] Login succeeded | remote_ip: %s | user: %s | method: %s | role: %s | sid: %s", ClientIP(r), name, session.Method, role, session.SessionID)
+	recordAudit(r, "login", audit.OutcomeSuccess, auth.KindUser+":"+name, nil, map[string]any{"method": session.Method, "role": role, "sid": session.SessionID})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write([]byte(oidcContinuePage))
+}
+
+// oidcUsername 读取 oidc.usernameClaim 作为用户名，缺少时使用 sub
+// 使用 email 作为用户名时要求 email_verified 为 true，避免提供方允许用户填写任意邮箱时冒充其他用户
+func oidcUsername(cfg config.OIDCConfig, claims map[string]any) (string, error) {
+	sub, _ := claims["sub"].(string)
+	name, _ := claims[cfg.UsernameClaim].(string)
+	if name == "" {
+		return sub, nil
+	}
+	if cfg.UsernameClaim == "email" {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return sub, errors.New("email is not verified: " + name)
+		}
+	}
+	return name, nil
+}
+
+// oidcRole 按组映射角色：属于 adminGroups 为 admin；属于 viewerGroups 为 viewer；否则拒绝
+func oidcRole(cfg config.OIDCConfig, groups []string) string {
+	inAny := func(list []string) bool {
+		return slices.ContainsFunc(groups, func(g string) bool { return slices.Contains(list, g) })
+	}
+	switch {
+	case inAny(cfg.AdminGroups):
+		return auth.RoleAdmin
+	case inAny(cfg.ViewerGroups):
+		return auth.RoleViewer
+	}
+	return ""
+}
+
+// oidcRedirectURL 配置的回调地址，未配置时按请求的 Host 生成
+func oidcRedirectURL(r *http.Request, cfg config.OIDCConfig) string {
+	if cfg.RedirectURL != "" {
+		return cfg.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/oidc/callback"
+}
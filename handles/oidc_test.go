@@ -0,0 +1,132 @@
+package handles
+
+import (
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/token"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useConfig 使用默认配置（关闭审计日志），edit 可修改其中的字段
+func useConfig(t *testing.T, edit func(cfg *config.Config)) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Audit.File = ""
+	if edit != nil {
+		edit(cfg)
+	}
+	config.Set(cfg)
+	return cfg
+}
+
+func useOIDC(t *testing.T) config.OIDCConfig {
+	t.Helper()
+	return useConfig(t, func(cfg *config.Config) {
+		cfg.OIDC.Issuer = "https://idp.example.com"
+		cfg.OIDC.ClientID = "hoststat"
+		cfg.OIDC.ViewerGroups = []string{"ops"}
+		cfg.OIDC.AdminGroups = []string{"admins"}
+	}).OIDC
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	useOIDC(t)
+	loginTemplate = template.Must(template.New("login").Parse("{{.Error}}"))
+	now := time.Now()
+	ssoLogins.add("issued-state", oidcLogin{verifier: "v", nonce: "n", expires: now.Add(time.Minute)}, now)
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+	}{
+		{"missing cookie", "state=issued-state&code=c", ""},
+		{"cookie from another login", "state=issued-state&code=c", "other-state"},
+		{"unknown state", "state=forged&code=c", "forged"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/oidc/callback?"+tt.query, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			HandlerOIDCCallback(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+		})
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	cfg := useOIDC(t)
+	tests := []struct {
+		name   string
+		viewer []string
+		groups []string
+		want   string
+	}{
+		{"admin group", []string{"ops"}, []string{"admins"}, auth.RoleAdmin},
+		{"viewer group", []string{"ops"}, []string{"ops"}, auth.RoleViewer},
+		{"no matching group", []string{"ops"}, []string{"dev"}, ""},
+		{"empty viewer groups deny", nil, []string{"dev"}, ""},
+		{"no groups", nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.ViewerGroups = tt.viewer
+			if got := oidcRole(cfg, tt.groups); got != tt.want {
+				t.Fatalf("role = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCUsernameRequiresVerifiedEmail(t *testing.T) {
+	cfg := useOIDC(t)
+	claims := map[string]any{"sub": "user-1", "email": "alice@example.com"}
+	if _, err := oidcUsername(cfg, claims); err == nil {
+		t.Fatal("unverified email accepted as username")
+	}
+	claims["email_verified"] = true
+	if name, err := oidcUsername(cfg, claims); err != nil || name != "alice@example.com" {
+		t.Fatalf("username = %q, %v", name, err)
+	}
+	if name, err := oidcUsername(cfg, map[string]any{"sub": "user-1"}); err != nil || name != "user-1" {
+		t.Fatalf("username without email = %q, %v, want sub", name, err)
+	}
+}
+
+// 单点登录会话绑定提供方和客户端ID，并受 oidc.sessionMaxAge 限制
+func TestCheckUserBindsOIDCSession(t *testing.T) {
+	cfg := useOIDC(t)
+	now := time.Now()
+	valid := token.Claims{Subject: "alice", Method: token.MethodOIDC, Role: auth.RoleViewer, Issuer: cfg.Issuer, ClientID: cfg.ClientID, IssuedAt: now.Unix()}
+	if err := checkUser(&valid); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(c *token.Claims)
+	}{
+		{"other issuer", func(c *token.Claims) { c.Issuer = "https://other.example.com" }},
+		{"other client", func(c *token.Claims) { c.ClientID = "other" }},
+		{"legacy session without binding", func(c *token.Claims) { c.Issuer, c.ClientID = "", "" }},
+		{"older than session max age", func(c *token.Claims) { c.IssuedAt = now.Add(-cfg.SessionMaxAge.Std() - time.Minute).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.edit(&claims)
+			if err := checkUser(&claims); err == nil {
+				t.Fatal("session accepted")
+			}
+		})
+	}
+}
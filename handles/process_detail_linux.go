@@ -0,0 +1,128 @@
+package handles
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// clockTicks /proc 中时间字段的单位（USER_HZ），Linux 上固定为100
+const clockTicks = 100
+
+func threadName(pid, tid int32) string {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "task", strconv.Itoa(int(tid)), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// threadStartTime 读取 /proc/<pid>/task/<tid>/stat 第22个字段（开机后的时钟节拍数）
+func threadStartTime(pid, tid int32) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "task", strconv.Itoa(int(tid)), "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	// comm 可能包含空格，从最后一个 ')' 之后开始解析，此时 state 为第1个字段
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return time.Time{}, os.ErrInvalid
+	}
+	ticks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	boot, err := host.BootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(boot), 0).Add(time.Duration(ticks) * time.Second / clockTicks), nil
+}
+
+// processCgroups 读取 /proc/<pid>/cgroup，每行格式为 hierarchy-ID:controllers:path
+func processCgroups(pid int32) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+	cgroups := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line != "" {
+			cgroups = append(cgroups, line)
+		}
+	}
+	return cgroups, nil
+}
+
+// processNamespaces 读取 /proc/<pid>/ns 下的符号链接，如 net:[4026531840]
+func processNamespaces(pid int32) (map[string]uint64, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(int(pid)), "ns")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := make(map[string]uint64, len(entries))
+	var lastErr error
+	for _, entry := range entries {
+		link, err := os.Readlink(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_, id, ok := strings.Cut(link, ":[")
+		if !ok {
+			continue
+		}
+		if inode, err := strconv.ParseUint(strings.TrimSuffix(id, "]"), 10, 64); err == nil {
+			namespaces[entry.Name()] = inode
+		}
+	}
+	if len(namespaces) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return namespaces, nil
+}
+
+// summarizeMemoryMaps 汇总内存映射，并按路径合并后取 RSS 最大的前10项
+func summarizeMemoryMaps(maps []process.MemoryMapsStat) *MemoryMapsInfo {
+	info := &MemoryMapsInfo{Count: len(maps), Top: []MemoryMapItem{}}
+	byPath := make(map[string]*MemoryMapItem)
+	// smaps 中的数值单位为 KB
+	for _, m := range maps {
+		info.Size += m.Size * 1024
+		info.RSS += m.Rss * 1024
+		info.PSS += m.Pss * 1024
+		info.Swap += m.Swap * 1024
+		path := m.Path
+		if path == "" {
+			path = "[anon]"
+		}
+		item, ok := byPath[path]
+		if !ok {
+			item = &MemoryMapItem{Path: path}
+			byPath[path] = item
+		}
+		item.Count++
+		item.Size += m.Size * 1024
+		item.RSS += m.Rss * 1024
+	}
+	for _, item := range byPath {
+		info.Top = append(info.Top, *item)
+	}
+	slices.SortFunc(info.Top, func(a, b MemoryMapItem) int {
+		if c := cmp.Compare(b.RSS, a.RSS); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	info.Top = info.Top[:min(len(info.Top), 10)]
+	return info
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package handles
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+func threadName(pid, tid int32) string {
+	return ""
+}
+
+func threadStartTime(pid, tid int32) (time.Time, error) {
+	return time.Time{}, errors.ErrUnsupported
+}
+
+func processCgroups(pid int32) ([]string, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func processNamespaces(pid int32) (map[string]uint64, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func summarizeMemoryMaps(maps []process.MemoryMapsStat) *MemoryMapsInfo {
+	return &MemoryMapsInfo{Count: len(maps), Top: []MemoryMapItem{}}
+}
@@ -0,0 +1,63 @@
+package handles
+
+import (
+	"chihqiang/hoststat/config"
+	"runtime"
+	"time"
+)
+
+// processCPUSample 上次扫描时进程的累计 CPU 时间；启动时间用于识别 pid 复用
+type processCPUSample struct {
+	startTime int64
+	cpuTime   float64
+	percent   float64
+}
+
+// processCPUSampler 像 top 一样按相邻两次扫描之间的 CPU 时间增量计算进程 CPU 使用率
+// 100% 表示占满一个核心；调用方需持有 processTableCache.mu
+type processCPUSampler struct {
+	sampledAt time.Time
+	samples   map[int32]processCPUSample
+}
+
+// stale 距上次扫描超过 processes.cpuResetInterval 时先建立基线，避免返回长时间窗口内的平均值
+func (s *processCPUSampler) stale(now time.Time) bool {
+	return s.samples == nil || now.Sub(s.sampledAt) > config.Get().Processes.CPUResetInterval.Std()
+}
+
+// update 根据上次扫描结果填充 rows 的 CPUPercent，并将本次扫描保存为新的基线
+func (s *processCPUSampler) update(rows []ProcessRow, at time.Time) {
+	limit := float64(runtime.NumCPU()) * 100
+	samples := make(map[int32]processCPUSample, len(rows))
+	for i := range rows {
+		row := &rows[i]
+		var delta, interval float64
+		prev, ok := s.samples[row.Pid]
+		switch {
+		case ok && prev.startTime == row.StartTime:
+			delta = row.CPUTime - prev.cpuTime
+			interval = at.Sub(s.sampledAt).Seconds()
+		case !s.sampledAt.IsZero() && time.UnixMilli(row.StartTime).After(s.sampledAt):
+			// 上次扫描之后启动的进程（包括复用了旧 pid 的进程），全部 CPU 时间都发生在本区间内
+			delta = row.CPUTime
+			interval = at.Sub(time.UnixMilli(row.StartTime)).Seconds()
+		}
+		if delta > 0 && interval > 0 {
+			row.CPUPercent = min(delta/interval*100, limit)
+		} else {
+			row.CPUPercent = 0
+		}
+		samples[row.Pid] = processCPUSample{startTime: row.StartTime, cpuTime: row.CPUTime, percent: row.CPUPercent}
+	}
+	s.samples = samples
+	s.sampledAt = at
+}
+
+// percent 返回最近一次扫描得到的进程 CPU 使用率，pid 已被复用时返回 false
+func (s *processCPUSampler) percent(pid int32, startTime int64) (float64, bool) {
+	sample, ok := s.samples[pid]
+	if !ok || sample.startTime != startTime {
+		return 0, false
+	}
+	return sample.percent, true
+}
@@ -0,0 +1,151 @@
+package handles
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/chihqiang/logx"
+)
+
+// kthreaddPid Linux 内核线程均由 kthreadd(2) 创建
+const kthreaddPid = 2
+
+// ProcessNode 进程树节点，Subtree* 为包含自身在内的整棵子树的合计
+type ProcessNode struct {
+	ProcessRow
+	SubtreeCPUPercent float64        `json:"subtreeCpuPercent"`
+	SubtreeRSS        uint64         `json:"subtreeRss"`
+	SubtreeCount      int            `json:"subtreeCount"`
+	Collapsed         int            `json:"collapsed,omitempty"` // 被折叠的内核线程数，已计入 Subtree*
+	Children          []*ProcessNode `json:"children"`
+
+	collapsedCPUPercent float64
+	collapsedRSS        uint64
+}
+
+type ProcessTreeResponse struct {
+	Total int            `json:"total"`
+	Roots []*ProcessNode `json:"roots"`
+}
+
+// HandlerProcessTree 进程树：/processes/tree?pid=&collapseKernel=
+// pid 指定时以该进程为根；collapseKernel 默认为 true，将内核线程折叠到 kthreadd 节点
+func HandlerProcessTree(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var root int32
+	if value := query.Get("pid"); value != "" {
+		pid, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || pid <= 0 {
+			http.Error(w, "invalid pid", http.StatusBadRequest)
+			return
+		}
+		root = int32(pid)
+	}
+	collapseKernel := true
+	if value := query.Get("collapseKernel"); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "invalid collapseKernel", http.StatusBadRequest)
+			return
+		}
+		collapseKernel = b
+	}
+
+	rows, err := processTable.get()
+	if err != nil {
+		logx.Error("Failed to list processes | remote_ip: %s | error: %v", ClientIP(r), err)
+		http.Error(w, "Failed to list processes", http.StatusInternalServerError)
+		return
+	}
+	roots, nodes := buildProcessTree(rows, collapseKernel)
+	if _, ok := nodes[root]; root != 0 && !ok && collapseKernel {
+		// 指定的根是内核线程时不折叠
+		roots, nodes = buildProcessTree(rows, false)
+	}
+	resp := ProcessTreeResponse{Total: len(rows), Roots: roots}
+	if root != 0 {
+		node, ok := nodes[root]
+		if !ok {
+			http.Error(w, "process not found", http.StatusNotFound)
+			return
+		}
+		resp.Roots = []*ProcessNode{node}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logx.Error("Failed to encode process tree JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
+
+// buildProcessTree 根据 ppid 构建进程树，父进程不在列表中的进程作为根节点
+// 返回根节点列表以及 pid->节点 索引（折叠的内核线程不在索引中）
+func buildProcessTree(rows []ProcessRow, collapseKernel bool) ([]*ProcessNode, map[int32]*ProcessNode) {
+	nodes := make(map[int32]*ProcessNode, len(rows))
+	for _, row := range rows {
+		nodes[row.Pid] = &ProcessNode{ProcessRow: row, Children: []*ProcessNode{}}
+	}
+	var roots []*ProcessNode
+	for _, row := range rows {
+		node := nodes[row.Pid]
+		parent, ok := nodes[row.Ppid]
+		if !ok || row.Ppid == row.Pid {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+	if kthreadd, ok := nodes[kthreaddPid]; ok && collapseKernel {
+		for _, child := range kthreadd.Children {
+			aggregateProcessTree(child)
+			kthreadd.Collapsed += child.SubtreeCount
+			kthreadd.collapsedCPUPercent += child.SubtreeCPUPercent
+			kthreadd.collapsedRSS += child.SubtreeRSS
+			removeProcessTree(nodes, child)
+		}
+		kthreadd.Children = []*ProcessNode{}
+	}
+	for _, root := range roots {
+		aggregateProcessTree(root)
+	}
+	sortProcessNodes(roots)
+	return roots, nodes
+}
+
+// aggregateProcessTree 自底向上计算子树合计，并按子树 CPU 使用率对子节点排序
+func aggregateProcessTree(node *ProcessNode) {
+	node.SubtreeCPUPercent = node.CPUPercent
+	node.SubtreeRSS = node.RSS
+	node.SubtreeCount = 1
+	for _, child := range node.Children {
+		aggregateProcessTree(child)
+		node.SubtreeCPUPercent += child.SubtreeCPUPercent
+		node.SubtreeRSS += child.SubtreeRSS
+		node.SubtreeCount += child.SubtreeCount
+	}
+	// 被折叠的子节点已从 Children 中移除，单独累加
+	node.SubtreeCPUPercent += node.collapsedCPUPercent
+	node.SubtreeRSS += node.collapsedRSS
+	node.SubtreeCount += node.Collapsed
+	sortProcessNodes(node.Children)
+}
+
+func removeProcessTree(nodes map[int32]*ProcessNode, node *ProcessNode) {
+	delete(nodes, node.Pid)
+	for _, child := range node.Children {
+		removeProcessTree(nodes, child)
+	}
+}
+
+func sortProcessNodes(nodes []*ProcessNode) {
+	slices.SortFunc(nodes, func(a, b *ProcessNode) int {
+		if c := cmp.Compare(b.SubtreeCPUPercent, a.SubtreeCPUPercent); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Pid, b.Pid)
+	})
+}
@@ -0,0 +1,354 @@
+package handles
+
+import (
+	"chihqiang/hoststat/config"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// ProcessRow 进程表中的一行；无权限读取的字段为零值
+type ProcessRow struct {
+	Pid           int32   `json:"pid"`
+	Ppid          int32   `json:"ppid"`
+	Name          string  `json:"name"`
+	Cmd           string  `json:"cmd"`
+	User          string  `json:"user"`
+	State         string  `json:"state"`
+	Threads       int32   `json:"threads"`
+	Nice          int32   `json:"nice"`
+	StartTime     int64   `json:"startTime"` // Unix 毫秒
+	RSS           uint64  `json:"rss"`
+	VMS           uint64  `json:"vms"`
+	MemoryPercent float64 `json:"memoryPercent"`
+	CPUPercent    float64 `json:"cpuPercent"` // 相邻两次扫描之间的 CPU 使用率，100 表示占满一个核心
+	CPUTime       float64 `json:"cpuTime"`    // 用户态+内核态，秒
+	FDs           int32   `json:"fds"`
+	IOReadBytes   uint64  `json:"ioReadBytes"`
+	IOWriteBytes  uint64  `json:"ioWriteBytes"`
+}
+
+type ProcessesResponse struct {
+	Total     int          `json:"total"` // 过滤后、分页前的进程数
+	Offset    int          `json:"offset"`
+	Limit     int          `json:"limit"`
+	Processes []ProcessRow `json:"processes"`
+}
+
+// processSortKeys 可用于 sort= 的字段，与 JSON 字段名一致
+var processSortKeys = map[string]func(a, b *ProcessRow) int{
+	"pid":           func(a, b *ProcessRow) int { return cmp.Compare(a.Pid, b.Pid) },
+	"ppid":          func(a, b *ProcessRow) int { return cmp.Compare(a.Ppid, b.Ppid) },
+	"name":          func(a, b *ProcessRow) int { return strings.Compare(a.Name, b.Name) },
+	"user":          func(a, b *ProcessRow) int { return strings.Compare(a.User, b.User) },
+	"state":         func(a, b *ProcessRow) int { return strings.Compare(a.State, b.State) },
+	"threads":       func(a, b *ProcessRow) int { return cmp.Compare(a.Threads, b.Threads) },
+	"nice":          func(a, b *ProcessRow) int { return cmp.Compare(a.Nice, b.Nice) },
+	"startTime":     func(a, b *ProcessRow) int { return cmp.Compare(a.StartTime, b.StartTime) },
+	"rss":           func(a, b *ProcessRow) int { return cmp.Compare(a.RSS, b.RSS) },
+	"vms":           func(a, b *ProcessRow) int { return cmp.Compare(a.VMS, b.VMS) },
+	"memoryPercent": func(a, b *ProcessRow) int { return cmp.Compare(a.MemoryPercent, b.MemoryPercent) },
+	"cpuPercent":    func(a, b *ProcessRow) int { return cmp.Compare(a.CPUPercent, b.CPUPercent) },
+	"cpuTime":       func(a, b *ProcessRow) int { return cmp.Compare(a.CPUTime, b.CPUTime) },
+	"fds":           func(a, b *ProcessRow) int { return cmp.Compare(a.FDs, b.FDs) },
+	"ioReadBytes":   func(a, b *ProcessRow) int { return cmp.Compare(a.IOReadBytes, b.IOReadBytes) },
+	"ioWriteBytes":  func(a, b *ProcessRow) int { return cmp.Compare(a.IOWriteBytes, b.IOWriteBytes) },
+}
+
+// processQuery 进程表的排序、过滤与分页条件
+type processQuery struct {
+	sort   string
+	desc   bool
+	limit  int // 0 表示不限制
+	offset int
+	users  []string
+	states []string
+	name   *regexp.Regexp
+}
+
+// parseProcessQuery 解析 /processes?sort=&order=&limit=&offset=&user=&name=&state=
+func parseProcessQuery(values map[string][]string) (processQuery, error) {
+	get := func(key string) string {
+		if v := values[key]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+	q := processQuery{sort: "pid"}
+	if s := get("sort"); s != "" {
+		if _, ok := processSortKeys[s]; !ok {
+			return q, errors.New("invalid sort: " + s)
+		}
+		q.sort = s
+	}
+	switch get("order") {
+	case "", "asc":
+	case "desc":
+		q.desc = true
+	default:
+		return q, errors.New("invalid order, expected asc or desc")
+	}
+	var err error
+	if s := get("limit"); s != "" {
+		if q.limit, err = strconv.Atoi(s); err != nil || q.limit < 0 {
+			return q, errors.New("invalid limit")
+		}
+	}
+	if s := get("offset"); s != "" {
+		if q.offset, err = strconv.Atoi(s); err != nil || q.offset < 0 {
+			return q, errors.New("invalid offset")
+		}
+	}
+	q.users = splitList(get("user"))
+	q.states = splitList(strings.ToLower(get("state")))
+	if s := get("name"); s != "" {
+		if q.name, err = regexp.Compile(s); err != nil {
+			return q, errors.New("invalid name pattern: " + err.Error())
+		}
+	}
+	return q, nil
+}
+
+func (q processQuery) match(row *ProcessRow) bool {
+	if len(q.users) > 0 && !slices.Contains(q.users, row.User) {
+		return false
+	}
+	if len(q.states) > 0 && !slices.Contains(q.states, row.State) {
+		return false
+	}
+	return q.name == nil || q.name.MatchString(row.Name)
+}
+
+// apply 过滤、排序并分页，返回过滤后的总数与当前页；不修改传入的切片
+func (q processQuery) apply(rows []ProcessRow) (int, []ProcessRow) {
+	matched := make([]ProcessRow, 0, len(rows))
+	for i := range rows {
+		if q.match(&rows[i]) {
+			matched = append(matched, rows[i])
+		}
+	}
+	compare := processSortKeys[q.sort]
+	slices.SortStableFunc(matched, func(a, b ProcessRow) int {
+		c := compare(&a, &b)
+		if c == 0 {
+			c = cmp.Compare(a.Pid, b.Pid)
+		}
+		if q.desc {
+			return -c
+		}
+		return c
+	})
+	total := len(matched)
+	start := min(q.offset, total)
+	end := total
+	if q.limit > 0 {
+		end = min(start+q.limit, total)
+	}
+	return total, matched[start:end]
+}
+
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// HandlerProcesses 完整进程表：/processes?sort=cpuPercent&order=desc&limit=20&offset=0&user=root&name=^nginx&state=running
+func HandlerProcesses(w http.ResponseWriter, r *http.Request) {
+	q, err := parseProcessQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := processTable.get()
+	if err != nil {
+		logx.Error("Failed to list processes | remote_ip: %s | error: %v", ClientIP(r), err)
+		http.Error(w, "Failed to list processes", http.StatusInternalServerError)
+		return
+	}
+	resp := ProcessesResponse{Offset: q.offset, Limit: q.limit}
+	resp.Total, resp.Processes = q.apply(rows)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logx.Error("Failed to encode processes JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
+
+// loadTopCPU CPU 使用率最高的5个进程，即 sort=cpuPercent&order=desc&limit=5
+func loadTopCPU() []ProcessInfo {
+	return loadTopProcesses(processQuery{sort: "cpuPercent", desc: true, limit: 5})
+}
+
+// loadTopMem 常驻内存最高的5个进程，即 sort=rss&order=desc&limit=5
+func loadTopMem() []ProcessInfo {
+	return loadTopProcesses(processQuery{sort: "rss", desc: true, limit: 5})
+}
+
+func loadTopProcesses(q processQuery) []ProcessInfo {
+	rows, err := processTable.get()
+	if err != nil {
+		return nil
+	}
+	_, page := q.apply(rows)
+	infos := make([]ProcessInfo, 0, len(page))
+	for _, row := range page {
+		info := ProcessInfo{Pid: row.Pid, Name: row.Name, Cmd: row.Cmd, User: row.User, Percent: row.CPUPercent}
+		if q.sort == "rss" {
+			info.Percent = row.MemoryPercent
+			info.Memory = row.RSS
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// processTableCache 多个请求共享的进程表缓存，同时保存计算 CPU 使用率所需的上次扫描结果
+// mu 只保护缓存数据，扫描与等待基线期间不持有；scanMu 保证同一时间只有一个请求在扫描
+type processTableCache struct {
+	scanMu  sync.Mutex
+	mu      sync.Mutex
+	updated time.Time
+	rows    []ProcessRow
+	cpu     processCPUSampler
+}
+
+var processTable = &processTableCache{}
+
+// get 进程表采集开销较大，processes.cacheInterval 内的请求共享同一次采集
+func (c *processTableCache) get() ([]ProcessRow, error) {
+	if rows, ok := c.cached(); ok {
+		return rows, nil
+	}
+	c.scanMu.Lock()
+	defer c.scanMu.Unlock()
+	// 等待期间其他请求可能已完成扫描
+	if rows, ok := c.cached(); ok {
+		return rows, nil
+	}
+	c.mu.Lock()
+	stale := c.cpu.stale(time.Now())
+	c.mu.Unlock()
+	if stale {
+		if _, err := c.scan(); err != nil {
+			return nil, err
+		}
+		time.Sleep(config.Get().Processes.CPUBaselineDelay.Std())
+	}
+	return c.scan()
+}
+
+// cached 返回缓存时间内的进程表
+func (c *processTableCache) cached() ([]ProcessRow, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rows != nil && time.Since(c.updated) < config.Get().Processes.CacheInterval.Std() {
+		return c.rows, true
+	}
+	return nil, false
+}
+
+// scan 在锁外扫描进程表，再在锁内计算 CPU 使用率并更新缓存
+func (c *processTableCache) scan() ([]ProcessRow, error) {
+	start := time.Now()
+	rows, err := loadProcessTable()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cpu.update(rows, start)
+	c.rows, c.updated = rows, time.Now()
+	return rows, nil
+}
+
+// cpuPercent 返回进程最近一次扫描得到的 CPU 使用率
+func (c *processTableCache) cpuPercent(pid int32, startTime int64) (float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cpu.percent(pid, startTime)
+}
+
+// loadProcessTable 并发读取所有进程的信息，读取期间退出的进程会被跳过
+func loadProcessTable() ([]ProcessRow, error) {
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]ProcessRow, len(processes))
+	ok := make([]bool, len(processes))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), 8) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				rows[i], ok[i] = loadProcessRow(processes[i])
+			}
+		}()
+	}
+	for i := range processes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	table := make([]ProcessRow, 0, len(rows))
+	for i := range rows {
+		if ok[i] {
+			table = append(table, rows[i])
+		}
+	}
+	return table, nil
+}
+
+func loadProcessRow(p *process.Process) (ProcessRow, bool) {
+	row := ProcessRow{Pid: p.Pid}
+	name, err := p.Name()
+	if err != nil {
+		// 进程已退出
+		return row, false
+	}
+	row.Name = name
+	row.Ppid, _ = p.Ppid()
+	row.Cmd, _ = p.Cmdline()
+	row.User, _ = p.Username()
+	if status, err := p.Status(); err == nil && len(status) > 0 {
+		row.State = status[0]
+	}
+	row.Threads, _ = p.NumThreads()
+	row.Nice, _ = p.Nice()
+	row.StartTime, _ = p.CreateTime()
+	if mem, err := p.MemoryInfo(); err == nil {
+		row.RSS = mem.RSS
+		row.VMS = mem.VMS
+	}
+	if percent, err := p.MemoryPercent(); err == nil {
+		row.MemoryPercent = float64(percent)
+	}
+	if times, err := p.Times(); err == nil {
+		row.CPUTime = times.User + times.System
+	}
+	row.FDs, _ = p.NumFDs()
+	if io, err := p.IOCounters(); err == nil {
+		row.IOReadBytes = io.ReadBytes
+		row.IOWriteBytes = io.WriteBytes
+	}
+	return row, true
+}
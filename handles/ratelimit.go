@@ -0,0 +1,130 @@
+package handles
+
+import (
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/ratelimit"
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// routeCost 接口开销：tokens 为每次请求扣除的令牌数，heavy 表示需要占用重型采集的并发名额
+type routeCost struct {
+	tokens int
+	heavy  bool
+}
+
+var (
+	costLight = routeCost{tokens: 1}
+	// costMedium 读取历史数据、单个进程详情
+	costMedium = routeCost{tokens: 5}
+	// costHeavy 遍历全部进程（读取命令行、属主）或读取主机信息
+	costHeavy = routeCost{tokens: 10, heavy: true}
+	// costScrape /metrics 读取主机信息，但不占用重型采集的名额：页面遍历进程时监控抓取不应排队或失败
+	costScrape = routeCost{tokens: 10}
+	// costUpgrade 建立 WebSocket 连接后立即推送全部分组的快照
+	costUpgrade = routeCost{tokens: 10}
+)
+
+// throttleKey 被限流请求的统计维度
+type throttleKey struct {
+	route  string
+	reason string
+}
+
+type throttleCounter struct {
+	mu     sync.Mutex
+	counts map[throttleKey]uint64
+}
+
+var throttled = &throttleCounter{counts: make(map[throttleKey]uint64)}
+
+func (c *throttleCounter) inc(route, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[throttleKey{route: route, reason: reason}]++
+}
+
+// each 按路由和原因排序遍历，保持 /metrics 输出稳定
+func (c *throttleCounter) each(fn func(route, reason string, n uint64)) {
+	type entry struct {
+		throttleKey
+		n uint64
+	}
+	c.mu.Lock()
+	entries := make([]entry, 0, len(c.counts))
+	for k, n := range c.counts {
+		entries = append(entries, entry{k, n})
+	}
+	c.mu.Unlock()
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(cmp.Compare(a.route, b.route), cmp.Compare(a.reason, b.reason))
+	})
+	for _, e := range entries {
+		fn(e.route, e.reason, e.n)
+	}
+}
+
+// RateLimitMiddleware 按调用方扣除令牌，重型采集另外占用全局并发名额；超出时返回 429 和 Retry-After
+// 需要放在认证之后，调用方取自 auth.IdentityFrom
+func RateLimitMiddleware(cost routeCost, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := rateLimitKey(r)
+		if wait, ok := ratelimit.LIMITER.Allow(key, cost.tokens, time.Now()); !ok {
+			throttle(w, r, key, "rate", wait)
+			return
+		}
+		if cost.heavy {
+			if !ratelimit.HEAVY.Acquire(r.Context()) {
+				throttle(w, r, key, "concurrency", time.Second)
+				return
+			}
+			defer ratelimit.HEAVY.Release()
+		}
+		next(w, r)
+	}
+}
+
+// allowRequest 认证之前按来源 IP 扣除一个令牌，超出时返回 429；与 allowClient 一起在所有入口最先调用
+func allowRequest(w http.ResponseWriter, r *http.Request) bool {
+	key := "ip:" + ClientIP(r)
+	if wait, ok := ratelimit.CLIENTS.Allow(key, 1, time.Now()); !ok {
+		throttle(w, r, key, "client", wait)
+		return false
+	}
+	return true
+}
+
+// allowCost 认证之后按调用方扣除 cost 的令牌，不经过 RateLimitMiddleware 的入口（/ws）使用
+func allowCost(w http.ResponseWriter, r *http.Request, id *auth.Identity, cost routeCost) bool {
+	key := rateLimitKey(auth.WithIdentity(r, id))
+	if wait, ok := ratelimit.LIMITER.Allow(key, cost.tokens, time.Now()); !ok {
+		throttle(w, r, key, "rate", wait)
+		return false
+	}
+	return true
+}
+
+// rateLimitKey 令牌桶的键：API Key、登录用户和客户端证书按身份计算；
+// 匿名会话可以随意重新获取，与未认证的请求一样按来源 IP 计算
+func rateLimitKey(r *http.Request) string {
+	if id := auth.IdentityFrom(r); id != nil && id.Kind != auth.KindSession {
+		return id.String()
+	}
+	return "ip:" + ClientIP(r)
+}
+
+func throttle(w http.ResponseWriter, r *http.Request, key, reason string, wait time.Duration) {
+	route := cmp.Or(r.Pattern, r.URL.Path)
+	throttled.inc(route, reason)
+	retryAfter := max(1, int(math.Ceil(wait.Seconds())))
+	logx.Warn("[SECURITY] Request throttled | remote_ip: %s | path: %s | client: %s | reason: %s | retry_after: %ds", ClientIP(r), r.URL.Path, key, reason, retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	http.Error(w, "Too many requests", http.StatusTooManyRequests)
+}
@@ -0,0 +1,70 @@
+package handles
+
+import (
+	"chihqiang/hoststat/alert"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/notify"
+	"chihqiang/hoststat/psutil"
+	"chihqiang/hoststat/token"
+
+	"github.com/chihqiang/logx"
+)
+
+// ReloadConfig 应用重新加载的配置，调用方需已通过 config.Load 校验
+// 先读取并校验告警规则、会话存储与通知配置并创建新的组件，全部成功后再一起切换，切换过程不会失败；
+// 任一步失败时返回错误，当前配置继续生效
+// 采集、过滤、认证等设置每次使用时读取 config.Get()，切换后立即生效；已建立的 SSE/WebSocket 连接不受影响
+// 返回已生效的字段与需要重启才能生效（已忽略）的字段
+func ReloadConfig(cfg *config.Config) (changed, ignored []string, err error) {
+	old := config.Get()
+	ignored = cfg.KeepStartupValues(old)
+
+	var rules []*alert.Rule
+	if path := cfg.Alerts.RulesFile; path != "" {
+		if rules, err = alert.LoadRules(path, knownField); err != nil {
+			return nil, nil, err
+		}
+	}
+	sessions, err := token.Open(cfg.Token)
+	if err != nil {
+		return nil, nil, err
+	}
+	current := notifier.Load()
+	var next *notify.Notifier
+	if path := cfg.Notify.ConfigFile; path != "" {
+		notifyCfg, err := notify.LoadConfig(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if current != nil {
+			if dir := current.Config().OutboxDir; notifyCfg.OutboxDir != dir {
+				ignored = append(ignored, "notify.outboxDir")
+			}
+			next, err = current.Reconfigure(notifyCfg)
+		} else {
+			next, err = newNotifier(notifyCfg)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 全部组件已创建，开始切换
+	changed = config.Diff(old, cfg)
+	config.Set(cfg)
+	psutil.SetIntervals(collectIntervals(cfg))
+	token.Use(sessions)
+	alerts.SetRules(rules)
+	replaceNotifier(next)
+
+	if cfg.Alerts.RulesFile != "" {
+		logx.Info("Alert rules reloaded | file: %s | rules: %d", cfg.Alerts.RulesFile, len(rules))
+	}
+	switch {
+	case next != nil:
+		logx.Info("Alert notifier reloaded | file: %s | targets: %d | pending: %d", cfg.Notify.ConfigFile, len(next.Config().Targets), next.Pending())
+	case current != nil:
+		logx.Info("Alert notifier stopped | pending: %d", current.Pending())
+	}
+	return changed, ignored, nil
+}
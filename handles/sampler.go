@@ -0,0 +1,139 @@
+package handles
+
+import (
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/history"
+	"chihqiang/hoststat/psutil"
+	"chihqiang/hoststat/storage"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// Sampler 后台定时采集 CurrentInfo 并写入历史环形缓冲区，配置了存储目录时同时持久化到磁盘
+type Sampler struct {
+	resolution time.Duration
+	retention  time.Duration
+	history    *history.Ring[*CurrentInfo]
+	store      *storage.Store
+	wg         sync.WaitGroup
+
+	subscribers broadcaster
+}
+
+// sampler 在 StartSampler 中按 history 配置创建
+var sampler *Sampler
+
+func NewSampler(resolution, retention time.Duration) *Sampler {
+	if resolution <= 0 {
+		resolution = config.Default().History.Resolution.Std()
+	}
+	if retention < resolution {
+		retention = resolution
+	}
+	return &Sampler{
+		resolution: resolution,
+		retention:  retention,
+		history:    history.NewRing[*CurrentInfo](int(retention / resolution)),
+	}
+}
+
+// StartSampler 加载告警规则、启动告警通知与默认采集器，ctx 取消后退出
+// 配置 storage.dir 时打开磁盘存储，打开失败时返回错误
+func StartSampler(ctx context.Context) error {
+	cfg := config.Get()
+	psutil.SetIntervals(collectIntervals(cfg))
+	sampler = NewSampler(cfg.History.Resolution.Std(), cfg.History.Retention.Std())
+	if err := loadAlertRules(); err != nil {
+		return err
+	}
+	if err := startNotifier(ctx); err != nil {
+		return err
+	}
+	if dir := cfg.Storage.Dir; dir != "" {
+		opts := storage.DefaultOptions(dir)
+		opts.Resolution = sampler.resolution
+		opts.RawRetention = cfg.Storage.RawRetention.Std()
+		opts.MinuteRetention = cfg.Storage.MinuteRetention.Std()
+		opts.HourRetention = cfg.Storage.HourRetention.Std()
+		opts.MaxBytes = int64(cfg.Storage.MaxBytes)
+		store, err := storage.Open(opts)
+		if err != nil {
+			return err
+		}
+		sampler.store = store
+		logx.Info("Storage opened | dir: %s", dir)
+	}
+	logx.Info("History sampler starting | resolution: %s | retention: %s", sampler.resolution, sampler.retention)
+	sampler.wg.Add(1)
+	go func() {
+		defer sampler.wg.Done()
+		sampler.Run(ctx)
+	}()
+	return nil
+}
+
+// WaitSampler 等待采集器退出并关闭存储
+func WaitSampler() {
+	sampler.wg.Wait()
+	if sampler.store != nil {
+		if err := sampler.store.Close(); err != nil {
+			logx.Error("Storage close failed | error: %v", err)
+		}
+	}
+}
+
+func (s *Sampler) Run(ctx context.Context) {
+	s.sample()
+	ticker := time.NewTicker(s.resolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+func (s *Sampler) sample() {
+	info, err := getCurrentInfo()
+	if err != nil {
+		logx.Error("History sample failed | error: %v", err)
+		return
+	}
+	seq := s.history.Push(info.ShotTime, info)
+	s.subscribers.publish(history.Entry[*CurrentInfo]{Seq: seq, Time: info.ShotTime, Value: info})
+	fields := info.Fields()
+	if s.store != nil {
+		if err := s.store.Append(info.ShotTime, fields); err != nil {
+			logx.Error("Storage append failed | error: %v", err)
+		}
+	}
+	evaluateAlerts(info, fields)
+}
+
+// current 返回最新快照；采集器的最新快照已超过一个采样周期时才重新采集
+// 多个客户端同时访问时共享同一份采集结果
+func (s *Sampler) current() (*CurrentInfo, error) {
+	if entry, ok := s.history.Latest(); ok && time.Since(entry.Time) < s.resolution {
+		return entry.Value, nil
+	}
+	return getCurrentInfo()
+}
+
+// collectIntervals 将 collect 分组的配置转换为采集模块的缓存时间
+func collectIntervals(cfg *config.Config) psutil.Intervals {
+	c := cfg.Collect
+	return psutil.Intervals{
+		CPU:       c.CPUInterval.Std(),
+		CPUReset:  c.CPUResetInterval.Std(),
+		HostInfo:  c.HostInfoInterval.Std(),
+		DiskUsage: c.DiskUsageInterval.Std(),
+		Partition: c.PartitionInterval.Std(),
+		Interface: c.InterfaceInterval.Std(),
+	}
+}
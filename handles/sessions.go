@@ -0,0 +1,110 @@
+package handles
+
+import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/token"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// sessionRequest 会话管理请求体
+type sessionRequest struct {
+	SessionID string `json:"sid,omitempty"`   // revoke：要吊销的会话ID
+	All       bool   `json:"all,omitempty"`   // revoke：吊销全部会话（立即轮换密钥且不保留旧密钥）
+	Grace     string `json:"grace,omitempty"` // rotate：旧密钥继续有效的时间，默认 token.rotateGrace
+}
+
+type sessionResponse struct {
+	Status    string `json:"status"`
+	KeyID     string `json:"keyId,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+}
+
+// HandlerSessionRotate 立即轮换会话签名密钥：POST /sessions/rotate {"grace":"1h"}
+func HandlerSessionRotate(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r) {
+		recordAudit(r, "session.rotate", audit.OutcomeDenied, "", nil, nil)
+		return
+	}
+	var req sessionRequest
+	if !decodeSessionRequest(w, r, &req) {
+		return
+	}
+	grace := config.Get().Token.RotateGrace.Std()
+	if req.Grace != "" {
+		d, err := time.ParseDuration(req.Grace)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid grace", http.StatusBadRequest)
+			return
+		}
+		grace = d
+	}
+	keyID, err := token.Rotate(grace)
+	if err != nil {
+		recordAudit(r, "session.rotate", audit.OutcomeFailure, "", err, nil)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	logx.Info("[AUDIT] Session key rotated | remote_ip: %s | caller: %s | key_id: %s | grace: %s", ClientIP(r), caller(r), keyID, grace)
+	recordAudit(r, "session.rotate", audit.OutcomeSuccess, "", nil, map[string]any{"keyId": keyID, "grace": grace.String()})
+	writeSessionResponse(w, r, sessionResponse{Status: "rotated", KeyID: keyID})
+}
+
+// HandlerSessionRevoke 吊销会话：POST /sessions/revoke {"sid":"..."} 或 {"all":true}
+func HandlerSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	if !checkAdmin(w, r) {
+		recordAudit(r, "session.revoke", audit.OutcomeDenied, "", nil, nil)
+		return
+	}
+	var req sessionRequest
+	if !decodeSessionRequest(w, r, &req) {
+		return
+	}
+	switch {
+	case req.All:
+		keyID, err := token.Rotate(0)
+		if err != nil {
+			recordAudit(r, "session.revoke", audit.OutcomeFailure, "", err, map[string]any{"all": true})
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		logx.Info("[AUDIT] All sessions revoked | remote_ip: %s | caller: %s | key_id: %s", ClientIP(r), caller(r), keyID)
+		recordAudit(r, "session.revoke", audit.OutcomeSuccess, "", nil, map[string]any{"all": true, "keyId": keyID})
+		writeSessionResponse(w, r, sessionResponse{Status: "revoked", KeyID: keyID})
+	case req.SessionID != "":
+		if err := token.Revoke(req.SessionID, time.Time{}); err != nil {
+			logx.Error("Revoke session failed | sid: %s | error: %v", req.SessionID, err)
+			recordAudit(r, "session.revoke", audit.OutcomeFailure, "", err, map[string]any{"sid": req.SessionID})
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+		logx.Info("[AUDIT] Session revoked | remote_ip: %s | caller: %s | sid: %s", ClientIP(r), caller(r), req.SessionID)
+		recordAudit(r, "session.revoke", audit.OutcomeSuccess, "", nil, map[string]any{"sid": req.SessionID})
+		writeSessionResponse(w, r, sessionResponse{Status: "revoked", SessionID: req.SessionID})
+	default:
+		http.Error(w, "sid or all is required", http.StatusBadRequest)
+	}
+}
+
+func decodeSessionRequest(w http.ResponseWriter, r *http.Request, req *sessionRequest) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxActionBodyBytes)).Decode(req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeSessionResponse(w http.ResponseWriter, r *http.Request, resp sessionResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logx.Error("Failed to encode session response JSON | remote_ip: %s | error: %v", ClientIP(r), err)
+	}
+}
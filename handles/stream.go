@@ -0,0 +1,100 @@
+package handles
+
+import (
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/history"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// HandlerStream 通过 Server-Sent Events 推送采集器的实时快照
+// 客户端重连时携带 Last-Event-ID（或 lastEventId 参数），从历史缓冲区补发错过的快照
+func HandlerStream(w http.ResponseWriter, r *http.Request) {
+	cfg := config.Get().Stream
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// 先订阅再补发，避免两者之间产生的快照丢失
+	sub := sampler.subscribers.subscribe()
+	defer sampler.subscribers.unsubscribe(sub)
+
+	remoteIP := ClientIP(r)
+	send := func(format string, args ...any) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout.Std())); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	var lastSent uint64
+	sendEntry := func(entry history.Entry[*CurrentInfo]) error {
+		data, err := json.Marshal(entry.Value)
+		if err != nil {
+			return err
+		}
+		lastSent = entry.Seq
+		return send("id: %d\nevent: current\ndata: %s\n\n", entry.Seq, data)
+	}
+
+	if err := send("retry: %d\n\n", cfg.Retry.Std().Milliseconds()); err != nil {
+		logx.Error("SSE stream setup failed | remote_ip: %s | error: %v", remoteIP, err)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	if seq, err := strconv.ParseUint(lastEventID, 10, 64); err == nil {
+		entries, complete := sampler.history.Since(seq)
+		if !complete {
+			// 请求的位置已被覆盖或无效，通知客户端数据不连续
+			if err := send("event: reset\ndata: {}\n\n"); err != nil {
+				return
+			}
+		}
+		for _, entry := range entries {
+			if err := sendEntry(entry); err != nil {
+				return
+			}
+		}
+	} else if entry, ok := sampler.history.Latest(); ok {
+		if err := sendEntry(entry); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(cfg.Heartbeat.Std())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			if dropped := sub.dropped.Load(); dropped > 0 {
+				logx.Debug("SSE client disconnected | remote_ip: %s | dropped: %d", remoteIP, dropped)
+			}
+			return
+		case <-heartbeat.C:
+			if err := send(": ping %d\n\n", time.Now().Unix()); err != nil {
+				return
+			}
+		case entry := <-sub.ch:
+			if entry.Seq <= lastSent {
+				continue
+			}
+			if err := sendEntry(entry); err != nil {
+				return
+			}
+		}
+	}
+}
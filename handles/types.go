@@ -1,6 +1,9 @@
 package handles
 
-import "time"
+import (
+	"chihqiang/hoststat/psutil"
+	"time"
+)
 
 const (
 	DateTimeLayout = "2006-01-02 15:04:05" // or use time.DateTime while go version >= 1.20
@@ -36,6 +39,9 @@ type CurrentInfo struct {
 	CPUTotal           int       `json:"cpuTotal"`
 	CPUDetailedPercent []float64 `json:"cpuDetailedPercent"`
 
+	CPUDetailed        psutil.CPUDetailedPercent   `json:"cpuDetailed"`        // 总体CPU时间占比
+	CPUPerCoreDetailed []psutil.CPUDetailedPercent `json:"cpuPerCoreDetailed"` // 每个核心的CPU时间占比
+
 	Load1            float64 `json:"load1"`
 	Load5            float64 `json:"load5"`
 	Load15           float64 `json:"load15"`
@@ -62,9 +68,15 @@ type CurrentInfo struct {
 	IOReadTime   uint64 `json:"ioReadTime"`
 	IOWriteTime  uint64 `json:"ioWriteTime"`
 
+	DiskIO []DiskIOInfo `json:"diskIO"`
+
 	NetBytesSent uint64 `json:"netBytesSent"`
 	NetBytesRecv uint64 `json:"netBytesRecv"`
 
+	NetBytesSentRate float64                   `json:"netBytesSentRate"` // 未被过滤网卡的发送速率合计（字节/秒）
+	NetBytesRecvRate float64                   `json:"netBytesRecvRate"` // 未被过滤网卡的接收速率合计（字节/秒）
+	NetInterfaces    []psutil.NetInterfaceStat `json:"netInterfaces"`
+
 	ShotTime time.Time `json:"shotTime"`
 }
 
@@ -81,6 +93,14 @@ type DiskInfo struct {
 	InodesUsed        uint64  `json:"inodesUsed"`
 	InodesFree        uint64  `json:"inodesFree"`
 	InodesUsedPercent float64 `json:"inodesUsedPercent"`
+
+	IODevice string `json:"ioDevice"` // 对应 DiskIO 中的设备名，未找到时为空
+}
+
+// DiskIOInfo 块设备I/O统计及其上的挂载点
+type DiskIOInfo struct {
+	psutil.DiskIOStat
+	Mounts []string `json:"mounts"`
 }
 type diskInfo struct {
 	Type   string
@@ -1,11 +1,13 @@
 package handles
 
 import (
+	"chihqiang/hoststat/config"
 	"chihqiang/hoststat/psutil"
 	"cmp"
-	"github.com/shirou/gopsutil/v4/process"
 	"net"
 	"os"
+	"path"
+	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
@@ -41,16 +43,41 @@ func getBaseInfo() (*BaseInfo, error) {
 	cpuInfo, err := psutil.CPUInfo.GetCPUInfo(false)
 	if err == nil && len(cpuInfo) > 0 {
 		bi.CPUModelName = cpuInfo[0].ModelName
+		bi.CPUMhz = cpuInfo[0].Mhz
 	}
 	bi.CPUCores, _ = psutil.CPUInfo.GetPhysicalCores(false)
 	bi.CPULogicalCores, _ = psutil.CPUInfo.GetLogicalCores(false)
-	bi.CPUMhz = cpuInfo[0].Mhz
 
-	currentInfo, _ := getCurrentInfo()
+	currentInfo, _ := sampler.current()
 	bi.CurrentInfo = currentInfo
 	return &bi, nil
 }
 
+// baseInfoTTL 主机名、出口地址等静态信息的缓存时间
+const baseInfoTTL = time.Minute
+
+var baseInfoCache struct {
+	mu      sync.Mutex
+	info    BaseInfo
+	expires time.Time
+}
+
+// cachedBaseInfo 供 /metrics 每次抓取使用：静态信息在 baseInfoTTL 内复用，不再每次拨号获取出口地址；CurrentInfo 取自采样器
+func cachedBaseInfo() (*BaseInfo, error) {
+	baseInfoCache.mu.Lock()
+	defer baseInfoCache.mu.Unlock()
+	if time.Now().After(baseInfoCache.expires) {
+		info, err := getBaseInfo()
+		if err != nil {
+			return nil, err
+		}
+		baseInfoCache.info, baseInfoCache.expires = *info, time.Now().Add(baseInfoTTL)
+	}
+	bi := baseInfoCache.info
+	bi.CurrentInfo, _ = sampler.current()
+	return &bi, nil
+}
+
 func getCurrentInfo() (*CurrentInfo, error) {
 	var currentInfo CurrentInfo
 	hostInfo, _ := psutil.HOST.GetHostInfo(false)
@@ -58,16 +85,18 @@ func getCurrentInfo() (*CurrentInfo, error) {
 	currentInfo.TimeSinceUptime = time.Unix(int64(hostInfo.BootTime), 0).Format(DateTimeLayout)
 	currentInfo.Procs = hostInfo.Procs
 	currentInfo.CPUTotal, _ = psutil.CPUInfo.GetLogicalCores(false)
-	cpuUsedPercent, perCore, cpuDetailedPercent := psutil.CPU.GetCPUUsage()
-	if len(perCore) == 0 {
+	cpuUsage := psutil.CPU.GetCPUUsageDetail()
+	if len(cpuUsage.PerCore) == 0 {
 		currentInfo.CPUTotal = psutil.CPU.NumCPU()
 	} else {
-		currentInfo.CPUTotal = len(perCore)
+		currentInfo.CPUTotal = len(cpuUsage.PerCore)
 	}
-	currentInfo.CPUPercent = perCore
-	currentInfo.CPUUsedPercent = cpuUsedPercent
-	currentInfo.CPUUsed = cpuUsedPercent * 0.01 * float64(currentInfo.CPUTotal)
-	currentInfo.CPUDetailedPercent = cpuDetailedPercent
+	currentInfo.CPUPercent = cpuUsage.PerCore
+	currentInfo.CPUUsedPercent = cpuUsage.TotalPercent
+	currentInfo.CPUUsed = cpuUsage.TotalPercent * 0.01 * float64(currentInfo.CPUTotal)
+	currentInfo.CPUDetailedPercent = cpuUsage.Detailed.GetCPUDetailedPercent()
+	currentInfo.CPUDetailed = cpuUsage.Detailed
+	currentInfo.CPUPerCoreDetailed = cpuUsage.PerCoreDetailed
 
 	loadInfo, _ := load.Avg()
 	currentInfo.Load1 = loadInfo.Load1
@@ -92,123 +121,92 @@ func getCurrentInfo() (*CurrentInfo, error) {
 
 	currentInfo.DiskData = loadDiskInfo()
 
-	diskInfos, _ := disk.IOCounters()
-	for _, state := range diskInfos {
+	diskIOStats, _ := psutil.DISKIO.GetIOStats()
+	for _, state := range diskIOStats {
 		currentInfo.IOReadBytes += state.ReadBytes
 		currentInfo.IOWriteBytes += state.WriteBytes
 		currentInfo.IOCount += state.ReadCount + state.WriteCount
 		currentInfo.IOReadTime += state.ReadTime
 		currentInfo.IOWriteTime += state.WriteTime
 	}
+	currentInfo.DiskIO = linkDiskIO(diskIOStats, currentInfo.DiskData)
 
 	netInfos, _ := psNet.IOCounters(false)
 	if len(netInfos) != 0 {
 		currentInfo.NetBytesSent = netInfos[0].BytesSent
 		currentInfo.NetBytesRecv = netInfos[0].BytesRecv
 	}
+	currentInfo.NetInterfaces = loadNetInterfaces()
+	for _, iface := range currentInfo.NetInterfaces {
+		currentInfo.NetBytesSentRate += iface.BytesSentRate
+		currentInfo.NetBytesRecvRate += iface.BytesRecvRate
+	}
 	currentInfo.ShotTime = time.Now()
 	return &currentInfo, nil
 }
 
-func loadTopCPU() []ProcessInfo {
-	processes, err := process.Processes()
+func loadNetInterfaces() []psutil.NetInterfaceStat {
+	stats, err := psutil.NET.GetInterfaceStats()
 	if err != nil {
-		return nil
+		return []psutil.NetInterfaceStat{}
+	}
+	filtered := make([]psutil.NetInterfaceStat, 0, len(stats))
+	for _, stat := range stats {
+		if !matchAny(config.Get().Net.Exclude, stat.Name) {
+			filtered = append(filtered, stat)
+		}
 	}
+	return filtered
+}
 
-	top5 := make([]ProcessInfo, 0, 5)
-	for _, p := range processes {
-		percent, err := p.CPUPercent()
-		if err != nil {
+// linkDiskIO 过滤块设备，并通过设备名与 DiskData 中的挂载点互相关联
+func linkDiskIO(stats []psutil.DiskIOStat, disks []DiskInfo) []DiskIOInfo {
+	infos := make([]DiskIOInfo, 0, len(stats))
+	index := make(map[string]int, len(stats))
+	for _, stat := range stats {
+		if matchAny(config.Get().Disk.IOExclude, stat.Name) {
 			continue
 		}
-		minIndex := 0
-		if len(top5) >= 5 {
-			minCPU := top5[0].Percent
-			for i := 1; i < len(top5); i++ {
-				if top5[i].Percent < minCPU {
-					minCPU = top5[i].Percent
-					minIndex = i
-				}
-			}
-			if percent < minCPU {
-				continue
-			}
-		}
-		name, err := p.Name()
-		if err != nil {
-			name = "undifine"
-		}
-		cmd, err := p.Cmdline()
-		if err != nil {
-			cmd = "undifine"
+		index[stat.Name] = len(infos)
+		if stat.Label != "" {
+			index[stat.Label] = len(infos)
 		}
-		user, err := p.Username()
-		if err != nil {
-			user = "undifine"
+		infos = append(infos, DiskIOInfo{DiskIOStat: stat, Mounts: []string{}})
+	}
+	for i := range disks {
+		name := blockDeviceName(disks[i].Device)
+		j, ok := index[name]
+		if !ok {
+			// device-mapper 设备在 diskstats 中为 dm-N，通过 Label 匹配 /dev/mapper/<name>
+			j, ok = index[filepath.Base(disks[i].Device)]
 		}
-		if len(top5) == 5 {
-			top5[minIndex] = ProcessInfo{Percent: percent, Pid: p.Pid, User: user, Name: name, Cmd: cmd}
-		} else {
-			top5 = append(top5, ProcessInfo{Percent: percent, Pid: p.Pid, User: user, Name: name, Cmd: cmd})
+		if !ok {
+			continue
 		}
+		disks[i].IODevice = infos[j].Name
+		infos[j].Mounts = append(infos[j].Mounts, disks[i].Path)
 	}
-	sort.Slice(top5, func(i, j int) bool {
-		return top5[i].Percent > top5[j].Percent
-	})
-
-	return top5
+	return infos
 }
 
-func loadTopMem() []ProcessInfo {
-	processes, err := process.Processes()
-	if err != nil {
-		return nil
+// blockDeviceName 将 /dev/mapper/xxx、/dev/disk/by-uuid/xxx 等路径解析为内核块设备名
+func blockDeviceName(device string) string {
+	if !strings.HasPrefix(device, "/dev/") {
+		return ""
 	}
-	top5 := make([]ProcessInfo, 0, 5)
-	for _, p := range processes {
-		stat, err := p.MemoryInfo()
-		if err != nil {
-			continue
-		}
-		memItem := stat.RSS
-		minIndex := 0
-		if len(top5) >= 5 {
-			min := top5[0].Memory
-			for i := 1; i < len(top5); i++ {
-				if top5[i].Memory < min {
-					min = top5[i].Memory
-					minIndex = i
-				}
-			}
-			if memItem < min {
-				continue
-			}
-		}
-		name, err := p.Name()
-		if err != nil {
-			name = "undifine"
-		}
-		cmd, err := p.Cmdline()
-		if err != nil {
-			cmd = "undifine"
-		}
-		user, err := p.Username()
-		if err != nil {
-			user = "undifine"
-		}
-		percent, _ := p.MemoryPercent()
-		if len(top5) == 5 {
-			top5[minIndex] = ProcessInfo{Percent: float64(percent), Pid: p.Pid, User: user, Name: name, Cmd: cmd, Memory: memItem}
-		} else {
-			top5 = append(top5, ProcessInfo{Percent: float64(percent), Pid: p.Pid, User: user, Name: name, Cmd: cmd, Memory: memItem})
-		}
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
 	}
+	return filepath.Base(device)
+}
 
-	sort.Slice(top5, func(i, j int) bool {
-		return top5[i].Memory > top5[j].Memory
-	})
-	return top5
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func loadDiskInfo() []DiskInfo {
@@ -221,27 +219,8 @@ func loadDiskInfo() []DiskInfo {
 	}
 
 	var mounts []diskInfo
-	var excludes = []string{
-		"/mnt/cdrom",
-		"/boot",
-		"/boot/efi",
-		"/dev",
-		"/dev/shm",
-		"/run/lock",
-		"/run",
-		"/run/shm",
-		"/run/user",
-		"/snap",
-	}
-	var excludesType = []string{
-		"tmpfs",
-		"overlay",
-		"proc",
-		"cgroup",
-		"sysfs",
-		"mqueue",
-		"devpts",
-	}
+	cfg := config.Get()
+	excludes, excludesType := cfg.Disk.ExcludeMounts, cfg.Disk.ExcludeTypes
 
 	// 过滤分区
 	for _, partition := range partitions {
@@ -251,8 +230,8 @@ func loadDiskInfo() []DiskInfo {
 		if slices.Contains(excludes, partition.Mountpoint) {
 			continue
 		}
-		// 跳过挂载点路径太深的分区（>10个斜杠）
-		if len(strings.Split(partition.Mountpoint, "/")) > 10 {
+		// 跳过挂载点路径太深的分区
+		if len(strings.Split(partition.Mountpoint, "/")) > cfg.Disk.MaxMountDepth {
 			continue
 		}
 		mounts = append(mounts, diskInfo{Type: partition.Fstype, Device: partition.Device, Mount: partition.Mountpoint})
@@ -284,7 +263,7 @@ func loadDiskInfo() []DiskInfo {
 			}()
 
 			select {
-			case <-time.After(5 * time.Second):
+			case <-time.After(cfg.Collect.DiskUsageTimeout.Std()):
 				mu.Lock()
 				datas = append(datas, itemData)
 				mu.Unlock()
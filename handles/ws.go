@@ -0,0 +1,358 @@
+package handles
+
+import (
+	"bytes"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"chihqiang/hoststat/ratelimit"
+	"chihqiang/hoststat/token"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+	"github.com/gorilla/websocket"
+)
+
+const wsMaxMessageSize = 4096
+
+// 可订阅的指标分组
+const (
+	wsGroupCPU       = "cpu"
+	wsGroupMemory    = "memory"
+	wsGroupDisks     = "disks"
+	wsGroupNet       = "net"
+	wsGroupProcesses = "processes"
+)
+
+var wsGroups = []string{wsGroupCPU, wsGroupMemory, wsGroupDisks, wsGroupNet, wsGroupProcesses}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// 浏览器握手必须与 Host 同源；客户端证书、API Key 等非浏览器客户端通常不发送 Origin
+	CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "" || token.SameOrigin(r) == nil },
+}
+
+// wsRequest 客户端消息：{"type":"subscribe","groups":["cpu"],"interval":"5s"}
+type wsRequest struct {
+	Type     string   `json:"type"`
+	Groups   []string `json:"groups"`
+	Interval string   `json:"interval"`
+}
+
+// wsResponse 服务端消息；首次推送为 snapshot，之后只推送发生变化的字段（delta）
+type wsResponse struct {
+	Type     string                     `json:"type"`
+	Group    string                     `json:"group,omitempty"`
+	Seq      uint64                     `json:"seq,omitempty"`
+	Time     *time.Time                 `json:"time,omitempty"`
+	Data     map[string]json.RawMessage `json:"data,omitempty"`
+	Groups   []string                   `json:"groups,omitempty"`
+	Interval string                     `json:"interval,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+}
+
+// wsSubscription 一个分组的订阅状态
+type wsSubscription struct {
+	interval time.Duration
+	lastSent time.Time
+	last     map[string]json.RawMessage
+}
+
+// HandlerWS WebSocket 接口，客户端按分组订阅实时数据，数据来自与 /current 相同的采集器
+func HandlerWS(w http.ResponseWriter, r *http.Request) {
+	id, ok := validateUpgrade(w, r)
+	if !ok || !allowCost(w, r, id, costUpgrade) {
+		return
+	}
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logx.Warn("WebSocket upgrade failed | remote_ip: %s | error: %v", ClientIP(r), err)
+		return
+	}
+	defer conn.Close()
+
+	sub := sampler.subscribers.subscribe()
+	defer sampler.subscribers.unsubscribe(sub)
+
+	cfg := config.Get().WS
+	requests := make(chan wsRequest)
+	done := make(chan struct{})
+	go wsReadLoop(conn, cfg, requests, done)
+
+	// 没有 processes:read 权限的 API Key 不能订阅进程分组
+	available := slices.DeleteFunc(slices.Clone(wsGroups), func(group string) bool {
+		return group == wsGroupProcesses && !id.Allows(auth.ScopeProcessesRead)
+	})
+	subscriptions := make(map[string]*wsSubscription)
+	ping := time.NewTicker(cfg.PingInterval.Std())
+	defer ping.Stop()
+
+	write := func(resp wsResponse) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(cfg.WriteTimeout.Std()))
+		return conn.WriteJSON(resp)
+	}
+	// 按采样时间判断是否到期，并留出半个采样间隔的余量，避免采集抖动使整数倍的间隔多跳过一次采样
+	tolerance := sampler.resolution / 2
+	push := func(info *CurrentInfo, seq uint64, force bool) error {
+		for _, group := range wsGroups {
+			s, ok := subscriptions[group]
+			if !ok || (!force && info.ShotTime.Sub(s.lastSent) < s.interval-tolerance) {
+				continue
+			}
+			resp, changed := s.diff(group, wsGroupData(r.Context(), group, info))
+			if !changed {
+				continue
+			}
+			s.lastSent = info.ShotTime
+			resp.Seq = seq
+			resp.Time = &info.ShotTime
+			if err := write(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cfg.WriteTimeout.Std())); err != nil {
+				return
+			}
+		case req := <-requests:
+			resp, added := handleWSRequest(subscriptions, available, req)
+			if err := write(resp); err != nil {
+				return
+			}
+			// 新订阅的分组立即推送一次完整快照
+			if added {
+				if entry, ok := sampler.history.Latest(); ok {
+					if err := push(entry.Value, entry.Seq, true); err != nil {
+						return
+					}
+				}
+			}
+		case entry := <-sub.ch:
+			if err := push(entry.Value, entry.Seq, false); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// validateUpgrade 浏览器校验 Cookie、Origin 与登录状态；拥有 metrics:read 权限的客户端证书（mTLS）
+// 或 API Key 无需 Cookie。校验失败时写入错误响应
+func validateUpgrade(w http.ResponseWriter, r *http.Request) (*auth.Identity, bool) {
+	if id, ok := certIdentity(r); ok {
+		if !id.Allows(auth.ScopeMetricsRead) {
+			denyScope(w, r, id, auth.ScopeMetricsRead)
+			return nil, false
+		}
+		return id, true
+	}
+	if value, ok := bearerAPIKey(r); ok {
+		return authenticateAPIKey(w, r, value, auth.ScopeMetricsRead)
+	}
+	claims, err := token.ValidateUpgrade(r)
+	if err == nil {
+		err = checkUser(claims)
+	}
+	if err != nil {
+		logx.Warn(
+			"[SECURITY] WebSocket token validation failed | remote_ip: %s | path: %s | error: %v | timestamp: %s",
+			ClientIP(r),
+			r.URL.Path,
+			err,
+			time.Now().Format("2006-01-02 15:04:05.000"),
+		)
+		recordFailure(r, "token.invalid", err)
+		http.Error(w, "Token validation failed", http.StatusForbidden)
+		return nil, false
+	}
+	return sessionIdentity(claims), true
+}
+
+// wsReadLoop 读取客户端消息并处理 pong，连接断开后关闭 done
+func wsReadLoop(conn *websocket.Conn, cfg config.WSConfig, requests chan<- wsRequest, done chan<- struct{}) {
+	defer close(done)
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout.Std()))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout.Std()))
+	})
+	for {
+		var req wsRequest
+		if err := conn.ReadJSON(&req); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logx.Debug("WebSocket closed | remote_ip: %s | error: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(cfg.PongTimeout.Std()))
+		select {
+		case requests <- req:
+		case <-time.After(cfg.WriteTimeout.Std()):
+			return
+		}
+	}
+}
+
+// handleWSRequest 处理订阅/取消订阅，返回应答以及是否新增了订阅
+func handleWSRequest(subscriptions map[string]*wsSubscription, available []string, req wsRequest) (wsResponse, bool) {
+	groups := req.Groups
+	for _, group := range groups {
+		if !slices.Contains(available, group) {
+			return wsResponse{Type: "error", Error: fmt.Sprintf("unknown group %q, available: %v", group, available)}, false
+		}
+	}
+	switch req.Type {
+	case "subscribe":
+		interval := sampler.resolution
+		if req.Interval != "" {
+			d, err := time.ParseDuration(req.Interval)
+			if err != nil || d <= 0 || d > config.Get().WS.MaxInterval.Std() {
+				return wsResponse{Type: "error", Error: "invalid interval"}, false
+			}
+			// 数据每个采样周期才更新一次，更短的间隔没有意义
+			interval = max(d, sampler.resolution)
+		}
+		if len(groups) == 0 {
+			groups = available
+		}
+		for _, group := range groups {
+			if s, ok := subscriptions[group]; ok {
+				s.interval = interval
+				continue
+			}
+			subscriptions[group] = &wsSubscription{interval: interval}
+		}
+		return wsResponse{Type: "subscribed", Groups: groups, Interval: interval.String()}, true
+	case "unsubscribe":
+		if len(groups) == 0 {
+			groups = available
+		}
+		for _, group := range groups {
+			delete(subscriptions, group)
+		}
+		return wsResponse{Type: "unsubscribed", Groups: groups}, false
+	}
+	return wsResponse{Type: "error", Error: fmt.Sprintf("unknown message type %q", req.Type)}, false
+}
+
+// diff 比较分组数据与上次发送的内容，首次返回完整快照，之后只返回变化的字段
+func (s *wsSubscription) diff(group string, data map[string]any) (wsResponse, bool) {
+	current := make(map[string]json.RawMessage, len(data))
+	for key, value := range data {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			continue
+		}
+		current[key] = raw
+	}
+	if s.last == nil {
+		s.last = current
+		return wsResponse{Type: "snapshot", Group: group, Data: current}, true
+	}
+	changed := make(map[string]json.RawMessage)
+	for key, raw := range current {
+		if !bytes.Equal(s.last[key], raw) {
+			changed[key] = raw
+		}
+	}
+	s.last = current
+	if len(changed) == 0 {
+		return wsResponse{}, false
+	}
+	return wsResponse{Type: "delta", Group: group, Data: changed}, true
+}
+
+// wsGroupData 从快照中取出分组对应的字段，字段名与 /current 保持一致
+func wsGroupData(ctx context.Context, group string, info *CurrentInfo) map[string]any {
+	switch group {
+	case wsGroupCPU:
+		return map[string]any{
+			"uptime":             info.Uptime,
+			"procs":              info.Procs,
+			"cpuPercent":         info.CPUPercent,
+			"cpuUsedPercent":     info.CPUUsedPercent,
+			"cpuUsed":            info.CPUUsed,
+			"cpuTotal":           info.CPUTotal,
+			"cpuDetailed":        info.CPUDetailed,
+			"cpuPerCoreDetailed": info.CPUPerCoreDetailed,
+			"load1":              info.Load1,
+			"load5":              info.Load5,
+			"load15":             info.Load15,
+			"loadUsagePercent":   info.LoadUsagePercent,
+		}
+	case wsGroupMemory:
+		return map[string]any{
+			"memoryTotal":           info.MemoryTotal,
+			"memoryUsed":            info.MemoryUsed,
+			"memoryFree":            info.MemoryFree,
+			"memoryShard":           info.MemoryShard,
+			"memoryCache":           info.MemoryCache,
+			"memoryAvailable":       info.MemoryAvailable,
+			"memoryUsedPercent":     info.MemoryUsedPercent,
+			"swapMemoryTotal":       info.SwapMemoryTotal,
+			"swapMemoryAvailable":   info.SwapMemoryAvailable,
+			"swapMemoryUsed":        info.SwapMemoryUsed,
+			"swapMemoryUsedPercent": info.SwapMemoryUsedPercent,
+		}
+	case wsGroupDisks:
+		return map[string]any{
+			"diskData":     info.DiskData,
+			"ioReadBytes":  info.IOReadBytes,
+			"ioWriteBytes": info.IOWriteBytes,
+			"ioCount":      info.IOCount,
+			"ioReadTime":   info.IOReadTime,
+			"ioWriteTime":  info.IOWriteTime,
+			"diskIO":       info.DiskIO,
+		}
+	case wsGroupNet:
+		return map[string]any{
+			"netBytesSent":     info.NetBytesSent,
+			"netBytesRecv":     info.NetBytesRecv,
+			"netBytesSentRate": info.NetBytesSentRate,
+			"netBytesRecvRate": info.NetBytesRecvRate,
+			"netInterfaces":    info.NetInterfaces,
+		}
+	case wsGroupProcesses:
+		topCPU, topMem := topProcesses.get(ctx)
+		return map[string]any{
+			"topCpu": topCPU,
+			"topMem": topMem,
+		}
+	}
+	return nil
+}
+
+// topProcessCache 多个 WebSocket 客户端共享的进程排行缓存
+type topProcessCache struct {
+	mu      sync.Mutex
+	updated time.Time
+	topCPU  []ProcessInfo
+	topMem  []ProcessInfo
+}
+
+var topProcesses = &topProcessCache{}
+
+// get 缓存过期时遍历进程表，与 /top/*/ps 一样占用 ratelimit.HEAVY 的名额；名额已满时继续使用旧的排行
+func (c *topProcessCache) get(ctx context.Context) ([]ProcessInfo, []ProcessInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.updated) >= config.Get().Processes.TopCacheInterval.Std() && ratelimit.HEAVY.Acquire(ctx) {
+		c.topCPU = loadTopCPU()
+		c.topMem = loadTopMem()
+		c.updated = time.Now()
+		ratelimit.HEAVY.Release()
+	}
+	return c.topCPU, c.topMem
+}
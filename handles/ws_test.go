@@ -0,0 +1,31 @@
+package handles
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWSCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"same origin", "https://hoststat.example.com", true},
+		{"no origin from a machine client", "", true},
+		{"cross site", "https://evil.example.com", false},
+		{"same host on another port", "https://hoststat.example.com:8443", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://hoststat.example.com/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := wsUpgrader.CheckOrigin(r); got != tt.want {
+				t.Fatalf("CheckOrigin = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package history
+
+import (
+	"math"
+	"time"
+)
+
+// Sample 一个时间点上的若干数值指标
+type Sample struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// Point 降采样后的一个时间桶
+type Point struct {
+	Time  time.Time `json:"time"`
+	Min   float64   `json:"min"`
+	Avg   float64   `json:"avg"`
+	Max   float64   `json:"max"`
+	Count int       `json:"count"`
+}
+
+// Series 单个字段的降采样序列
+type Series struct {
+	Field  string  `json:"field"`
+	Points []Point `json:"points"`
+}
+
+// Downsample 将样本按 step 划分时间桶，计算每个桶内各字段的 min/avg/max
+// 桶按 step 整数倍对齐；没有样本的桶不输出
+func Downsample(samples []Sample, from, to time.Time, step time.Duration, fields []string) []Series {
+	if step <= 0 {
+		step = time.Second
+	}
+	origin := from.Truncate(step)
+	series := make([]Series, 0, len(fields))
+	for _, field := range fields {
+		var points []Point
+		bucketIndex := int64(-1)
+		var current Point
+		var sum float64
+		flush := func() {
+			if current.Count > 0 {
+				current.Avg = sum / float64(current.Count)
+				points = append(points, current)
+			}
+		}
+		for _, sample := range samples {
+			if sample.Time.Before(from) || sample.Time.After(to) {
+				continue
+			}
+			value, ok := sample.Values[field]
+			if !ok || math.IsNaN(value) {
+				continue
+			}
+			idx := int64(sample.Time.Sub(origin) / step)
+			if idx != bucketIndex {
+				flush()
+				bucketIndex = idx
+				current = Point{Time: origin.Add(time.Duration(idx) * step), Min: value, Max: value}
+				sum = 0
+			}
+			current.Min = math.Min(current.Min, value)
+			current.Max = math.Max(current.Max, value)
+			current.Count++
+			sum += value
+		}
+		flush()
+		if points == nil {
+			points = []Point{}
+		}
+		series = append(series, Series{Field: field, Points: points})
+	}
+	return series
+}
+
+// MergePoints 将已经聚合过的点按 step 再次聚合，用于从汇总数据生成更粗的序列
+// origin 为桶的对齐起点
+func MergePoints(points []Point, origin time.Time, step time.Duration) []Point {
+	merged := make([]Point, 0)
+	if step <= 0 {
+		return append(merged, points...)
+	}
+	bucketIndex := int64(-1)
+	var current Point
+	var sum float64
+	flush := func() {
+		if current.Count > 0 {
+			current.Avg = sum / float64(current.Count)
+			merged = append(merged, current)
+		}
+	}
+	for _, p := range points {
+		if p.Count == 0 {
+			continue
+		}
+		idx := int64(p.Time.Sub(origin) / step)
+		if idx != bucketIndex {
+			flush()
+			bucketIndex = idx
+			current = Point{Time: origin.Add(time.Duration(idx) * step), Min: p.Min, Max: p.Max}
+			sum = 0
+		}
+		current.Min = math.Min(current.Min, p.Min)
+		current.Max = math.Max(current.Max, p.Max)
+		current.Count += p.Count
+		sum += p.Avg * float64(p.Count)
+	}
+	flush()
+	return merged
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry 环形缓冲区中的一条记录，Seq 单调递增，可用于断点续传
+type Entry[T any] struct {
+	Seq   uint64
+	Time  time.Time
+	Value T
+}
+
+// Ring 固定容量的环形缓冲区，写满后覆盖最旧的记录；底层数组随写入逐步增长，不预先分配
+type Ring[T any] struct {
+	mu       sync.RWMutex
+	buf      []Entry[T]
+	capacity int
+	start    int
+	size     int
+	seq      uint64
+}
+
+func NewRing[T any](capacity int) *Ring[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring[T]{capacity: capacity}
+}
+
+// Push 追加一条记录并返回其序号
+func (r *Ring[T]) Push(t time.Time, v T) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	entry := Entry[T]{Seq: r.seq, Time: t, Value: v}
+	if r.size < r.capacity {
+		// 未写满前 start 始终为 0，直接追加
+		r.buf = append(r.buf, entry)
+		r.size++
+	} else {
+		r.buf[r.start] = entry
+		r.start = (r.start + 1) % len(r.buf)
+	}
+	return r.seq
+}
+
+func (r *Ring[T]) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.size
+}
+
+func (r *Ring[T]) Cap() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.capacity
+}
+
+// Latest 返回最新一条记录
+func (r *Ring[T]) Latest() (Entry[T], bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.size == 0 {
+		var zero Entry[T]
+		return zero, false
+	}
+	return r.at(r.size - 1), true
+}
+
+// Range 返回时间落在 [from, to] 内的记录，按时间升序
+func (r *Ring[T]) Range(from, to time.Time) []Entry[T] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]Entry[T], 0)
+	for i := 0; i < r.size; i++ {
+		entry := r.at(i)
+		if entry.Time.Before(from) || entry.Time.After(to) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Since 返回序号大于 seq 的记录；ok 为 false 表示 seq 之后的部分记录已被覆盖
+func (r *Ring[T]) Since(seq uint64) (entries []Entry[T], ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.size == 0 {
+		return nil, seq == r.seq
+	}
+	oldest := r.at(0).Seq
+	ok = seq+1 >= oldest && seq <= r.seq
+	for i := 0; i < r.size; i++ {
+		entry := r.at(i)
+		if entry.Seq > seq {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, ok
+}
+
+// Oldest 返回最旧一条记录的时间
+func (r *Ring[T]) Oldest() (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.size == 0 {
+		return time.Time{}, false
+	}
+	return r.at(0).Time, true
+}
+
+func (r *Ring[T]) at(i int) Entry[T] {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
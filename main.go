@@ -1,55 +1,166 @@
 package main
 
 import (
+	"chihqiang/hoststat/audit"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/certs"
+	"chihqiang/hoststat/config"
 	"chihqiang/hoststat/handles"
 	"chihqiang/hoststat/token"
 	"context"
 	"embed"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/chihqiang/logx"
 	"html/template"
 	"net/http"
 	"os"
 	"os/signal"
+	osuser "os/user"
+	"strings"
 	"syscall"
 	"time"
 )
 
-//go:embed index.html favicon.ico
+//go:embed index.html login.html favicon.ico
 var embedFs embed.FS
 
-var indexTemplate *template.Template
-
-const (
-	serverAddr   = ":8080"
-	readTimeout  = 15 * time.Second
-	writeTimeout = 15 * time.Second
-	idleTimeout  = 60 * time.Second
-)
+var indexTemplate, loginTemplate *template.Template
 
 // 初始化函数：提前解析模板、校验静态资源，避免运行时错误
 func init() {
 	indexTemplate = template.Must(template.ParseFS(embedFs, "index.html"))
+	loginTemplate = template.Must(template.ParseFS(embedFs, "login.html"))
+}
+
+// command 子命令：hoststat <名称> ...，共用配置文件与 --<分组>.<字段> 参数
+type command struct {
+	flags func(fs *flag.FlagSet) // 子命令自己的选项，可为空
+	run   func(cfg *config.Config, args []string) error
+}
+
+var commands = map[string]command{
+	"user":   {run: runUserCommand},
+	"apikey": {flags: apiKeyFlags, run: runAPIKeyCommand},
+}
+
+// auditCommand 记录子命令的写操作，调用方为 local:<系统用户>；与运行中的服务写入同一文件，由文件锁串行写入和轮转
+func auditCommand(action string, details map[string]any) {
+	actor := "local"
+	if u, err := osuser.Current(); err == nil {
+		actor += ":" + u.Username
+	}
+	audit.LOG.Record(audit.Event{Action: action, Outcome: audit.OutcomeSuccess, Actor: actor, Details: details})
+	_ = audit.LOG.Close()
 }
 
 func main() {
+	// 1. 加载配置：默认值 < 配置文件 < 环境变量 < 命令行参数
+	name, args := os.Args[0], os.Args[1:]
+	var cmd *command
+	var extra []func(fs *flag.FlagSet)
+	if len(args) > 0 {
+		if c, ok := commands[args[0]]; ok {
+			cmd, name, args = &c, name+" "+args[0], args[1:]
+			if c.flags != nil {
+				extra = append(extra, c.flags)
+			}
+		}
+	}
+	flags, err := config.ParseFlags(name, args, extra...)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		os.Exit(2)
+	}
+	cfg, err := config.Load(flags)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	if flags.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	config.Set(cfg)
+	// 子命令：hoststat user ...、hoststat apikey ...
+	if cmd != nil {
+		if err := cmd.run(cfg, flags.Args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(flags.Args) > 0 {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", flags.Args[0])
+		os.Exit(2)
+	}
+	if flags.ConfigFile != "" {
+		logx.Info("Configuration loaded | file: %s", flags.ConfigFile)
+	}
+	sessions, err := token.Open(cfg.Token)
+	if err != nil {
+		logx.Error("Session store startup failed | file: %s | error: %v", cfg.Token.StateFile, err)
+		os.Exit(1)
+	}
+	token.Use(sessions)
+	switch {
+	case !handles.LoginRequired():
+		logx.Warn("Anonymous mode enabled, dashboard is accessible without login | users_file: %s | hint: hoststat user add <username>", cfg.Auth.UsersFile)
+	case !cfg.OIDC.Enabled():
+		// 未开启匿名模式时必须能够登录，缺少用户文件视为配置错误
+		if err := auth.USERS.Check(); err != nil {
+			logx.Error("No users available and single sign-on is disabled | users_file: %s | error: %v | hint: hoststat user add <username>, or set auth.anonymous to allow access without login", cfg.Auth.UsersFile, err)
+			os.Exit(1)
+		}
+	}
+	if m := cfg.Metrics; m.Token == "" && m.Password == "" && !m.Anonymous {
+		logx.Warn("Metrics authentication not configured, /metrics only accepts API keys and client certificates | hint: set metrics.token, or metrics.anonymous to allow scraping without auth")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if err := handles.StartSampler(ctx); err != nil {
+		logx.Error("History sampler startup failed | error: %v", err)
+		os.Exit(1)
+	}
+	go auth.APIKEYS.Run(ctx)
 	registerRoutes()
 	// 2. 配置HTTP服务器（添加超时、优雅关闭）
 	server := &http.Server{
-		Addr:         serverAddr,
-		ReadTimeout:  readTimeout,
-		WriteTimeout: writeTimeout,
-		IdleTimeout:  idleTimeout,
+		Addr:         cfg.Server.Addr,
+		ReadTimeout:  cfg.Server.ReadTimeout.Std(),
+		WriteTimeout: cfg.Server.WriteTimeout.Std(),
+		IdleTimeout:  cfg.Server.IdleTimeout.Std(),
+	}
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := certs.Setup(ctx, cfg.TLS)
+		if err != nil {
+			logx.Error("TLS setup failed | error: %v", err)
+			os.Exit(1)
+		}
+		server.TLSConfig = tlsConfig
 	}
 	// 3. 启动服务器（goroutine+优雅关闭）
-	logx.Info("HTTP server starting at %s", serverAddr)
+	logx.Info("HTTP server starting at %s | tls: %t", cfg.Server.Addr, server.TLSConfig != nil)
 	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if server.TLSConfig != nil {
+			// 证书由 TLSConfig.GetCertificate 提供
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			// 增强错误日志：包含地址、错误详情、时间戳
 			logx.Error(
 				"HTTP server startup failed | addr: %s | error: %v | time: %s",
-				serverAddr,
+				cfg.Server.Addr,
 				err,
 				time.Now().Format("2006-01-02 15:04:05"),
 			)
@@ -57,19 +168,73 @@ func main() {
 			return
 		}
 	}()
-	// 4. 优雅关闭处理（监听系统信号）
+	// 4. 监听系统信号：SIGHUP 重新加载配置，SIGINT/SIGTERM 优雅关闭
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		reloadConfig(flags)
+	}
 
 	logx.Warn("Shutting down HTTP server gracefully...")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	stop()
+	defer handles.WaitSampler()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Std())
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
 		logx.Error("HTTP server forced shutdown | error: %v", err)
 	} else {
 		logx.Info("HTTP server exited normally")
 	}
+	if err := auth.APIKEYS.Flush(); err != nil {
+		logx.Error("Save api key usage failed | file: %s | error: %v", config.Get().Auth.APIKeysUsageFile, err)
+	}
+	handles.FlushAudit()
+	if err := audit.LOG.Close(); err != nil {
+		logx.Error("Close audit log failed | file: %s | error: %v", config.Get().Audit.File, err)
+	}
+}
+
+// reloadConfig 使用启动时的命令行参数重新加载配置文件和环境变量
+// 新配置无效时记录错误并继续使用当前配置
+func reloadConfig(flags *config.Flags) {
+	logx.Info("Reloading configuration | file: %s", flags.ConfigFile)
+	cfg, err := config.Load(flags)
+	if err != nil {
+		logx.Error("Configuration reload rejected, keeping current configuration | file: %s | error: %v", flags.ConfigFile, err)
+		auditReload(err, nil, nil)
+		return
+	}
+	changed, ignored, err := handles.ReloadConfig(cfg)
+	if err != nil {
+		logx.Error("Configuration reload rejected, keeping current configuration | file: %s | error: %v", flags.ConfigFile, err)
+		auditReload(err, nil, nil)
+		return
+	}
+	if len(ignored) > 0 {
+		logx.Warn("Configuration changes require restart, ignored | fields: %s", strings.Join(ignored, ","))
+	}
+	if len(changed) == 0 {
+		changed = []string{"none"}
+	}
+	auditReload(nil, changed, ignored)
+	logx.Info("Configuration reloaded | changed: %s", strings.Join(changed, ","))
+}
+
+// auditReload 记录 SIGHUP 触发的配置重新加载
+func auditReload(err error, changed, ignored []string) {
+	e := audit.Event{Action: "config.reload", Outcome: audit.OutcomeSuccess, Actor: "signal:SIGHUP"}
+	if err != nil {
+		e.Outcome, e.Error = audit.OutcomeFailure, err.Error()
+	} else {
+		e.Details = map[string]any{"changed": changed}
+		if len(ignored) > 0 {
+			e.Details["ignored"] = ignored
+		}
+	}
+	audit.LOG.Record(e)
 }
 
 // registerRoutes 统一注册所有HTTP路由，便于管理
@@ -90,16 +255,20 @@ func registerRoutes() {
 		}
 	})
 	// 2. 根路由（增强错误处理+日志）
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// 先执行token设置，捕获可能的错误（如果token.SetToken有返回值的话）
-		token.SetToken(w, r)
+	http.HandleFunc("/", handles.AccessMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		// 需要登录时未登录跳转到 /login，否则签发会话令牌
+		user, ok := handles.EnsureSession(w, r)
+		if !ok {
+			return
+		}
 		// 执行模板，完善错误日志（包含请求上下文）
-		if err := indexTemplate.Execute(w, nil); err != nil {
-			errMsg := fmt.Sprintf("Execute template failed | path: %s | remote_ip: %s | error: %v", r.URL.Path, r.RemoteAddr, err)
-			logx.Error(errMsg)
+		if err := indexTemplate.Execute(w, struct{ User string }{user}); err != nil {
+			logx.Error("Execute template failed | path: %s | remote_ip: %s | error: %v", r.URL.Path, handles.ClientIP(r), err)
 			http.Error(w, "Error executing template", http.StatusInternalServerError)
 			return
 		}
-	})
+	}))
+	// 3. 登录、退出与单点登录
+	handles.LoginRoutes(loginTemplate)
 	handles.BusinessRoutes()
 }
@@ -0,0 +1,490 @@
+package notify
+
+import (
+	"bytes"
+	"chihqiang/hoststat/alert"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	defaultGroupWait   = 10 * time.Second
+	defaultDedupWindow = 5 * time.Minute
+	defaultTimeout     = 10 * time.Second
+	defaultMaxRetries  = 8
+	minBackoff         = 1 * time.Second
+	maxBackoff         = 5 * time.Minute
+
+	// defaultTemplate 未配置模板时发送的 JSON 负载
+	defaultTemplate = `{{json .}}`
+)
+
+// Config 通知配置
+type Config struct {
+	OutboxDir   string          `json:"outboxDir"`   // 持久化待投递消息的目录，为空时只保存在内存中
+	GroupWait   alert.Duration  `json:"groupWait"`   // 同一目标在该时间窗口内的告警合并为一条通知
+	DedupWindow alert.Duration  `json:"dedupWindow"` // 同一告警的相同状态在该窗口内只通知一次
+	Targets     []*TargetConfig `json:"targets"`
+}
+
+// TargetConfig Webhook 目标
+type TargetConfig struct {
+	Name         string            `json:"name"`
+	URL          string            `json:"url"`
+	Method       string            `json:"method"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	ContentType  string            `json:"contentType"`
+	Template     string            `json:"template"`   // Go text/template，数据为 Payload
+	Severities   []string          `json:"severities"` // 为空时接收全部级别
+	SendResolved bool              `json:"sendResolved"`
+	MaxRetries   int               `json:"maxRetries"`
+	Timeout      alert.Duration    `json:"timeout"`
+
+	template *template.Template
+}
+
+// Payload 渲染模板时可用的数据
+type Payload struct {
+	Target   string        `json:"target"`
+	Hostname string        `json:"hostname"`
+	Status   string        `json:"status"` // firing：存在触发中的告警；否则为 resolved
+	Alerts   []alert.Alert `json:"alerts"`
+	Firing   []alert.Alert `json:"firing"`
+	Resolved []alert.Alert `json:"resolved"`
+	SentAt   time.Time     `json:"sentAt"`
+}
+
+// LoadConfig 从 JSON 文件加载并校验通知配置
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse notify config %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("notify config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"datetime": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}
+
+func (c *Config) validate() error {
+	if c.GroupWait <= 0 {
+		c.GroupWait = alert.Duration(defaultGroupWait)
+	}
+	if c.DedupWindow <= 0 {
+		c.DedupWindow = alert.Duration(defaultDedupWindow)
+	}
+	names := make(map[string]struct{}, len(c.Targets))
+	for i, target := range c.Targets {
+		if target.Name == "" {
+			return fmt.Errorf("target #%d: name is required", i)
+		}
+		if _, ok := names[target.Name]; ok {
+			return fmt.Errorf("target %s: duplicate name", target.Name)
+		}
+		names[target.Name] = struct{}{}
+		if target.URL == "" {
+			return fmt.Errorf("target %s: url is required", target.Name)
+		}
+		if target.Method == "" {
+			target.Method = http.MethodPost
+		}
+		if target.ContentType == "" {
+			target.ContentType = "application/json"
+		}
+		if target.MaxRetries <= 0 {
+			target.MaxRetries = defaultMaxRetries
+		}
+		if target.Timeout <= 0 {
+			target.Timeout = alert.Duration(defaultTimeout)
+		}
+		text := target.Template
+		if text == "" {
+			text = defaultTemplate
+		}
+		tmpl, err := template.New(target.Name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return fmt.Errorf("target %s: template: %w", target.Name, err)
+		}
+		target.template = tmpl
+	}
+	return nil
+}
+
+func (t *TargetConfig) accepts(a alert.Alert) bool {
+	if a.State == alert.StateResolved && !t.SendResolved {
+		return false
+	}
+	return len(t.Severities) == 0 || slices.Contains(t.Severities, a.Severity)
+}
+
+// Notifier 将告警状态变化按目标分组、去重后写入发件箱，由后台协程带重试投递
+type Notifier struct {
+	cfg      atomic.Pointer[Config]
+	hostname string
+	client   *http.Client
+	outbox   *outbox
+	wake     chan struct{}
+
+	mu     sync.Mutex
+	groups map[string]*group // 目标名 -> 等待合并的告警
+	timers map[string]*time.Timer
+	sent   map[string]sentState // 目标名+告警Key -> 最近一次通知
+	// stopped 已交接给 next（为空时已停止），之后收到的告警转交给 next
+	stopped bool
+	next    *Notifier
+}
+
+type sentState struct {
+	state string
+	at    time.Time
+}
+
+func New(cfg *Config, hostname string) (*Notifier, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	box, err := newOutbox(cfg.OutboxDir)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := box.loadGroups()
+	if err != nil {
+		return nil, err
+	}
+	n := &Notifier{
+		hostname: hostname,
+		client:   &http.Client{},
+		outbox:   box,
+		wake:     make(chan struct{}, 1),
+		groups:   groups,
+		timers:   make(map[string]*time.Timer),
+		sent:     make(map[string]sentState),
+	}
+	n.cfg.Store(cfg)
+	// 上次退出时仍在等待合并的告警，按原定时间发送
+	n.mu.Lock()
+	for name, g := range groups {
+		n.schedule(name, g.FlushAt)
+	}
+	n.mu.Unlock()
+	if len(groups) > 0 {
+		logx.Info("Pending alert groups restored | dir: %s | groups: %d", cfg.OutboxDir, len(groups))
+	}
+	return n, nil
+}
+
+// Config 返回当前生效的通知配置
+func (n *Notifier) Config() *Config {
+	return n.cfg.Load()
+}
+
+// Reconfigure 使用新配置创建通知模块，与当前模块共用发件箱；不会启动定时器，
+// 需要在 Handover 之后再运行 Run。发件箱目录在创建时确定，cfg.OutboxDir 被忽略
+func (n *Notifier) Reconfigure(cfg *Config) (*Notifier, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	cfg.OutboxDir = n.cfg.Load().OutboxDir
+	next := &Notifier{
+		hostname: n.hostname,
+		client:   n.client,
+		outbox:   n.outbox,
+		wake:     make(chan struct{}, 1),
+		groups:   make(map[string]*group),
+		timers:   make(map[string]*time.Timer),
+		sent:     make(map[string]sentState),
+	}
+	next.cfg.Store(cfg)
+	return next, nil
+}
+
+// Handover 停止当前模块的合并定时器，把等待合并的告警和去重记录交给 next，按原定时间发送；
+// 已删除目标的告警被丢弃。next 为空时只停止，等待合并的告警保留在发件箱目录中，下次启动时继续发送
+// 调用方需先停止当前模块的 Run，避免两个投递协程同时处理同一个发件箱
+func (n *Notifier) Handover(next *Notifier) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for name, timer := range n.timers {
+		timer.Stop()
+		delete(n.timers, name)
+	}
+	groups, sent := n.groups, n.sent
+	n.groups, n.sent = make(map[string]*group), make(map[string]sentState)
+	n.stopped, n.next = true, next
+	if next == nil {
+		return
+	}
+
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	for name, g := range groups {
+		if next.target(name) == nil {
+			logx.Warn("Drop pending alerts for removed target | target: %s | alerts: %d", name, len(g.Alerts))
+			continue
+		}
+		next.groups[name] = g
+		next.schedule(name, g.FlushAt)
+	}
+	maps.Copy(next.sent, sent)
+	if err := next.outbox.saveGroups(next.groups); err != nil {
+		logx.Error("Persist pending alerts failed | error: %v", err)
+	}
+}
+
+// Notify 接收告警状态变化；pending 状态不通知
+// 等待合并的告警立即写入发件箱目录，退出或重启不会丢失
+func (n *Notifier) Notify(events []alert.Event) {
+	cfg := n.cfg.Load()
+	now := time.Now()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		if n.next != nil {
+			n.next.Notify(events)
+		}
+		return
+	}
+	changed := false
+	for _, event := range events {
+		a := event.Alert
+		if a.State == alert.StatePending {
+			continue
+		}
+		for _, target := range cfg.Targets {
+			if !target.accepts(a) {
+				continue
+			}
+			key := target.Name + "\x00" + a.Key()
+			if last, ok := n.sent[key]; ok && last.state == a.State && now.Sub(last.at) < time.Duration(cfg.DedupWindow) {
+				continue
+			}
+			n.sent[key] = sentState{state: a.State, at: now}
+			g, ok := n.groups[target.Name]
+			if !ok {
+				g = &group{FlushAt: now.Add(time.Duration(cfg.GroupWait))}
+				n.groups[target.Name] = g
+				n.schedule(target.Name, g.FlushAt)
+			}
+			g.Alerts = append(g.Alerts, a)
+			changed = true
+		}
+	}
+	n.pruneSent(now, time.Duration(cfg.DedupWindow))
+	if changed {
+		if err := n.outbox.saveGroups(n.groups); err != nil {
+			logx.Error("Persist pending alerts failed | error: %v", err)
+		}
+	}
+}
+
+// schedule 在 at 时刻发送目标的分组告警，调用方需持有锁
+func (n *Notifier) schedule(name string, at time.Time) {
+	if _, ok := n.timers[name]; ok {
+		return
+	}
+	n.timers[name] = time.AfterFunc(max(time.Until(at), 0), func() { n.flush(name) })
+}
+
+// pruneSent 清理超出去重窗口的记录，调用方需持有锁
+func (n *Notifier) pruneSent(now time.Time, window time.Duration) {
+	for key, last := range n.sent {
+		if now.Sub(last.at) >= window {
+			delete(n.sent, key)
+		}
+	}
+}
+
+// flush 渲染目标的分组告警并写入发件箱，写入后才从待合并列表中移除
+func (n *Notifier) flush(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.timers, name)
+	g, ok := n.groups[name]
+	if !ok {
+		return
+	}
+	if err := n.enqueue(name, g.Alerts); err != nil {
+		logx.Error("Persist notification failed | target: %s | error: %v", name, err)
+	}
+	delete(n.groups, name)
+	if err := n.outbox.saveGroups(n.groups); err != nil {
+		logx.Error("Persist pending alerts failed | error: %v", err)
+	}
+	n.signal()
+}
+
+// enqueue 渲染分组告警并写入发件箱，目标已被删除时丢弃
+func (n *Notifier) enqueue(name string, alerts []alert.Alert) error {
+	target := n.target(name)
+	if len(alerts) == 0 || target == nil {
+		return nil
+	}
+
+	payload := Payload{Target: name, Hostname: n.hostname, Status: alert.StateResolved, Alerts: alerts, SentAt: time.Now()}
+	payload.Firing, payload.Resolved = []alert.Alert{}, []alert.Alert{}
+	for _, a := range alerts {
+		if a.State == alert.StateFiring {
+			payload.Firing = append(payload.Firing, a)
+			payload.Status = alert.StateFiring
+		} else {
+			payload.Resolved = append(payload.Resolved, a)
+		}
+	}
+	var body bytes.Buffer
+	if err := target.template.Execute(&body, payload); err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	msg := &Message{
+		ID:        newMessageID(),
+		Target:    name,
+		Body:      body.String(),
+		CreatedAt: payload.SentAt,
+	}
+	msg.NextAttempt = msg.CreatedAt
+	return n.outbox.add(msg)
+}
+
+func (n *Notifier) target(name string) *TargetConfig {
+	for _, target := range n.cfg.Load().Targets {
+		if target.Name == name {
+			return target
+		}
+	}
+	return nil
+}
+
+func (n *Notifier) signal() {
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 投递循环，ctx 取消后退出；未投递的消息保留在发件箱中
+func (n *Notifier) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-n.wake:
+		}
+		for _, msg := range n.outbox.due(time.Now()) {
+			if ctx.Err() != nil {
+				return
+			}
+			n.deliver(ctx, msg)
+		}
+		wait := time.Minute
+		if next, ok := n.outbox.nextWake(); ok {
+			wait = max(time.Until(next), 0)
+		}
+		timer.Reset(wait)
+	}
+}
+
+func (n *Notifier) deliver(ctx context.Context, msg *Message) {
+	target := n.target(msg.Target)
+	if target == nil {
+		logx.Warn("Drop notification for unknown target | target: %s | id: %s", msg.Target, msg.ID)
+		if err := n.outbox.bury(msg); err != nil {
+			logx.Error("Bury notification failed | id: %s | error: %v", msg.ID, err)
+		}
+		return
+	}
+	err := n.send(ctx, target, msg)
+	if err == nil {
+		logx.Info("Notification delivered | target: %s | id: %s | attempts: %d", target.Name, msg.ID, msg.Attempts+1)
+		if err := n.outbox.remove(msg); err != nil {
+			logx.Error("Remove delivered notification failed | id: %s | error: %v", msg.ID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	msg.Attempts++
+	msg.LastError = err.Error()
+	if msg.Attempts >= target.MaxRetries {
+		logx.Error("Notification dropped after retries | target: %s | id: %s | attempts: %d | error: %v", target.Name, msg.ID, msg.Attempts, err)
+		if err := n.outbox.bury(msg); err != nil {
+			logx.Error("Bury notification failed | id: %s | error: %v", msg.ID, err)
+		}
+		return
+	}
+	msg.NextAttempt = time.Now().Add(backoff(msg.Attempts))
+	logx.Warn("Notification failed, will retry | target: %s | id: %s | attempts: %d | next: %s | error: %v",
+		target.Name, msg.ID, msg.Attempts, msg.NextAttempt.Format("2006-01-02 15:04:05"), err)
+	if err := n.outbox.update(msg); err != nil {
+		logx.Error("Persist notification failed | id: %s | error: %v", msg.ID, err)
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, target *TargetConfig, msg *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(target.Timeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, target.Method, target.URL, bytes.NewBufferString(msg.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", target.ContentType)
+	req.Header.Set("User-Agent", "hoststat-notifier")
+	req.Header.Set("Idempotency-Key", msg.ID)
+	for key, value := range target.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("unexpected status " + resp.Status)
+	}
+	return nil
+}
+
+// backoff 指数退避并加入随机抖动
+func backoff(attempts int) time.Duration {
+	d := minBackoff << min(attempts-1, 16)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// Pending 返回发件箱中待投递的消息数
+func (n *Notifier) Pending() int {
+	return n.outbox.len()
+}
@@ -0,0 +1,206 @@
+package notify
+
+import (
+	"chihqiang/hoststat/alert"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver 记录收到的 Webhook 请求，前 failures 次返回 503
+type receiver struct {
+	mu       sync.Mutex
+	failures int
+	keys     []string
+	payloads []Payload
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	var payload Payload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rv.keys = append(rv.keys, r.Header.Get("Idempotency-Key"))
+	rv.payloads = append(rv.payloads, payload)
+	if rv.failures > 0 {
+		rv.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rv *receiver) requests() int {
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	return len(rv.keys)
+}
+
+func testConfig(dir, url string, groupWait time.Duration) *Config {
+	return &Config{
+		OutboxDir:   dir,
+		GroupWait:   alert.Duration(groupWait),
+		DedupWindow: alert.Duration(time.Minute),
+		Targets:     []*TargetConfig{{Name: "hook", URL: url, MaxRetries: 3}},
+	}
+}
+
+func firingEvent() alert.Event {
+	return alert.Event{Alert: alert.Alert{Rule: "cpu_high", Severity: "critical", State: alert.StateFiring, Value: 95}, From: alert.StatePending}
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeliveryRetriesAndDeduplicates(t *testing.T) {
+	rv := &receiver{failures: 1}
+	srv := httptest.NewServer(rv)
+	defer srv.Close()
+
+	n, err := New(testConfig("", srv.URL, 20*time.Millisecond), "host-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	// 去重窗口内相同状态只通知一次
+	n.Notify([]alert.Event{firingEvent()})
+	n.Notify([]alert.Event{firingEvent()})
+
+	// 第一次 503，退避后重试成功
+	waitFor(t, 5*time.Second, func() bool { return rv.requests() == 2 && n.Pending() == 0 })
+
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	if rv.keys[0] == "" || rv.keys[0] != rv.keys[1] {
+		t.Errorf("idempotency keys = %q, want the same non-empty key on retry", rv.keys)
+	}
+	for i, payload := range rv.payloads {
+		if payload.Status != alert.StateFiring || len(payload.Alerts) != 1 || payload.Hostname != "host-1" {
+			t.Errorf("payload #%d = %+v, want one firing alert from host-1", i, payload)
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.groups) != 0 {
+		t.Errorf("pending groups = %d, want 0", len(n.groups))
+	}
+}
+
+func TestDeduplicatedAlertIsNotRegrouped(t *testing.T) {
+	n, err := New(testConfig("", "http://127.0.0.1:0", time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify([]alert.Event{firingEvent()})
+	n.flush("hook")
+	n.Notify([]alert.Event{firingEvent()})
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.groups) != 0 {
+		t.Fatalf("groups = %d, want duplicate firing alert suppressed", len(n.groups))
+	}
+	if n.Pending() != 1 {
+		t.Fatalf("pending messages = %d, want 1", n.Pending())
+	}
+}
+
+// 合并等待期间的告警在 Notify 时落盘，重启后恢复
+func TestPendingGroupsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	first, err := New(testConfig(dir, "http://127.0.0.1:0", time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Notify([]alert.Event{firingEvent()})
+	if _, err := os.Stat(filepath.Join(dir, groupsFile)); err != nil {
+		t.Fatalf("pending alerts not persisted: %v", err)
+	}
+
+	second, err := New(testConfig(dir, "http://127.0.0.1:0", time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.mu.Lock()
+	g := second.groups["hook"]
+	_, scheduled := second.timers["hook"]
+	second.mu.Unlock()
+	if g == nil || len(g.Alerts) != 1 || !scheduled {
+		t.Fatalf("restored group = %+v (scheduled %t), want one scheduled alert", g, scheduled)
+	}
+
+	second.flush("hook")
+	if second.Pending() != 1 {
+		t.Fatalf("pending messages = %d, want 1", second.Pending())
+	}
+	if _, err := os.Stat(filepath.Join(dir, groupsFile)); !os.IsNotExist(err) {
+		t.Fatalf("pending alerts file after flush: %v, want removed", err)
+	}
+}
+
+// 重新加载配置时，等待合并的告警交给新的通知模块并按原定时间发送，旧模块收到的告警转交给新模块
+func TestHandoverMovesPendingGroups(t *testing.T) {
+	dir := t.TempDir()
+	current, err := New(testConfig(dir, "http://127.0.0.1:0", time.Hour), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current.Notify([]alert.Event{firingEvent()})
+	flushAt := current.groups["hook"].FlushAt
+
+	cfg := testConfig("", "http://127.0.0.1:0", time.Minute)
+	cfg.Targets = append(cfg.Targets, &TargetConfig{Name: "other", URL: "http://127.0.0.1:0"})
+	next, err := current.Reconfigure(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Config().OutboxDir != dir {
+		t.Fatalf("outbox dir = %q, want %q", next.Config().OutboxDir, dir)
+	}
+	current.Handover(next)
+
+	// 去重记录随之交接，相同状态不会再次合并
+	current.Notify([]alert.Event{firingEvent()})
+	disk := firingEvent()
+	disk.Alert.Rule = "disk_full"
+	current.Notify([]alert.Event{disk})
+
+	current.mu.Lock()
+	if len(current.timers) != 0 || len(current.groups) != 0 {
+		t.Errorf("old notifier still has %d timers and %d groups", len(current.timers), len(current.groups))
+	}
+	current.mu.Unlock()
+
+	next.mu.Lock()
+	defer next.mu.Unlock()
+	g := next.groups["hook"]
+	if g == nil || len(g.Alerts) != 2 || !g.FlushAt.Equal(flushAt) {
+		t.Fatalf("handed over group = %+v, want 2 alerts flushing at %v", g, flushAt)
+	}
+	if _, ok := next.timers["hook"]; !ok {
+		t.Fatal("handed over group is not scheduled")
+	}
+	if other := next.groups["other"]; other == nil || len(other.Alerts) != 2 {
+		t.Fatalf("forwarded group for new target = %+v, want 2 alerts", other)
+	}
+}
@@ -0,0 +1,228 @@
+package notify
+
+import (
+	"chihqiang/hoststat/alert"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	messageExt = ".json"
+	deadExt    = ".dead"
+	groupsFile = "groups.state"
+)
+
+// group 等待合并发送的告警
+type group struct {
+	Alerts  []alert.Alert `json:"alerts"`
+	FlushAt time.Time     `json:"flushAt"`
+}
+
+// Message 等待投递的通知
+type Message struct {
+	ID          string    `json:"id"`
+	Target      string    `json:"target"`
+	Body        string    `json:"body"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// outbox 待投递消息队列；配置目录时每条消息落盘为一个文件，投递成功后删除，重启后继续投递
+type outbox struct {
+	mu       sync.Mutex
+	dir      string
+	messages map[string]*Message
+}
+
+func newOutbox(dir string) (*outbox, error) {
+	o := &outbox{dir: dir, messages: make(map[string]*Message)}
+	if dir == "" {
+		return o, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), messageExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil || msg.ID == "" {
+			logx.Warn("Skip corrupted outbox message | file: %s | error: %v", entry.Name(), err)
+			continue
+		}
+		o.messages[msg.ID] = &msg
+	}
+	if len(o.messages) > 0 {
+		logx.Info("Outbox restored | dir: %s | messages: %d", dir, len(o.messages))
+	}
+	return o, nil
+}
+
+func newMessageID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+}
+
+func (o *outbox) add(msg *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.persist(msg); err != nil {
+		return err
+	}
+	o.messages[msg.ID] = msg
+	return nil
+}
+
+// due 返回到期需要投递的消息，按创建时间排序
+func (o *outbox) due(now time.Time) []*Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var due []*Message
+	for _, msg := range o.messages {
+		if !msg.NextAttempt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	slices.SortFunc(due, func(a, b *Message) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return due
+}
+
+// nextWake 返回最近一条消息的投递时间
+func (o *outbox) nextWake() (time.Time, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var next time.Time
+	found := false
+	for _, msg := range o.messages {
+		if !found || msg.NextAttempt.Before(next) {
+			next, found = msg.NextAttempt, true
+		}
+	}
+	return next, found
+}
+
+func (o *outbox) update(msg *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.persist(msg)
+}
+
+func (o *outbox) remove(msg *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.messages, msg.ID)
+	if o.dir == "" {
+		return nil
+	}
+	err := os.Remove(o.path(msg.ID, messageExt))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// bury 放弃投递，保留为 .dead 文件便于排查
+func (o *outbox) bury(msg *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.messages, msg.ID)
+	if o.dir == "" {
+		return nil
+	}
+	return os.Rename(o.path(msg.ID, messageExt), o.path(msg.ID, deadExt))
+}
+
+func (o *outbox) len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.messages)
+}
+
+// persist 原子写入消息文件，调用方需持有锁
+func (o *outbox) persist(msg *Message) error {
+	if o.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	tmp := o.path(msg.ID, ".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.path(msg.ID, messageExt))
+}
+
+// loadGroups 读取上次退出时仍在等待合并的告警
+func (o *outbox) loadGroups() (map[string]*group, error) {
+	groups := make(map[string]*group)
+	if o.dir == "" {
+		return groups, nil
+	}
+	data, err := os.ReadFile(filepath.Join(o.dir, groupsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return groups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &groups); err != nil {
+		logx.Warn("Skip corrupted pending alerts | file: %s | error: %v", groupsFile, err)
+		return make(map[string]*group), nil
+	}
+	return groups, nil
+}
+
+// saveGroups 原子写入等待合并的告警，没有时删除文件
+func (o *outbox) saveGroups(groups map[string]*group) error {
+	if o.dir == "" {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	path := filepath.Join(o.dir, groupsFile)
+	if len(groups) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (o *outbox) path(id, ext string) string {
+	return filepath.Join(o.dir, id+ext)
+}
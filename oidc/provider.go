@@ -0,0 +1,335 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// clockSkew 校验 exp/iat 时允许的时钟偏差
+	clockSkew = time.Minute
+	// jwksRefreshInterval 遇到未知 kid 时重新获取 JWKS 的最短间隔，避免伪造的 kid 反复触发请求
+	jwksRefreshInterval = time.Minute
+	maxResponseBytes    = 1 << 20
+)
+
+// metadata 发现文档中用到的字段
+type metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Provider 一个 OIDC 提供方：发现文档与 JWKS 在首次使用时获取并缓存，提供方暂时不可用不影响启动
+// fetchMu 保证同一时间只有一个请求访问提供方，mu 只保护缓存，访问提供方期间不持有，其他登录的校验不被阻塞
+type Provider struct {
+	issuer string
+	client *http.Client
+
+	fetchMu sync.Mutex
+	mu      sync.Mutex
+	meta    *metadata
+	keys    map[string]crypto.PublicKey
+	keysAt  time.Time
+}
+
+func NewProvider(issuer string) *Provider {
+	return &Provider{
+		issuer: strings.TrimSuffix(issuer, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer 提供方地址
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// discover 读取发现文档，issuer 必须与配置一致
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	if meta := p.cachedMeta(); meta != nil {
+		return meta, nil
+	}
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+	// 等待期间其他请求可能已经获取
+	if meta := p.cachedMeta(); meta != nil {
+		return meta, nil
+	}
+	var meta metadata
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: missing endpoints")
+	}
+	if len(meta.CodeChallengeMethods) > 0 && !slices.Contains(meta.CodeChallengeMethods, "S256") {
+		return nil, errors.New("oidc discovery: provider does not support PKCE S256")
+	}
+	p.mu.Lock()
+	p.meta = &meta
+	p.mu.Unlock()
+	return &meta, nil
+}
+
+func (p *Provider) cachedMeta() *metadata {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.meta
+}
+
+// AuthCodeURL 授权请求地址，携带 state、nonce 与 PKCE code_challenge
+func (p *Provider) AuthCodeURL(ctx context.Context, clientID, redirectURL string, scopes []string, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", clientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange 用授权码换取 ID Token；配置了客户端密钥时使用 client_secret_basic
+func (p *Provider) Exchange(ctx context.Context, clientID, clientSecret, redirectURL, code, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"code_verifier": {verifier},
+	}
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return "", fmt.Errorf("oidc token response: %w", err)
+	}
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("oidc token response: status %d: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("oidc token request: status %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("oidc token response: missing id_token")
+	}
+	return token.IDToken, nil
+}
+
+// Verify 校验 ID Token 的签名（JWKS）、issuer、audience、有效期和 nonce，返回其中的全部字段
+func (p *Provider) Verify(ctx context.Context, raw, clientID, nonce string, now time.Time) (map[string]any, error) {
+	header, payload, signed, sig, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.key(ctx, header.Kid, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, signed, sig); err != nil {
+		return nil, fmt.Errorf("id token signature: %w", err)
+	}
+	var claims map[string]any
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("parse id token: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, fmt.Errorf("id token issuer mismatch: %q", iss)
+	}
+	audiences := StringsClaim(claims, "aud")
+	if !slices.Contains(audiences, clientID) {
+		return nil, fmt.Errorf("id token audience mismatch: %v", audiences)
+	}
+	if azp, ok := claims["azp"].(string); len(audiences) > 1 && (!ok || azp != clientID) {
+		return nil, fmt.Errorf("id token authorized party mismatch: %q", azp)
+	}
+	exp, ok := timeClaim(claims, "exp")
+	if !ok || now.After(exp.Add(clockSkew)) {
+		return nil, errors.New("id token expired")
+	}
+	if iat, ok := timeClaim(claims, "iat"); ok && iat.After(now.Add(clockSkew)) {
+		return nil, errors.New("id token issued in the future")
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("id token nonce mismatch")
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("id token missing sub")
+	}
+	return claims, nil
+}
+
+// key 按 kid 查找签名公钥，缓存中没有时重新获取 JWKS（支持提供方轮换密钥）
+func (p *Provider) key(ctx context.Context, kid string, now time.Time) (crypto.PublicKey, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key, fresh := p.cachedKey(kid, now); key != nil {
+		return key, nil
+	} else if fresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	p.fetchMu.Lock()
+	defer p.fetchMu.Unlock()
+	// 等待期间其他请求可能已经重新获取
+	if key, fresh := p.cachedKey(kid, now); key != nil {
+		return key, nil
+	} else if fresh {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var set jwks
+	if err := p.getJSON(ctx, meta.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.keysAt = keys, now
+	if key := p.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// cachedKey 从缓存中查找公钥；fresh 表示缓存在 jwksRefreshInterval 内获取过，找不到也不重新获取
+func (p *Provider) cachedKey(kid string, now time.Time) (key crypto.PublicKey, fresh bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lookup(kid), p.keys != nil && now.Sub(p.keysAt) < jwksRefreshInterval
+}
+
+// lookup 调用方需持有锁；token 未带 kid 且只有一个公钥时使用该公钥
+func (p *Provider) lookup(kid string) crypto.PublicKey {
+	if key, ok := p.keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, rawURL string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// StringsClaim 读取字符串或字符串数组字段
+func StringsClaim(claims map[string]any, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func timeClaim(claims map[string]any, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// NewVerifier 生成 PKCE code_verifier，也用于 state 和 nonce
+func NewVerifier() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Challenge PKCE S256 code_challenge
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
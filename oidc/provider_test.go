@@ -0,0 +1,346 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "hoststat"
+
+// testKey 模拟提供方的签名密钥
+type testKey struct {
+	kid    string
+	alg    string
+	signer crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, alg: "RS256", signer: key}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, alg: "ES256", signer: key}
+}
+
+func (k testKey) jwk() jwk {
+	switch pub := k.signer.Public().(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", Kid: k.kid, Use: "sig", Alg: k.alg,
+			N: base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return jwk{Kty: "EC", Kid: k.kid, Use: "sig", Alg: k.alg, Crv: "P-256",
+			X: base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32))),
+			Y: base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32)))}
+	}
+	return jwk{}
+}
+
+// sign 生成 JWS 紧凑格式的 ID Token
+func (k testKey) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(jwtHeader{Alg: k.alg, Kid: k.kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch key := k.signer.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// mockProvider 通过 httptest 模拟的提供方：发现文档、令牌端点（校验 PKCE）与 JWKS
+type mockProvider struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	keys         []testKey
+	jwksRequests int
+	jwksGate     chan struct{} // 非空时 JWKS 请求等待关闭后才返回
+	challenge    string
+	idToken      string
+}
+
+func newMockProvider(t *testing.T, keys ...testKey) *mockProvider {
+	t.Helper()
+	m := &mockProvider{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(metadata{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JWKSURI:               m.URL + "/jwks",
+			CodeChallengeMethods:  []string{"S256"},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		challenge, idToken := m.challenge, m.idToken
+		m.mu.Unlock()
+		if Challenge(r.FormValue("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		m.jwksRequests++
+		gate := m.jwksGate
+		var set jwks
+		for _, k := range m.keys {
+			set.Keys = append(set.Keys, k.jwk())
+		}
+		m.mu.Unlock()
+		if gate != nil {
+			<-gate
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockProvider) claims(nonce string, now time.Time) map[string]any {
+	return map[string]any{
+		"iss":   m.URL,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+		"email": "alice@example.com",
+	}
+}
+
+func TestVerifySignatureAlgorithms(t *testing.T) {
+	keys := []testKey{newRSAKey(t, "rsa"), newECKey(t, "ec")}
+	m := newMockProvider(t, keys...)
+	p := NewProvider(m.URL)
+	now := time.Now()
+	for _, key := range keys {
+		claims, err := p.Verify(context.Background(), key.sign(t, m.claims("n", now)), testClientID, "n", now)
+		if err != nil {
+			t.Fatalf("%s: %v", key.alg, err)
+		}
+		if claims["sub"] != "user-1" {
+			t.Fatalf("%s: sub = %v", key.alg, claims["sub"])
+		}
+	}
+}
+
+func TestVerifyRejectsInvalidTokens(t *testing.T) {
+	key := newRSAKey(t, "k1")
+	m := newMockProvider(t, key)
+	p := NewProvider(m.URL)
+	now := time.Now()
+	other := newRSAKey(t, "k1")
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"nonce mismatch", func() string { return key.sign(t, m.claims("other", now)) }},
+		{"issuer mismatch", func() string {
+			c := m.claims("n", now)
+			c["iss"] = "https://evil.example.com"
+			return key.sign(t, c)
+		}},
+		{"audience mismatch", func() string {
+			c := m.claims("n", now)
+			c["aud"] = "another-client"
+			return key.sign(t, c)
+		}},
+		{"multiple audiences without azp", func() string {
+			c := m.claims("n", now)
+			c["aud"] = []string{testClientID, "another-client"}
+			return key.sign(t, c)
+		}},
+		{"expired", func() string {
+			c := m.claims("n", now)
+			c["exp"] = now.Add(-clockSkew - time.Second).Unix()
+			return key.sign(t, c)
+		}},
+		{"missing exp", func() string {
+			c := m.claims("n", now)
+			delete(c, "exp")
+			return key.sign(t, c)
+		}},
+		{"issued in the future", func() string {
+			c := m.claims("n", now)
+			c["iat"] = now.Add(clockSkew + time.Minute).Unix()
+			return key.sign(t, c)
+		}},
+		{"missing sub", func() string {
+			c := m.claims("n", now)
+			delete(c, "sub")
+			return key.sign(t, c)
+		}},
+		{"signed by an unknown key with a known kid", func() string { return other.sign(t, m.claims("n", now)) }},
+		{"alg none", func() string {
+			parts := strings.Split(key.sign(t, m.claims("n", now)), ".")
+			header, _ := json.Marshal(jwtHeader{Alg: "none", Kid: "k1"})
+			return base64.RawURLEncoding.EncodeToString(header) + "." + parts[1] + "."
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.Verify(context.Background(), tt.token(), testClientID, "n", now); err == nil {
+				t.Fatal("token accepted")
+			}
+		})
+	}
+}
+
+func TestExchangeSendsPKCEVerifier(t *testing.T) {
+	key := newRSAKey(t, "k1")
+	m := newMockProvider(t, key)
+	p := NewProvider(m.URL)
+	ctx := context.Background()
+
+	verifier := NewVerifier()
+	authURL, err := p.AuthCodeURL(ctx, testClientID, "http://localhost/oidc/callback", []string{"openid"}, "state", "nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(authURL, "code_challenge="+Challenge(verifier)) || !strings.Contains(authURL, "code_challenge_method=S256") {
+		t.Fatalf("authorization url %s does not carry the S256 challenge", authURL)
+	}
+
+	m.mu.Lock()
+	m.challenge, m.idToken = Challenge(verifier), "id-token"
+	m.mu.Unlock()
+	if _, err := p.Exchange(ctx, testClientID, "", "http://localhost/oidc/callback", "code", NewVerifier()); err == nil {
+		t.Fatal("exchange with a different verifier succeeded")
+	}
+	idToken, err := p.Exchange(ctx, testClientID, "", "http://localhost/oidc/callback", "code", verifier)
+	if err != nil || idToken != "id-token" {
+		t.Fatalf("exchange = %q, %v", idToken, err)
+	}
+}
+
+// 提供方轮换密钥后，未知 kid 在刷新间隔之后才重新获取 JWKS
+func TestJWKSKeyRotation(t *testing.T) {
+	first, second := newRSAKey(t, "k1"), newECKey(t, "k2")
+	m := newMockProvider(t, first)
+	p := NewProvider(m.URL)
+	ctx := context.Background()
+	now := time.Now()
+	if _, err := p.Verify(ctx, first.sign(t, m.claims("n", now)), testClientID, "n", now); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	m.keys = []testKey{second}
+	m.mu.Unlock()
+	rotated := second.sign(t, m.claims("n", now))
+	if _, err := p.Verify(ctx, rotated, testClientID, "n", now.Add(time.Second)); err == nil {
+		t.Fatal("unknown kid accepted before the JWKS refresh interval")
+	}
+	if _, err := p.Verify(ctx, rotated, testClientID, "n", now.Add(jwksRefreshInterval)); err != nil {
+		t.Fatalf("rotated key rejected after refresh: %v", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jwksRequests != 2 {
+		t.Fatalf("jwks requests = %d, want 2", m.jwksRequests)
+	}
+}
+
+// 获取 JWKS 期间不持有缓存锁，使用已缓存密钥的校验不被阻塞
+func TestVerifyDoesNotWaitForJWKSFetch(t *testing.T) {
+	first, second := newRSAKey(t, "k1"), newRSAKey(t, "k2")
+	m := newMockProvider(t, first)
+	p := NewProvider(m.URL)
+	ctx := context.Background()
+	now := time.Now()
+	cached := first.sign(t, m.claims("n", now))
+	if _, err := p.Verify(ctx, cached, testClientID, "n", now); err != nil {
+		t.Fatal(err)
+	}
+
+	gate := make(chan struct{})
+	m.mu.Lock()
+	m.jwksGate = gate
+	m.mu.Unlock()
+	unknown := second.sign(t, m.claims("n", now))
+	fetching := make(chan error, 1)
+	go func() {
+		_, err := p.Verify(ctx, unknown, testClientID, "n", now.Add(jwksRefreshInterval))
+		fetching <- err
+	}()
+	waitJWKSRequests(t, m, 2)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Verify(ctx, cached, testClientID, "n", now.Add(jwksRefreshInterval))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("verify with a cached key blocked by a JWKS fetch")
+	}
+	close(gate)
+	if err := <-fetching; err == nil {
+		t.Fatal("token signed by a key missing from JWKS accepted")
+	}
+}
+
+func waitJWKSRequests(t *testing.T, m *mockProvider, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.Lock()
+		got := m.jwksRequests
+		m.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("jwks requests = %d, want %d", got, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
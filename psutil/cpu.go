@@ -11,11 +11,6 @@ import (
 	"github.com/shirou/gopsutil/v4/cpu"
 )
 
-const (
-	resetInterval = 1 * time.Minute
-	fastInterval  = 3 * time.Second
-)
-
 type CPUStat struct {
 	Idle  uint64
 	Total uint64
@@ -36,30 +31,42 @@ type CPUDetailedStat struct {
 }
 
 type CPUDetailedPercent struct {
-	User    float64 `json:"user"`
-	System  float64 `json:"system"`
-	Nice    float64 `json:"nice"`
-	Idle    float64 `json:"idle"`
-	Iowait  float64 `json:"iowait"`
-	Irq     float64 `json:"irq"`
-	Softirq float64 `json:"softirq"`
-	Steal   float64 `json:"steal"`
+	User      float64 `json:"user"`
+	System    float64 `json:"system"`
+	Nice      float64 `json:"nice"`
+	Idle      float64 `json:"idle"`
+	Iowait    float64 `json:"iowait"`
+	Irq       float64 `json:"irq"`
+	Softirq   float64 `json:"softirq"`
+	Steal     float64 `json:"steal"`
+	Guest     float64 `json:"guest"`
+	GuestNice float64 `json:"guestNice"`
 }
 
 func (c *CPUDetailedPercent) GetCPUDetailedPercent() []float64 {
-	return []float64{c.User, c.System, c.Nice, c.Idle, c.Iowait, c.Irq, c.Softirq, c.Steal}
+	return []float64{c.User, c.System, c.Nice, c.Idle, c.Iowait, c.Irq, c.Softirq, c.Steal, c.Guest, c.GuestNice}
+}
+
+// CPUUsage 一次采样窗口内的CPU使用情况（总体与每个核心）
+type CPUUsage struct {
+	TotalPercent    float64              `json:"totalPercent"`
+	PerCore         []float64            `json:"perCore"`
+	Detailed        CPUDetailedPercent   `json:"detailed"`
+	PerCoreDetailed []CPUDetailedPercent `json:"perCoreDetailed"`
+	Interval        time.Duration        `json:"-"`
 }
 
 type CPUUsageState struct {
-	mu             sync.Mutex
-	lastTotalStat  *CPUStat
-	lastPerCPUStat []CPUStat
-	lastDetailStat *CPUDetailedStat
-	lastSampleTime time.Time
-
-	cachedTotalUsage      float64
-	cachedPerCore         []float64
-	cachedDetailedPercent CPUDetailedPercent
+	mu                   sync.Mutex
+	lastTotalStat        *CPUStat
+	lastPerCPUStat       []CPUStat
+	lastDetailStat       *CPUDetailedStat
+	lastPerCPUDetailStat []CPUDetailedStat
+	lastSampleTime       time.Time
+	// sampling 等待新基线期间不为 nil，采样完成后关闭
+	sampling chan struct{}
+
+	cachedUsage CPUUsage
 }
 
 type CPUInfoState struct {
@@ -70,63 +77,103 @@ type CPUInfoState struct {
 	cachedLogicCores int
 }
 
+// GetCPUUsage 返回总体使用率、每个核心使用率以及详细时间占比（顺序同GetCPUDetailedPercent）
 func (c *CPUUsageState) GetCPUUsage() (float64, []float64, []float64) {
+	usage := c.GetCPUUsageDetail()
+	return usage.TotalPercent, usage.PerCore, usage.Detailed.GetCPUDetailedPercent()
+}
+
+// GetCPUUsageDetail 基于/proc/stat两次读数的差值计算CPU使用情况
+// 距上次采样不足 Intervals.CPU 时直接返回缓存；超过 Intervals.CPUReset 时基线已过期，清空缓存并重新短间隔采样
+func (c *CPUUsageState) GetCPUUsageDetail() CPUUsage {
 	c.mu.Lock()
-	now := time.Now()
-	if !c.lastSampleTime.IsZero() && now.Sub(c.lastSampleTime) < fastInterval {
-		result := c.cachedTotalUsage
-		perCore := c.cachedPerCore
-		detailed := c.cachedDetailedPercent
+	defer c.mu.Unlock()
+
+	// 其他调用方正在等待新基线时，等它完成后使用它的结果，不返回空的或过期的缓存
+	for c.sampling != nil {
+		done := c.sampling
 		c.mu.Unlock()
-		return result, perCore, detailed.GetCPUDetailedPercent()
+		<-done
+		c.mu.Lock()
 	}
-	// 释放锁，因为cpu.Percent会阻塞一段时间
-	c.mu.Unlock()
 
-	// 直接使用gopsutil的cpu.Percent函数获取CPU使用率
-	// 参数1: 采样时间间隔，0表示立即返回当前使用率
-	// 参数2: true表示返回每个核心的使用率
-	perCoreUsage, err := cpu.Percent(100*time.Millisecond, true)
-	if err != nil {
-		c.mu.Lock()
-		c.lastSampleTime = time.Now()
-		c.mu.Unlock()
-		return 0, []float64{}, []float64{}
+	now := time.Now()
+	if !c.lastSampleTime.IsZero() && now.Sub(c.lastSampleTime) < currentIntervals().CPU {
+		return c.cachedUsage
 	}
 
-	// 计算总CPU使用率
-	var totalUsage float64
-	if len(perCoreUsage) > 0 {
-		for _, usage := range perCoreUsage {
-			totalUsage += usage
+	if c.lastTotalStat == nil || now.Sub(c.lastSampleTime) > currentIntervals().CPUReset {
+		// 没有可用基线：先取一次读数，短暂等待后再计算差值；等待期间释放锁，其他调用方等待本次采样完成
+		c.cachedUsage = CPUUsage{}
+		if !c.storeBaseline(now) {
+			return c.cachedUsage
 		}
-		totalUsage /= float64(len(perCoreUsage))
+		done := make(chan struct{})
+		c.sampling = done
+		c.mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		c.mu.Lock()
+		c.sampling = nil
+		defer close(done)
+		now = time.Now()
 	}
 
-	// 创建详细CPU使用率（使用模拟值，因为gopsutil不直接提供详细信息）
-	detailedPercent := CPUDetailedPercent{
-		User:   totalUsage * 0.6, // 假设60%是用户空间使用
-		System: totalUsage * 0.3, // 假设30%是系统空间使用
-		Idle:   100 - totalUsage, // 剩余的是空闲时间
-		Iowait: totalUsage * 0.1, // 假设10%是I/O等待
+	total, detail, perCPU, perCPUDetail := readAllCPUStat()
+	if total.Total == 0 {
+		c.lastSampleTime = now
+		return c.cachedUsage
 	}
 
-	c.mu.Lock()
-	c.cachedTotalUsage = totalUsage
-	c.cachedPerCore = perCoreUsage
-	c.cachedDetailedPercent = detailedPercent
-	c.lastSampleTime = time.Now()
-	c.mu.Unlock()
+	usage := CPUUsage{
+		TotalPercent: calcCPUPercent(*c.lastTotalStat, total),
+		Detailed:     calcCPUDetailedPercent(*c.lastDetailStat, detail),
+		Interval:     now.Sub(c.lastSampleTime),
+	}
+	// 核心数发生变化（CPU热插拔）时无法逐核对应，本轮只输出总体数据
+	if len(perCPU) == len(c.lastPerCPUStat) && len(perCPUDetail) == len(c.lastPerCPUDetailStat) {
+		usage.PerCore = make([]float64, len(perCPU))
+		usage.PerCoreDetailed = make([]CPUDetailedPercent, len(perCPUDetail))
+		for i := range perCPU {
+			usage.PerCore[i] = calcCPUPercent(c.lastPerCPUStat[i], perCPU[i])
+		}
+		for i := range perCPUDetail {
+			usage.PerCoreDetailed[i] = calcCPUDetailedPercent(c.lastPerCPUDetailStat[i], perCPUDetail[i])
+		}
+	} else {
+		usage.PerCore = []float64{}
+		usage.PerCoreDetailed = []CPUDetailedPercent{}
+	}
+
+	c.lastTotalStat = &total
+	c.lastDetailStat = &detail
+	c.lastPerCPUStat = perCPU
+	c.lastPerCPUDetailStat = perCPUDetail
+	c.lastSampleTime = now
+	c.cachedUsage = usage
+	return usage
+}
 
-	return totalUsage, perCoreUsage, detailedPercent.GetCPUDetailedPercent()
+// storeBaseline 记录一次原始读数作为下一次差值计算的起点，调用方需持有锁
+func (c *CPUUsageState) storeBaseline(now time.Time) bool {
+	total, detail, perCPU, perCPUDetail := readAllCPUStat()
+	if total.Total == 0 {
+		c.lastSampleTime = now
+		return false
+	}
+	c.lastTotalStat = &total
+	c.lastDetailStat = &detail
+	c.lastPerCPUStat = perCPU
+	c.lastPerCPUDetailStat = perCPUDetail
+	c.lastSampleTime = now
+	return true
 }
 
 func (c *CPUUsageState) NumCPU() int {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if len(c.cachedPerCore) > 0 {
-		return len(c.cachedPerCore)
+	if len(c.cachedUsage.PerCore) > 0 {
+		return len(c.cachedUsage.PerCore)
 	}
 	// 使用runtime.NumCPU()作为跨平台的后备方案
 	return runtime.NumCPU()
@@ -214,50 +261,83 @@ func parseCPUFields(line string) []uint64 {
 	return nums
 }
 
+// calcIdleAndTotal 计算空闲时间与总时间
+// guest/guest_nice 已分别计入 user/nice，不能再次累加到总时间中
 func calcIdleAndTotal(nums []uint64) (idle, total uint64) {
 	if len(nums) < 5 {
 		return 0, 0
 	}
 	idle = nums[3] + nums[4]
-	for _, v := range nums {
+	for i, v := range nums {
+		if i >= 8 {
+			break
+		}
 		total += v
 	}
 	return
 }
 
-func readAllCPUStat() (CPUStat, CPUDetailedStat, []CPUStat) {
+// parseCPUDetailedStat 将/proc/stat中一行cpu数据转换为详细统计
+func parseCPUDetailedStat(nums []uint64) CPUDetailedStat {
+	if len(nums) < 10 {
+		padded := make([]uint64, 10)
+		copy(padded, nums)
+		nums = padded
+	}
+	stat := CPUDetailedStat{
+		User:      nums[0],
+		Nice:      nums[1],
+		System:    nums[2],
+		Idle:      nums[3],
+		Iowait:    nums[4],
+		Irq:       nums[5],
+		Softirq:   nums[6],
+		Steal:     nums[7],
+		Guest:     nums[8],
+		GuestNice: nums[9],
+	}
+	stat.Total = stat.User + stat.Nice + stat.System +
+		stat.Idle + stat.Iowait + stat.Irq + stat.Softirq + stat.Steal
+	return stat
+}
+
+// timesToDetailedStat 将gopsutil的秒级时间转换为与/proc/stat一致的时钟节拍（USER_HZ=100）
+func timesToDetailedStat(t cpu.TimesStat) CPUDetailedStat {
+	ticks := func(v float64) uint64 { return uint64(v * 100) }
+	stat := CPUDetailedStat{
+		User:      ticks(t.User),
+		Nice:      ticks(t.Nice),
+		System:    ticks(t.System),
+		Idle:      ticks(t.Idle),
+		Iowait:    ticks(t.Iowait),
+		Irq:       ticks(t.Irq),
+		Softirq:   ticks(t.Softirq),
+		Steal:     ticks(t.Steal),
+		Guest:     ticks(t.Guest),
+		GuestNice: ticks(t.GuestNice),
+	}
+	stat.Total = stat.User + stat.Nice + stat.System +
+		stat.Idle + stat.Iowait + stat.Irq + stat.Softirq + stat.Steal
+	return stat
+}
+
+func (d CPUDetailedStat) cpuStat() CPUStat {
+	return CPUStat{Idle: d.Idle + d.Iowait, Total: d.Total}
+}
+
+func readAllCPUStat() (CPUStat, CPUDetailedStat, []CPUStat, []CPUDetailedStat) {
 	// 首先尝试使用/proc/stat（Linux系统）获取原始统计信息
 	data, err := readProcStat()
 	if err == nil && len(data) > 0 {
 		lines := strings.Split(string(data), "\n")
-		if len(lines) > 0 {
-			firstLine := lines[0]
-			nums := parseCPUFields(firstLine)
-
+		if len(lines) > 0 && strings.HasPrefix(lines[0], "cpu ") {
+			nums := parseCPUFields(lines[0])
 			idle, total := calcIdleAndTotal(nums)
 			cpuStat := CPUStat{Idle: idle, Total: total}
-
-			if len(nums) < 10 {
-				padded := make([]uint64, 10)
-				copy(padded, nums)
-				nums = padded
-			}
-			detailedStat := CPUDetailedStat{
-				User:      nums[0],
-				Nice:      nums[1],
-				System:    nums[2],
-				Idle:      nums[3],
-				Iowait:    nums[4],
-				Irq:       nums[5],
-				Softirq:   nums[6],
-				Steal:     nums[7],
-				Guest:     nums[8],
-				GuestNice: nums[9],
-			}
-			detailedStat.Total = detailedStat.User + detailedStat.Nice + detailedStat.System +
-				detailedStat.Idle + detailedStat.Iowait + detailedStat.Irq + detailedStat.Softirq + detailedStat.Steal
+			detailedStat := parseCPUDetailedStat(nums)
 
 			var perCPUStats []CPUStat
+			var perCPUDetailStats []CPUDetailedStat
 			for _, line := range lines[1:] {
 				if !strings.HasPrefix(line, "cpu") {
 					continue
@@ -269,72 +349,70 @@ func readAllCPUStat() (CPUStat, CPUDetailedStat, []CPUStat) {
 				perNums := parseCPUFields(line)
 				perIdle, perTotal := calcIdleAndTotal(perNums)
 				perCPUStats = append(perCPUStats, CPUStat{Idle: perIdle, Total: perTotal})
+				perCPUDetailStats = append(perCPUDetailStats, parseCPUDetailedStat(perNums))
 			}
 
-			return cpuStat, detailedStat, perCPUStats
+			return cpuStat, detailedStat, perCPUStats, perCPUDetailStats
 		}
 	}
 
-	// 如果/proc/stat获取失败，尝试使用跨平台的gopsutil库
-	percentages, err := cpu.Percent(0, true)
-	if err == nil && len(percentages) > 0 {
-		// 构建每个核心的CPUStat
-		var perCPUStats []CPUStat
-		for _, percent := range percentages {
-			// 根据百分比计算模拟的Idle和Total值
-			// 这里使用一个较大的基数，以获得更准确的百分比计算
-			base := uint64(10000)
-			used := uint64(percent * 100)
-			idle := base - used
-			perCPUStats = append(perCPUStats, CPUStat{Idle: idle, Total: base})
-		}
-
-		// 构建整体CPUStat
-		var totalIdle, totalTotal uint64
-		for _, stat := range perCPUStats {
-			totalIdle += stat.Idle
-			totalTotal += stat.Total
-		}
-		cpuStat := CPUStat{Idle: totalIdle, Total: totalTotal}
-
-		// 构建详细CPUStat（使用模拟值）
-		detailedStat := CPUDetailedStat{
-			User:   totalIdle / 4,
-			System: totalIdle / 4,
-			Idle:   totalIdle / 2,
-			Total:  totalTotal,
+	// 如果/proc/stat获取失败，使用跨平台的gopsutil库读取累计CPU时间
+	totalTimes, err := cpu.Times(false)
+	if err != nil || len(totalTimes) == 0 {
+		// 如果所有方法都失败，返回空值
+		return CPUStat{}, CPUDetailedStat{}, nil, nil
+	}
+	detailedStat := timesToDetailedStat(totalTimes[0])
+
+	var perCPUStats []CPUStat
+	var perCPUDetailStats []CPUDetailedStat
+	if perTimes, err := cpu.Times(true); err == nil {
+		for _, t := range perTimes {
+			perDetail := timesToDetailedStat(t)
+			perCPUStats = append(perCPUStats, perDetail.cpuStat())
+			perCPUDetailStats = append(perCPUDetailStats, perDetail)
 		}
-
-		return cpuStat, detailedStat, perCPUStats
 	}
+	return detailedStat.cpuStat(), detailedStat, perCPUStats, perCPUDetailStats
+}
 
-	// 如果所有方法都失败，返回空值
-	return CPUStat{}, CPUDetailedStat{}, nil
+// deltaTicks 计算计数器差值，计数器回退（如CPU下线后重新上线）时按0处理
+func deltaTicks(prev, cur uint64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur - prev)
 }
 
 func calcCPUPercent(prev, cur CPUStat) float64 {
-	deltaIdle := float64(cur.Idle - prev.Idle)
-	deltaTotal := float64(cur.Total - prev.Total)
+	deltaIdle := deltaTicks(prev.Idle, cur.Idle)
+	deltaTotal := deltaTicks(prev.Total, cur.Total)
 	if deltaTotal <= 0 {
 		return 0
 	}
-	return (1 - deltaIdle/deltaTotal) * 100
+	percent := (1 - deltaIdle/deltaTotal) * 100
+	if percent < 0 {
+		return 0
+	}
+	return percent
 }
 
 func calcCPUDetailedPercent(prev, cur CPUDetailedStat) CPUDetailedPercent {
-	deltaTotal := float64(cur.Total - prev.Total)
+	deltaTotal := deltaTicks(prev.Total, cur.Total)
 	if deltaTotal <= 0 {
 		return CPUDetailedPercent{Idle: 100}
 	}
 
 	return CPUDetailedPercent{
-		User:    float64(cur.User-prev.User) / deltaTotal * 100,
-		System:  float64(cur.System-prev.System) / deltaTotal * 100,
-		Nice:    float64(cur.Nice-prev.Nice) / deltaTotal * 100,
-		Idle:    float64(cur.Idle-prev.Idle) / deltaTotal * 100,
-		Iowait:  float64(cur.Iowait-prev.Iowait) / deltaTotal * 100,
-		Irq:     float64(cur.Irq-prev.Irq) / deltaTotal * 100,
-		Softirq: float64(cur.Softirq-prev.Softirq) / deltaTotal * 100,
-		Steal:   float64(cur.Steal-prev.Steal) / deltaTotal * 100,
+		User:      deltaTicks(prev.User, cur.User) / deltaTotal * 100,
+		System:    deltaTicks(prev.System, cur.System) / deltaTotal * 100,
+		Nice:      deltaTicks(prev.Nice, cur.Nice) / deltaTotal * 100,
+		Idle:      deltaTicks(prev.Idle, cur.Idle) / deltaTotal * 100,
+		Iowait:    deltaTicks(prev.Iowait, cur.Iowait) / deltaTotal * 100,
+		Irq:       deltaTicks(prev.Irq, cur.Irq) / deltaTotal * 100,
+		Softirq:   deltaTicks(prev.Softirq, cur.Softirq) / deltaTotal * 100,
+		Steal:     deltaTicks(prev.Steal, cur.Steal) / deltaTotal * 100,
+		Guest:     deltaTicks(prev.Guest, cur.Guest) / deltaTotal * 100,
+		GuestNice: deltaTicks(prev.GuestNice, cur.GuestNice) / deltaTotal * 100,
 	}
 }
@@ -7,11 +7,6 @@ import (
 	"github.com/shirou/gopsutil/v4/disk"
 )
 
-const (
-	diskUsageCacheInterval     = 30 * time.Second
-	diskPartitionCacheInterval = 10 * time.Minute
-)
-
 type DiskUsageEntry struct {
 	lastSampleTime time.Time
 	cachedUsage    *disk.UsageStat
@@ -29,7 +24,7 @@ type DiskState struct {
 func (d *DiskState) GetUsage(path string, forceRefresh bool) (*disk.UsageStat, error) {
 	d.usageMu.RLock()
 	if entry, ok := d.usageCache[path]; ok {
-		if time.Since(entry.lastSampleTime) < diskUsageCacheInterval && !forceRefresh {
+		if time.Since(entry.lastSampleTime) < currentIntervals().DiskUsage && !forceRefresh {
 			defer d.usageMu.RUnlock()
 			return entry.cachedUsage, nil
 		}
@@ -56,7 +51,7 @@ func (d *DiskState) GetUsage(path string, forceRefresh bool) (*disk.UsageStat, e
 
 func (d *DiskState) GetPartitions(all bool, forceRefresh bool) ([]disk.PartitionStat, error) {
 	d.partitionMu.RLock()
-	if d.cachedPartitions != nil && time.Since(d.lastPartitionTime) < diskPartitionCacheInterval && !forceRefresh {
+	if d.cachedPartitions != nil && time.Since(d.lastPartitionTime) < currentIntervals().Partition && !forceRefresh {
 		defer d.partitionMu.RUnlock()
 		return d.cachedPartitions, nil
 	}
@@ -0,0 +1,119 @@
+package psutil
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// DiskIOStat 单个块设备的累计计数与 iostat -x 风格的区间指标
+type DiskIOStat struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"` // device-mapper 设备的名称，如 vg-root
+	Serial string `json:"serial"`
+
+	ReadCount      uint64 `json:"readCount"`
+	WriteCount     uint64 `json:"writeCount"`
+	ReadBytes      uint64 `json:"readBytes"`
+	WriteBytes     uint64 `json:"writeBytes"`
+	ReadTime       uint64 `json:"readTime"`  // 毫秒
+	WriteTime      uint64 `json:"writeTime"` // 毫秒
+	IoTime         uint64 `json:"ioTime"`    // 毫秒
+	IopsInProgress uint64 `json:"iopsInProgress"`
+
+	// 以下指标基于相邻两次采样计算，首次采样或计数器重置时为0
+	ReadIOPS        float64 `json:"readIops"`
+	WriteIOPS       float64 `json:"writeIops"`
+	ReadMergedRate  float64 `json:"readMergedRate"`
+	WriteMergedRate float64 `json:"writeMergedRate"`
+	ReadBytesRate   float64 `json:"readBytesRate"`
+	WriteBytesRate  float64 `json:"writeBytesRate"`
+	ReadAwait       float64 `json:"readAwait"`   // 读请求平均耗时（毫秒）
+	WriteAwait      float64 `json:"writeAwait"`  // 写请求平均耗时（毫秒）
+	Await           float64 `json:"await"`       // 读写请求平均耗时（毫秒）
+	UtilPercent     float64 `json:"utilPercent"` // 设备忙碌时间占比
+	QueueDepth      float64 `json:"queueDepth"`  // 平均队列长度（aqu-sz）
+}
+
+type DiskIOState struct {
+	mu             sync.Mutex
+	lastSampleTime time.Time
+	lastCounters   map[string]disk.IOCountersStat
+	cachedStats    []DiskIOStat
+}
+
+// GetIOStats 返回每个块设备的I/O统计，距上次采样不足 Intervals.CPU 时返回缓存
+func (d *DiskIOState) GetIOStats() ([]DiskIOStat, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if !d.lastSampleTime.IsZero() && now.Sub(d.lastSampleTime) < currentIntervals().CPU {
+		return d.cachedStats, nil
+	}
+
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed := now.Sub(d.lastSampleTime).Seconds()
+	stats := make([]DiskIOStat, 0, len(counters))
+	for name, c := range counters {
+		stat := DiskIOStat{
+			Name:           name,
+			Label:          c.Label,
+			Serial:         c.SerialNumber,
+			ReadCount:      c.ReadCount,
+			WriteCount:     c.WriteCount,
+			ReadBytes:      c.ReadBytes,
+			WriteBytes:     c.WriteBytes,
+			ReadTime:       c.ReadTime,
+			WriteTime:      c.WriteTime,
+			IoTime:         c.IoTime,
+			IopsInProgress: c.IopsInProgress,
+		}
+		if prev, ok := d.lastCounters[name]; ok && elapsed > 0 {
+			stat.calcInterval(prev, c, elapsed)
+		}
+		stats = append(stats, stat)
+	}
+	slices.SortFunc(stats, func(a, b DiskIOStat) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	d.lastCounters = counters
+	d.lastSampleTime = now
+	d.cachedStats = stats
+	return stats, nil
+}
+
+// calcInterval 按 iostat -x 的算法计算区间指标
+func (s *DiskIOStat) calcInterval(prev, cur disk.IOCountersStat, elapsed float64) {
+	reads := counterDelta(prev.ReadCount, cur.ReadCount)
+	writes := counterDelta(prev.WriteCount, cur.WriteCount)
+	readTime := counterDelta(prev.ReadTime, cur.ReadTime)
+	writeTime := counterDelta(prev.WriteTime, cur.WriteTime)
+	elapsedMs := elapsed * 1000
+
+	s.ReadIOPS = float64(reads) / elapsed
+	s.WriteIOPS = float64(writes) / elapsed
+	s.ReadMergedRate = counterRate(prev.MergedReadCount, cur.MergedReadCount, elapsed)
+	s.WriteMergedRate = counterRate(prev.MergedWriteCount, cur.MergedWriteCount, elapsed)
+	s.ReadBytesRate = counterRate(prev.ReadBytes, cur.ReadBytes, elapsed)
+	s.WriteBytesRate = counterRate(prev.WriteBytes, cur.WriteBytes, elapsed)
+	if reads > 0 {
+		s.ReadAwait = float64(readTime) / float64(reads)
+	}
+	if writes > 0 {
+		s.WriteAwait = float64(writeTime) / float64(writes)
+	}
+	if reads+writes > 0 {
+		s.Await = float64(readTime+writeTime) / float64(reads+writes)
+	}
+	s.UtilPercent = min(float64(counterDelta(prev.IoTime, cur.IoTime))/elapsedMs*100, 100)
+	s.QueueDepth = float64(counterDelta(prev.WeightedIO, cur.WeightedIO)) / elapsedMs
+}
@@ -10,8 +10,6 @@ import (
 	"github.com/shirou/gopsutil/v4/host"
 )
 
-const hostRefreshInterval = 4 * time.Hour
-
 type HostInfoState struct {
 	mu             sync.RWMutex
 	lastSampleTime time.Time
@@ -22,7 +20,7 @@ type HostInfoState struct {
 
 func (h *HostInfoState) GetHostInfo(forceRefresh bool) (*host.InfoStat, error) {
 	h.mu.RLock()
-	if h.cachedInfo != nil && time.Since(h.lastSampleTime) < hostRefreshInterval && !forceRefresh {
+	if h.cachedInfo != nil && time.Since(h.lastSampleTime) < currentIntervals().HostInfo && !forceRefresh {
 		defer h.mu.RUnlock()
 		return h.cachedInfo, nil
 	}
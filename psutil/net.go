@@ -0,0 +1,167 @@
+package psutil
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	psNet "github.com/shirou/gopsutil/v4/net"
+)
+
+// NetInterfaceStat 单个网卡的信息、累计计数与速率
+type NetInterfaceStat struct {
+	Name         string   `json:"name"`
+	HardwareAddr string   `json:"hardwareAddr"`
+	MTU          int      `json:"mtu"`
+	Addrs        []string `json:"addrs"`
+	Up           bool     `json:"up"`
+	Flags        []string `json:"flags"`
+
+	BytesSent   uint64 `json:"bytesSent"`
+	BytesRecv   uint64 `json:"bytesRecv"`
+	PacketsSent uint64 `json:"packetsSent"`
+	PacketsRecv uint64 `json:"packetsRecv"`
+	Errin       uint64 `json:"errin"`
+	Errout      uint64 `json:"errout"`
+	Dropin      uint64 `json:"dropin"`
+	Dropout     uint64 `json:"dropout"`
+
+	// 以下速率基于相邻两次采样计算（每秒），首次采样或计数器重置时为0
+	BytesSentRate   float64 `json:"bytesSentRate"`
+	BytesRecvRate   float64 `json:"bytesRecvRate"`
+	PacketsSentRate float64 `json:"packetsSentRate"`
+	PacketsRecvRate float64 `json:"packetsRecvRate"`
+	ErrinRate       float64 `json:"errinRate"`
+	ErroutRate      float64 `json:"erroutRate"`
+	DropinRate      float64 `json:"dropinRate"`
+	DropoutRate     float64 `json:"dropoutRate"`
+}
+
+type netSample struct {
+	index    int
+	counters psNet.IOCountersStat
+}
+
+type NetState struct {
+	mu             sync.Mutex
+	lastSampleTime time.Time
+	lastSamples    map[string]netSample
+	cachedStats    []NetInterfaceStat
+
+	interfaceTime    time.Time
+	cachedInterfaces map[string]psNet.InterfaceStat
+}
+
+// GetInterfaceStats 返回每个网卡的统计信息，距上次采样不足 Intervals.CPU 时返回缓存
+func (n *NetState) GetInterfaceStats() ([]NetInterfaceStat, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if !n.lastSampleTime.IsZero() && now.Sub(n.lastSampleTime) < currentIntervals().CPU {
+		return n.cachedStats, nil
+	}
+
+	counters, err := psNet.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+	interfaces := n.interfaces(now, false)
+	for _, c := range counters {
+		if _, ok := interfaces[c.Name]; !ok {
+			// 出现新网卡时立即刷新元信息
+			interfaces = n.interfaces(now, true)
+			break
+		}
+	}
+
+	elapsed := now.Sub(n.lastSampleTime).Seconds()
+	samples := make(map[string]netSample, len(counters))
+	stats := make([]NetInterfaceStat, 0, len(counters))
+	for _, c := range counters {
+		iface := interfaces[c.Name]
+		stat := NetInterfaceStat{
+			Name:         c.Name,
+			HardwareAddr: iface.HardwareAddr,
+			MTU:          iface.MTU,
+			Addrs:        make([]string, 0, len(iface.Addrs)),
+			Up:           slices.Contains(iface.Flags, "up"),
+			Flags:        iface.Flags,
+			BytesSent:    c.BytesSent,
+			BytesRecv:    c.BytesRecv,
+			PacketsSent:  c.PacketsSent,
+			PacketsRecv:  c.PacketsRecv,
+			Errin:        c.Errin,
+			Errout:       c.Errout,
+			Dropin:       c.Dropin,
+			Dropout:      c.Dropout,
+		}
+		for _, addr := range iface.Addrs {
+			stat.Addrs = append(stat.Addrs, addr.Addr)
+		}
+		if stat.Flags == nil {
+			stat.Flags = []string{}
+		}
+
+		// 网卡被删除后重建（index变化）时计数器从0开始，不计算速率
+		prev, ok := n.lastSamples[c.Name]
+		if ok && elapsed > 0 && prev.index == iface.Index {
+			p := prev.counters
+			stat.BytesSentRate = counterRate(p.BytesSent, c.BytesSent, elapsed)
+			stat.BytesRecvRate = counterRate(p.BytesRecv, c.BytesRecv, elapsed)
+			stat.PacketsSentRate = counterRate(p.PacketsSent, c.PacketsSent, elapsed)
+			stat.PacketsRecvRate = counterRate(p.PacketsRecv, c.PacketsRecv, elapsed)
+			stat.ErrinRate = counterRate(p.Errin, c.Errin, elapsed)
+			stat.ErroutRate = counterRate(p.Errout, c.Errout, elapsed)
+			stat.DropinRate = counterRate(p.Dropin, c.Dropin, elapsed)
+			stat.DropoutRate = counterRate(p.Dropout, c.Dropout, elapsed)
+		}
+		samples[c.Name] = netSample{index: iface.Index, counters: c}
+		stats = append(stats, stat)
+	}
+	slices.SortFunc(stats, func(a, b NetInterfaceStat) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	n.lastSamples = samples
+	n.lastSampleTime = now
+	n.cachedStats = stats
+	return stats, nil
+}
+
+// interfaces 网卡元信息变化不频繁，按 Intervals.Interface 缓存，调用方需持有锁
+func (n *NetState) interfaces(now time.Time, forceRefresh bool) map[string]psNet.InterfaceStat {
+	if n.cachedInterfaces != nil && now.Sub(n.interfaceTime) < currentIntervals().Interface && !forceRefresh {
+		return n.cachedInterfaces
+	}
+	list, err := psNet.Interfaces()
+	if err != nil {
+		return n.cachedInterfaces
+	}
+	interfaces := make(map[string]psNet.InterfaceStat, len(list))
+	for _, iface := range list {
+		interfaces[iface.Name] = iface
+	}
+	n.cachedInterfaces = interfaces
+	n.interfaceTime = now
+	return interfaces
+}
+
+// counterDelta 计算计数器增量
+// 计数器变小时：旧值接近32位上限视为32位计数器回绕，否则视为计数器被重置，本次增量记为0
+func counterDelta(prev, cur uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if prev <= math.MaxUint32 && prev > math.MaxUint32/2 {
+		return math.MaxUint32 - prev + cur + 1
+	}
+	return 0
+}
+
+// counterRate 计算计数器每秒增量
+func counterRate(prev, cur uint64, elapsed float64) float64 {
+	return float64(counterDelta(prev, cur)) / elapsed
+}
@@ -1,6 +1,45 @@
 package psutil
 
+import (
+	"sync/atomic"
+	"time"
+)
+
 var CPU = &CPUUsageState{}
 var CPUInfo = &CPUInfoState{}
 var HOST = &HostInfoState{}
 var DISK = &DiskState{}
+var NET = &NetState{}
+var DISKIO = &DiskIOState{}
+
+// Intervals 各类采集数据的缓存时间，由调用方按配置设置
+type Intervals struct {
+	CPU       time.Duration // CPU、网卡、磁盘I/O 两次采样的最小间隔，间隔内返回缓存
+	CPUReset  time.Duration // CPU 基线超过该时间后重新建立
+	HostInfo  time.Duration // 主机信息缓存时间
+	DiskUsage time.Duration // 磁盘使用量缓存时间
+	Partition time.Duration // 分区列表缓存时间
+	Interface time.Duration // 网卡元信息缓存时间
+}
+
+var intervals atomic.Pointer[Intervals]
+
+func init() {
+	SetIntervals(Intervals{
+		CPU:       3 * time.Second,
+		CPUReset:  time.Minute,
+		HostInfo:  4 * time.Hour,
+		DiskUsage: 30 * time.Second,
+		Partition: 10 * time.Minute,
+		Interface: time.Minute,
+	})
+}
+
+// SetIntervals 替换缓存时间，下一次采集时生效
+func SetIntervals(i Intervals) {
+	intervals.Store(&i)
+}
+
+func currentIntervals() *Intervals {
+	return intervals.Load()
+}
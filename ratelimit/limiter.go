@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"chihqiang/hoststat/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval 清理已补满的令牌桶的间隔
+const pruneInterval = time.Minute
+
+// bucket 一个调用方的令牌桶，tokens 按 rateLimit.rate 每秒补充，最多 rateLimit.burst 个
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter 按调用方（API Key、用户、客户端证书或来源 IP）限制请求频率，每个请求按接口开销扣除令牌
+type Limiter struct {
+	// limits 返回每秒补充的令牌数与桶容量，每次调用时读取，重新加载配置后立即生效
+	limits  func() (rate, burst int)
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+func NewLimiter(limits func() (rate, burst int)) *Limiter {
+	return &Limiter{limits: limits, buckets: make(map[string]*bucket)}
+}
+
+// LIMITER 认证之后按调用方限流，使用 rateLimit.rate 与 rateLimit.burst
+var LIMITER = NewLimiter(func() (int, int) {
+	cfg := config.Get().RateLimit
+	return cfg.Rate, cfg.Burst
+})
+
+// CLIENTS 认证之前按来源 IP 限流，使用 rateLimit.ipRate 与 rateLimit.ipBurst；
+// 无效的凭据、登录请求和 WebSocket 握手在认证前就会被拦截，不会消耗认证与审计的开销
+var CLIENTS = NewLimiter(func() (int, int) {
+	cfg := config.Get().RateLimit
+	return cfg.IPRate, cfg.IPBurst
+})
+
+// Allow 扣除 cost 个令牌；令牌不足时不扣除，返回 false 与补足所需的等待时间
+// 每秒补充的令牌数为 0 时不限流
+func (l *Limiter) Allow(key string, cost int, now time.Time) (time.Duration, bool) {
+	perSecond, capacity := l.limits()
+	if perSecond <= 0 {
+		return 0, true
+	}
+	rate, burst := float64(perSecond), float64(max(capacity, 1))
+	// 开销超过桶容量的请求按桶容量计算，否则永远无法通过
+	need := min(float64(cost), burst)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.pruned) > pruneInterval {
+		l.prune(now, rate, burst)
+		l.pruned = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < need {
+		wait := (need - b.tokens) / rate
+		return time.Duration(math.Ceil(wait * float64(time.Second))), false
+	}
+	b.tokens -= need
+	return 0, true
+}
+
+// Len 当前记录的调用方数量
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// prune 删除已经补满的令牌桶，与新建的桶等价；调用方需持有锁
+func (l *Limiter) prune(now time.Time, rate, burst float64) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+			delete(l.buckets, key)
+		}
+	}
+}
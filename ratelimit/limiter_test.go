@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var testBase = time.Unix(1_700_000_000, 0)
+
+func fixedLimits(rate, burst int) func() (int, int) {
+	return func() (int, int) { return rate, burst }
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l := NewLimiter(fixedLimits(2, 4))
+	if _, ok := l.Allow("alice", 4, testBase); !ok {
+		t.Fatal("full bucket rejects a request of burst cost")
+	}
+	wait, ok := l.Allow("alice", 1, testBase)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("empty bucket = (%v, %v), want (500ms, false)", wait, ok)
+	}
+	// 被拒绝的请求不扣除令牌，等待给出的时间后即可通过
+	if _, ok := l.Allow("alice", 1, testBase.Add(wait)); !ok {
+		t.Fatal("request is rejected after the returned wait")
+	}
+	if _, ok := l.Allow("bob", 4, testBase); !ok {
+		t.Fatal("callers share a bucket")
+	}
+	// 补充不超过桶容量
+	if _, ok := l.Allow("alice", 4, testBase.Add(time.Hour)); !ok {
+		t.Fatal("bucket is not refilled after an hour")
+	}
+	if wait, ok := l.Allow("alice", 1, testBase.Add(time.Hour)); ok || wait != 500*time.Millisecond {
+		t.Fatalf("refilled bucket = (%v, %v), want (500ms, false)", wait, ok)
+	}
+}
+
+// 开销超过桶容量的请求按桶容量扣除，等待时间也按桶容量计算
+func TestLimiterClampsCostToBurst(t *testing.T) {
+	l := NewLimiter(fixedLimits(2, 4))
+	if _, ok := l.Allow("alice", 10, testBase); !ok {
+		t.Fatal("request costing more than burst never passes")
+	}
+	if wait, ok := l.Allow("alice", 10, testBase); ok || wait != 2*time.Second {
+		t.Fatalf("empty bucket = (%v, %v), want (2s, false)", wait, ok)
+	}
+	if wait, ok := l.Allow("alice", 10, testBase.Add(1500*time.Millisecond)); ok || wait != 500*time.Millisecond {
+		t.Fatalf("partly refilled bucket = (%v, %v), want (500ms, false)", wait, ok)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := NewLimiter(fixedLimits(0, 0))
+	for range 100 {
+		if wait, ok := l.Allow("alice", 10, testBase); !ok || wait != 0 {
+			t.Fatalf("disabled limiter = (%v, %v), want (0, true)", wait, ok)
+		}
+	}
+	if n := l.Len(); n != 0 {
+		t.Fatalf("disabled limiter keeps %d buckets", n)
+	}
+}
+
+// 已补满的令牌桶在清理间隔后删除，未补满的保留
+func TestLimiterPrunesIdleBuckets(t *testing.T) {
+	l := NewLimiter(fixedLimits(1, 100))
+	l.Allow("busy", 100, testBase)
+	l.Allow("idle", 1, testBase)
+	if n := l.Len(); n != 2 {
+		t.Fatalf("buckets = %d, want 2", n)
+	}
+	l.Allow("new", 1, testBase.Add(pruneInterval/2))
+	if n := l.Len(); n != 3 {
+		t.Fatalf("buckets before prune interval = %d, want 3", n)
+	}
+	later := testBase.Add(pruneInterval + time.Second)
+	l.Allow("other", 1, later)
+	if n := l.Len(); n != 2 {
+		t.Fatalf("buckets after prune = %d, want 2 (busy, other)", n)
+	}
+	// 未补满的桶保留了剩余令牌
+	if wait, ok := l.Allow("busy", 100, later); ok || wait != 39*time.Second {
+		t.Fatalf("busy bucket = (%v, %v), want (39s, false)", wait, ok)
+	}
+}
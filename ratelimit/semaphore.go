@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"chihqiang/hoststat/config"
+	"context"
+	"sync"
+	"time"
+)
+
+// Semaphore 限制同时执行的重型采集（遍历全部进程、读取主机信息等）数量，所有调用方共用
+// 上限取自 rateLimit.maxConcurrent，重新加载配置后立即生效
+type Semaphore struct {
+	mu       sync.Mutex
+	inflight int
+	// released 有名额释放时关闭并替换，唤醒所有等待者
+	released chan struct{}
+}
+
+var HEAVY = &Semaphore{released: make(chan struct{})}
+
+// Acquire 获取一个名额，名额已满时最多等待 rateLimit.queueTimeout；成功后必须调用 Release
+// rateLimit.maxConcurrent 为 0 时不限制
+func (s *Semaphore) Acquire(ctx context.Context) bool {
+	cfg := config.Get().RateLimit
+	timer := time.NewTimer(cfg.QueueTimeout.Std())
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		if cfg.MaxConcurrent <= 0 || s.inflight < cfg.MaxConcurrent {
+			s.inflight++
+			s.mu.Unlock()
+			return true
+		}
+		released := s.released
+		s.mu.Unlock()
+		select {
+		case <-released:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Release 归还 Acquire 获取的名额
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight--
+	close(s.released)
+	s.released = make(chan struct{})
+}
+
+// InFlight 正在执行的重型采集数量
+func (s *Semaphore) InFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inflight
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"chihqiang/hoststat/config"
+	"context"
+	"testing"
+	"time"
+)
+
+func useSemaphore(t *testing.T, maxConcurrent int, queueTimeout time.Duration) *Semaphore {
+	t.Helper()
+	cfg := config.Default()
+	cfg.RateLimit.MaxConcurrent = maxConcurrent
+	cfg.RateLimit.QueueTimeout = config.Duration(queueTimeout)
+	config.Set(cfg)
+	return &Semaphore{released: make(chan struct{})}
+}
+
+func TestSemaphoreQueueTimeout(t *testing.T) {
+	s := useSemaphore(t, 1, 50*time.Millisecond)
+	if !s.Acquire(context.Background()) {
+		t.Fatal("first acquire fails")
+	}
+	start := time.Now()
+	if s.Acquire(context.Background()) {
+		t.Fatal("acquire succeeds beyond maxConcurrent")
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("acquire gave up after %v, want at least the queue timeout", elapsed)
+	}
+	if n := s.InFlight(); n != 1 {
+		t.Fatalf("in flight = %d, want 1", n)
+	}
+	s.Release()
+	if !s.Acquire(context.Background()) {
+		t.Fatal("acquire fails after release")
+	}
+}
+
+func TestSemaphoreContextCancel(t *testing.T) {
+	s := useSemaphore(t, 1, time.Minute)
+	s.Acquire(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if s.Acquire(ctx) {
+		t.Fatal("acquire succeeds beyond maxConcurrent")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("acquire ignored the canceled context for %v", elapsed)
+	}
+	if n := s.InFlight(); n != 1 {
+		t.Fatalf("in flight = %d, want 1", n)
+	}
+}
+
+// 等待中的调用方在名额释放后获取名额
+func TestSemaphoreReleaseWakesWaiter(t *testing.T) {
+	s := useSemaphore(t, 1, time.Minute)
+	s.Acquire(context.Background())
+	acquired := make(chan bool)
+	go func() { acquired <- s.Acquire(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	s.Release()
+	select {
+	case ok := <-acquired:
+		if !ok {
+			t.Fatal("waiter fails after release")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("waiter is not woken by release")
+	}
+	if n := s.InFlight(); n != 1 {
+		t.Fatalf("in flight = %d, want 1", n)
+	}
+}
+
+func TestSemaphoreUnlimited(t *testing.T) {
+	s := useSemaphore(t, 0, time.Millisecond)
+	for range 10 {
+		if !s.Acquire(context.Background()) {
+			t.Fatal("acquire fails with maxConcurrent 0")
+		}
+	}
+	if n := s.InFlight(); n != 10 {
+		t.Fatalf("in flight = %d, want 10", n)
+	}
+}
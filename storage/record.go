@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"chihqiang/hoststat/history"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"time"
+)
+
+// 记录格式：| 4字节负载长度 | 4字节CRC32 | 负载 |
+// 负载：int64 时间(UnixNano) | uvarint 字段数 | 每个字段：uvarint 名称长度 | 名称 | uvarint count | 数值
+// count 为 1 时只存一个 float64，否则依次存 min/avg/max
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 20
+)
+
+var (
+	errShortRecord   = errors.New("short record")
+	errCorruptRecord = errors.New("corrupt record")
+	// errRecordTooLarge 超过 maxRecordSize 的记录读取时会被当作损坏，写入前拒绝
+	errRecordTooLarge = errors.New("record too large")
+)
+
+// Record 一个时间点上各字段的聚合值，原始样本的 count 为 1
+type Record struct {
+	Time   time.Time
+	Points map[string]history.Point
+}
+
+// encodeRecord 负载超过 maxRecordSize 时返回 errRecordTooLarge，不写入读取时会被截断的记录
+func encodeRecord(rec Record) ([]byte, error) {
+	names := make([]string, 0, len(rec.Points))
+	for name := range rec.Points {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	payload := make([]byte, 8, 64+len(names)*32)
+	binary.LittleEndian.PutUint64(payload, uint64(rec.Time.UnixNano()))
+	payload = binary.AppendUvarint(payload, uint64(len(names)))
+	for _, name := range names {
+		p := rec.Points[name]
+		payload = binary.AppendUvarint(payload, uint64(len(name)))
+		payload = append(payload, name...)
+		payload = binary.AppendUvarint(payload, uint64(p.Count))
+		if p.Count == 1 {
+			payload = binary.LittleEndian.AppendUint64(payload, math.Float64bits(p.Avg))
+			continue
+		}
+		payload = binary.LittleEndian.AppendUint64(payload, math.Float64bits(p.Min))
+		payload = binary.LittleEndian.AppendUint64(payload, math.Float64bits(p.Avg))
+		payload = binary.LittleEndian.AppendUint64(payload, math.Float64bits(p.Max))
+	}
+
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", errRecordTooLarge, len(payload), maxRecordSize)
+	}
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	return append(buf, payload...), nil
+}
+
+// decodeRecord 从 data 头部解析一条记录，返回记录及其占用的字节数
+// fields 非空时只保留其中的字段
+func decodeRecord(data []byte, fields map[string]struct{}) (Record, int, error) {
+	if len(data) < recordHeaderSize {
+		return Record{}, 0, errShortRecord
+	}
+	size := int(binary.LittleEndian.Uint32(data[0:4]))
+	if size < 9 || size > maxRecordSize {
+		return Record{}, 0, errCorruptRecord
+	}
+	if len(data) < recordHeaderSize+size {
+		return Record{}, 0, errShortRecord
+	}
+	payload := data[recordHeaderSize : recordHeaderSize+size]
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(data[4:8]) {
+		return Record{}, 0, errCorruptRecord
+	}
+
+	rec := Record{
+		Time:   time.Unix(0, int64(binary.LittleEndian.Uint64(payload))),
+		Points: make(map[string]history.Point),
+	}
+	r := &byteReader{buf: payload[8:]}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Record{}, 0, errCorruptRecord
+	}
+	for i := uint64(0); i < n; i++ {
+		nameLen, err := binary.ReadUvarint(r)
+		if err != nil {
+			return Record{}, 0, errCorruptRecord
+		}
+		name, err := r.next(int(nameLen))
+		if err != nil {
+			return Record{}, 0, errCorruptRecord
+		}
+		count, err := binary.ReadUvarint(r)
+		if err != nil {
+			return Record{}, 0, errCorruptRecord
+		}
+		p := history.Point{Time: rec.Time, Count: int(count)}
+		if count == 1 {
+			if p.Avg, err = r.float(); err != nil {
+				return Record{}, 0, errCorruptRecord
+			}
+			p.Min, p.Max = p.Avg, p.Avg
+		} else {
+			if p.Min, err = r.float(); err != nil {
+				return Record{}, 0, errCorruptRecord
+			}
+			if p.Avg, err = r.float(); err != nil {
+				return Record{}, 0, errCorruptRecord
+			}
+			if p.Max, err = r.float(); err != nil {
+				return Record{}, 0, errCorruptRecord
+			}
+		}
+		if fields != nil {
+			if _, ok := fields[string(name)]; !ok {
+				continue
+			}
+		}
+		rec.Points[string(name)] = p
+	}
+	return rec, recordHeaderSize + size, nil
+}
+
+type byteReader struct {
+	buf []byte
+	off int
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	if b.off >= len(b.buf) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	c := b.buf[b.off]
+	b.off++
+	return c, nil
+}
+
+func (b *byteReader) next(n int) ([]byte, error) {
+	if n < 0 || b.off+n > len(b.buf) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	data := b.buf[b.off : b.off+n]
+	b.off += n
+	return data, nil
+}
+
+func (b *byteReader) float() (float64, error) {
+	data, err := b.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+}
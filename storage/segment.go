@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const segmentExt = ".seg"
+
+// segmentMeta 段文件的索引信息，持久化在 index.json 中
+type segmentMeta struct {
+	File    string    `json:"file"`
+	MinTime time.Time `json:"minTime"`
+	MaxTime time.Time `json:"maxTime"`
+	Size    int64     `json:"size"`
+	Count   int       `json:"count"`
+}
+
+// segment 只追加写入的段文件，只有每层最后一个段处于打开状态
+type segment struct {
+	segmentMeta
+	path string
+	file *os.File
+}
+
+func segmentName(t time.Time) string {
+	return fmt.Sprintf("%020d%s", t.UnixNano(), segmentExt)
+}
+
+func createSegment(dir string, t time.Time) (*segment, error) {
+	name := segmentName(t)
+	path := filepath.Join(dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &segment{segmentMeta: segmentMeta{File: name, MinTime: t, MaxTime: t}, path: path, file: file}, nil
+}
+
+// openForAppend 重新打开已存在的段用于继续追加
+func (s *segment) openForAppend() error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	return nil
+}
+
+// write 追加一条已编码的记录，data 为 encodeRecord(rec) 的结果
+func (s *segment) write(rec Record, data []byte) error {
+	if s.file == nil {
+		return errors.New("segment is sealed")
+	}
+	if _, err := s.file.Write(data); err != nil {
+		return err
+	}
+	if s.Count == 0 || rec.Time.Before(s.MinTime) {
+		s.MinTime = rec.Time
+	}
+	if rec.Time.After(s.MaxTime) {
+		s.MaxTime = rec.Time
+	}
+	s.Size += int64(len(data))
+	s.Count++
+	return nil
+}
+
+// seal 同步并关闭段文件，之后只读
+func (s *segment) seal() error {
+	if s.file == nil {
+		return nil
+	}
+	syncErr := s.file.Sync()
+	closeErr := s.file.Close()
+	s.file = nil
+	return errors.Join(syncErr, closeErr)
+}
+
+// scan 依次读取段内记录，遇到损坏或不完整的记录时停止并返回有效数据的长度
+// limit 非负时只读取前 limit 字节，避免读到并发写入中的半条记录
+func (s *segment) scan(limit int64, fields map[string]struct{}, fn func(Record)) (validSize int64, err error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return 0, err
+	}
+	if limit >= 0 && int64(len(data)) > limit {
+		data = data[:limit]
+	}
+	off := 0
+	for off < len(data) {
+		rec, n, err := decodeRecord(data[off:], fields)
+		if err != nil {
+			return int64(off), err
+		}
+		if fn != nil {
+			fn(rec)
+		}
+		off += n
+	}
+	return int64(off), nil
+}
+
+// recover 重新扫描段文件，重建索引信息；尾部存在半截写入时截断到最后一条完整记录
+func (s *segment) recover() error {
+	var meta segmentMeta
+	meta.File = s.File
+	valid, scanErr := s.scan(-1, nil, func(rec Record) {
+		if meta.Count == 0 || rec.Time.Before(meta.MinTime) {
+			meta.MinTime = rec.Time
+		}
+		if rec.Time.After(meta.MaxTime) {
+			meta.MaxTime = rec.Time
+		}
+		meta.Count++
+	})
+	if scanErr != nil {
+		if errors.Is(scanErr, os.ErrNotExist) {
+			return scanErr
+		}
+		logx.Warn("Truncating torn segment tail | file: %s | valid_bytes: %d | error: %v", s.path, valid, scanErr)
+		if err := os.Truncate(s.path, valid); err != nil {
+			return err
+		}
+	}
+	meta.Size = valid
+	if meta.Count == 0 {
+		meta.MinTime, meta.MaxTime = s.MinTime, s.MinTime
+	}
+	s.segmentMeta = meta
+	return nil
+}
+
+// snapshot 复制段的索引信息，用于在不持有存储锁的情况下读取
+func (s *segment) snapshot() *segment {
+	return &segment{segmentMeta: s.segmentMeta, path: s.path}
+}
+
+func (s *segment) remove() error {
+	if err := s.seal(); err != nil {
+		logx.Warn("Seal segment before remove failed | file: %s | error: %v", s.path, err)
+	}
+	return os.Remove(s.path)
+}
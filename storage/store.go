@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"chihqiang/hoststat/history"
+	"errors"
+	"math"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	tierRaw    = "raw"
+	tierMinute = "1m"
+	tierHour   = "1h"
+
+	retentionCheckInterval = time.Minute
+)
+
+// Options 存储配置
+type Options struct {
+	Dir             string
+	Resolution      time.Duration // 原始样本的采样间隔
+	RawRetention    time.Duration
+	MinuteRetention time.Duration
+	HourRetention   time.Duration
+	MaxBytes        int64 // 所有层级合计的最大磁盘占用，0 表示不限制
+}
+
+func DefaultOptions(dir string) Options {
+	return Options{
+		Dir:             dir,
+		Resolution:      5 * time.Second,
+		RawRetention:    24 * time.Hour,
+		MinuteRetention: 7 * 24 * time.Hour,
+		HourRetention:   90 * 24 * time.Hour,
+		MaxBytes:        512 << 20,
+	}
+}
+
+// Store 嵌入式时序存储：原始样本写入 raw 层，同时汇总为 1 分钟与 1 小时两级数据
+type Store struct {
+	mu      sync.Mutex
+	opts    Options
+	tiers   []*tier
+	rollups []*rollup // rollups[i] 将 tiers[i] 的数据汇总写入 tiers[i+1]
+
+	lastRetention time.Time
+}
+
+// rollup 正在累积的汇总桶
+type rollup struct {
+	step   time.Duration
+	start  time.Time
+	points map[string]*accumulator
+}
+
+type accumulator struct {
+	min, max, sum float64
+	count         int
+}
+
+func Open(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("storage dir is empty")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	specs := []struct {
+		name        string
+		resolution  time.Duration
+		retention   time.Duration
+		segmentSpan time.Duration
+	}{
+		{tierRaw, opts.Resolution, opts.RawRetention, time.Hour},
+		{tierMinute, time.Minute, opts.MinuteRetention, 24 * time.Hour},
+		{tierHour, time.Hour, opts.HourRetention, 30 * 24 * time.Hour},
+	}
+	s := &Store{opts: opts}
+	for _, spec := range specs {
+		t, err := openTier(opts.Dir, spec.name, spec.resolution, spec.retention, spec.segmentSpan)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.tiers = append(s.tiers, t)
+	}
+	for i := 1; i < len(s.tiers); i++ {
+		s.rollups = append(s.rollups, &rollup{step: s.tiers[i].resolution, points: make(map[string]*accumulator)})
+	}
+	// 先恢复较粗层级的累积桶，较细层级重放时产生的汇总记录才能继续向上汇总
+	for i := len(s.rollups) - 1; i >= 0; i-- {
+		if err := s.replay(i); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// replay 重启后从下层数据重建未完成的汇总桶
+func (s *Store) replay(level int) error {
+	since := time.Time{}
+	if newest, ok := s.tiers[level+1].newest(); ok {
+		since = newest.Add(s.rollups[level].step)
+	}
+	var recs []Record
+	if err := s.tiers[level].query(since, time.Now().Add(24*time.Hour), nil, func(rec Record) {
+		recs = append(recs, rec)
+	}); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err := s.feed(level, rec); err != nil {
+			return err
+		}
+	}
+	if len(recs) > 0 {
+		logx.Info("Storage rollup replayed | tier: %s | records: %d", s.tiers[level+1].name, len(recs))
+	}
+	return nil
+}
+
+// Append 写入一个原始样本
+func (s *Store) Append(t time.Time, values map[string]float64) error {
+	points := make(map[string]history.Point, len(values))
+	for name, value := range values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		points[name] = history.Point{Time: t, Min: value, Avg: value, Max: value, Count: 1}
+	}
+	rec := Record{Time: t, Points: points}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.tiers[0].append(rec); err != nil {
+		return err
+	}
+	if err := s.feed(0, rec); err != nil {
+		return err
+	}
+	if t.Sub(s.lastRetention) >= retentionCheckInterval {
+		s.lastRetention = t
+		if err := s.enforceRetention(t); err != nil {
+			logx.Error("Storage retention failed | error: %v", err)
+		}
+	}
+	return nil
+}
+
+// feed 把 tiers[level] 的一条记录计入上一层的汇总桶，跨桶时写出已完成的桶
+func (s *Store) feed(level int, rec Record) error {
+	if level >= len(s.rollups) {
+		return nil
+	}
+	r := s.rollups[level]
+	start := rec.Time.Truncate(r.step)
+	if !r.start.Equal(start) {
+		if out, ok := r.flush(); ok {
+			if err := s.tiers[level+1].append(out); err != nil {
+				return err
+			}
+			if err := s.feed(level+1, out); err != nil {
+				return err
+			}
+		}
+		r.start = start
+	}
+	r.add(rec)
+	return nil
+}
+
+func (r *rollup) add(rec Record) {
+	for name, p := range rec.Points {
+		acc, ok := r.points[name]
+		if !ok {
+			r.points[name] = &accumulator{min: p.Min, max: p.Max, sum: p.Avg * float64(p.Count), count: p.Count}
+			continue
+		}
+		acc.min = math.Min(acc.min, p.Min)
+		acc.max = math.Max(acc.max, p.Max)
+		acc.sum += p.Avg * float64(p.Count)
+		acc.count += p.Count
+	}
+}
+
+func (r *rollup) flush() (Record, bool) {
+	if len(r.points) == 0 {
+		return Record{}, false
+	}
+	rec := Record{Time: r.start, Points: make(map[string]history.Point, len(r.points))}
+	for name, acc := range r.points {
+		if acc.count == 0 {
+			continue
+		}
+		rec.Points[name] = history.Point{Time: r.start, Min: acc.min, Avg: acc.sum / float64(acc.count), Max: acc.max, Count: acc.count}
+	}
+	r.points = make(map[string]*accumulator)
+	return rec, true
+}
+
+// enforceRetention 先按各层保留时长删除过期段，再按总大小从最细的层级开始删除最旧的段
+func (s *Store) enforceRetention(now time.Time) error {
+	for _, t := range s.tiers {
+		if err := t.expire(now); err != nil {
+			return err
+		}
+	}
+	if s.opts.MaxBytes <= 0 {
+		return nil
+	}
+	for s.size() > s.opts.MaxBytes {
+		removed := false
+		for _, t := range s.tiers {
+			if len(t.segments) > 1 {
+				if err := t.removeOldest(); err != nil {
+					return err
+				}
+				if err := t.writeIndex(); err != nil {
+					return err
+				}
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) size() int64 {
+	var total int64
+	for _, t := range s.tiers {
+		total += t.size()
+	}
+	return total
+}
+
+// Query 查询 [from, to] 范围内的数据并按 step 聚合，fields 为空时返回全部字段
+// 自动选择能覆盖 from 的最细层级；该层级点数过多时改用更粗的层级
+// 只在锁内复制段列表，读取文件时不阻塞写入
+func (s *Store) Query(from, to time.Time, step time.Duration, fields []string, maxPoints int) ([]history.Series, error) {
+	s.mu.Lock()
+	segments := s.pickTier(from, to, step, maxPoints).snapshot()
+	s.mu.Unlock()
+
+	var filter map[string]struct{}
+	if len(fields) > 0 {
+		filter = make(map[string]struct{}, len(fields))
+		for _, field := range fields {
+			filter[field] = struct{}{}
+		}
+	}
+	byField := make(map[string][]history.Point, len(fields))
+	if err := querySegments(segments, from, to, filter, func(rec Record) {
+		for name, p := range rec.Points {
+			byField[name] = append(byField[name], p)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		for field := range byField {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+	}
+
+	origin := from.Truncate(step)
+	series := make([]history.Series, 0, len(fields))
+	for _, field := range fields {
+		series = append(series, history.Series{Field: field, Points: history.MergePoints(byField[field], origin, step)})
+	}
+	return series, nil
+}
+
+func (s *Store) pickTier(from, to time.Time, step time.Duration, maxPoints int) *tier {
+	span := to.Sub(from)
+	for i, t := range s.tiers {
+		if i > 0 && t.resolution > step {
+			break
+		}
+		oldest, ok := t.oldest()
+		if !ok || oldest.After(from) {
+			continue
+		}
+		if t.resolution > 0 && maxPoints > 0 && int(span/t.resolution) > maxPoints*10 {
+			continue
+		}
+		return t
+	}
+	// 没有完全覆盖的层级时，选择数据最早的层级
+	best := s.tiers[0]
+	bestOldest, bestOK := best.oldest()
+	for _, t := range s.tiers[1:] {
+		oldest, ok := t.oldest()
+		if ok && (!bestOK || oldest.Before(bestOldest)) {
+			best, bestOldest, bestOK = t, oldest, true
+		}
+	}
+	return best
+}
+
+// Oldest 返回存储中最早的数据时间
+func (s *Store) Oldest() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest time.Time
+	found := false
+	for _, t := range s.tiers {
+		if o, ok := t.oldest(); ok && (!found || o.Before(oldest)) {
+			oldest, found = o, true
+		}
+	}
+	return oldest, found
+}
+
+// Close 同步并关闭所有段文件；未完成的汇总桶会在下次启动时从下层数据重建
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, t := range s.tiers {
+		errs = append(errs, t.close())
+	}
+	return errors.Join(errs...)
+}
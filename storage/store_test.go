@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"chihqiang/hoststat/history"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testBase = time.Unix(1_700_000_000, 0)
+
+func openTestStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	opts := DefaultOptions(dir)
+	s, err := Open(opts)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	return s
+}
+
+func appendSamples(t *testing.T, s *Store, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := s.Append(testBase.Add(time.Duration(i)*5*time.Second), map[string]float64{"cpu": float64(i)}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+}
+
+func queryCount(t *testing.T, s *Store) int {
+	t.Helper()
+	series, err := s.Query(testBase, testBase.Add(time.Hour), 5*time.Second, []string{"cpu"}, 0)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if len(series) != 1 {
+		t.Fatalf("series = %d, want 1", len(series))
+	}
+	return len(series[0].Points)
+}
+
+// rawSegment 返回 raw 层唯一的段文件路径
+func rawSegment(t *testing.T, dir string) string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, tierRaw, "*"+segmentExt))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("raw segments = %v, err = %v", matches, err)
+	}
+	return matches[0]
+}
+
+func TestRecordRoundTrip(t *testing.T) {
+	rec := Record{Time: testBase, Points: map[string]history.Point{
+		"cpu": {Time: testBase, Min: 1.5, Avg: 1.5, Max: 1.5, Count: 1},
+		"mem": {Time: testBase, Min: 1, Avg: 2, Max: 3, Count: 4},
+	}}
+	data, err := encodeRecord(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, n, err := decodeRecord(data, nil)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if n != len(data) || !got.Time.Equal(rec.Time) {
+		t.Fatalf("decoded %d bytes at %v, want %d at %v", n, got.Time, len(data), rec.Time)
+	}
+	for name, want := range rec.Points {
+		if p := got.Points[name]; p != want {
+			t.Errorf("%s = %+v, want %+v", name, p, want)
+		}
+	}
+	if _, _, err := decodeRecord(data[:len(data)-1], nil); err != errShortRecord {
+		t.Errorf("truncated record error = %v, want %v", err, errShortRecord)
+	}
+	data[len(data)-1] ^= 0xff
+	if _, _, err := decodeRecord(data, nil); err != errCorruptRecord {
+		t.Errorf("corrupted record error = %v, want %v", err, errCorruptRecord)
+	}
+}
+
+func TestQueryReturnsAppendedSamples(t *testing.T) {
+	s := openTestStore(t, t.TempDir())
+	defer s.Close()
+	appendSamples(t, s, 10)
+	if got := queryCount(t, s); got != 10 {
+		t.Fatalf("points = %d, want 10", got)
+	}
+}
+
+// 写入进行中的半条记录不在索引长度内，查询不应因此失败
+func TestQueryIgnoresBytesBeyondIndexedSize(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	defer s.Close()
+	appendSamples(t, s, 3)
+
+	file, err := os.OpenFile(rawSegment(t, dir), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := encodeRecord(Record{Time: testBase.Add(time.Minute), Points: map[string]history.Point{"cpu": {Avg: 9, Count: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write(partial[:len(partial)/2]); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if got := queryCount(t, s); got != 3 {
+		t.Fatalf("points = %d, want 3", got)
+	}
+}
+
+// 崩溃后索引可能与文件大小一致但尾部记录不完整，打开时应截断
+func TestOpenTruncatesTornTailWithMatchingIndex(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	appendSamples(t, s, 3)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	path := rawSegment(t, dir)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := info.Size()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0x20, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// 让索引记录的大小与损坏后的文件一致
+	indexPath := filepath.Join(dir, tierRaw, indexFile)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metas []segmentMeta
+	if err := json.Unmarshal(data, &metas); err != nil {
+		t.Fatal(err)
+	}
+	metas[len(metas)-1].Size = valid + 11
+	if data, err = json.Marshal(metas); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	if info, err := os.Stat(path); err != nil || info.Size() != valid {
+		t.Fatalf("segment size after open = %v (err %v), want %d", info.Size(), err, valid)
+	}
+	if got := queryCount(t, s); got != 3 {
+		t.Fatalf("points = %d, want 3", got)
+	}
+	// 截断后继续写入的记录可以正常读取
+	if err := s.Append(testBase.Add(time.Minute), map[string]float64{"cpu": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := queryCount(t, s); got != 4 {
+		t.Fatalf("points after append = %d, want 4", got)
+	}
+}
+
+// 超过 maxRecordSize 的记录在写入前被拒绝，重新打开时不会把它当作损坏截断之后的记录
+func TestAppendRejectsOversizedRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestStore(t, dir)
+	appendSamples(t, s, 2)
+	values := map[string]float64{"cpu": 1}
+	for i := range maxRecordSize / 16 {
+		values[fmt.Sprintf("disk_%06d", i)] = float64(i)
+	}
+	if err := s.Append(testBase.Add(time.Minute), values); !errors.Is(err, errRecordTooLarge) {
+		t.Fatalf("append oversized record error = %v, want %v", err, errRecordTooLarge)
+	}
+	if err := s.Append(testBase.Add(2*time.Minute), map[string]float64{"cpu": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	if got := queryCount(t, s); got != 3 {
+		t.Fatalf("points after reopen = %d, want 3", got)
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	indexFile      = "index.json"
+	maxSegmentSize = 16 << 20
+)
+
+// tier 一个分辨率层级（raw/1m/1h），由若干按时间排序的段文件组成
+type tier struct {
+	name        string
+	dir         string
+	resolution  time.Duration
+	retention   time.Duration
+	segmentSpan time.Duration
+	segments    []*segment
+}
+
+func openTier(root, name string, resolution, retention, segmentSpan time.Duration) (*tier, error) {
+	t := &tier{
+		name:        name,
+		dir:         filepath.Join(root, name),
+		resolution:  resolution,
+		retention:   retention,
+		segmentSpan: segmentSpan,
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return nil, err
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// load 读取索引并与目录中的段文件核对；大小不一致或索引缺失的段重新扫描
+// 最后一个段在崩溃时可能正在写入，即使大小与索引一致也重新扫描，截断尾部损坏的记录
+func (t *tier) load() error {
+	indexed := make(map[string]segmentMeta)
+	if data, err := os.ReadFile(filepath.Join(t.dir, indexFile)); err == nil {
+		var metas []segmentMeta
+		if err := json.Unmarshal(data, &metas); err != nil {
+			logx.Warn("Storage index corrupted, rebuilding | tier: %s | error: %v", t.name, err)
+		}
+		for _, meta := range metas {
+			indexed[meta.File] = meta
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return err
+	}
+	recovered := make(map[*segment]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		seg := &segment{path: filepath.Join(t.dir, name)}
+		if meta, ok := indexed[name]; ok && meta.Size == info.Size() {
+			seg.segmentMeta = meta
+		} else {
+			seg.File = name
+			seg.MinTime = time.Unix(0, nanos)
+			if err := seg.recover(); err != nil {
+				return err
+			}
+			recovered[seg] = true
+		}
+		t.segments = append(t.segments, seg)
+	}
+	slices.SortFunc(t.segments, func(a, b *segment) int {
+		return strings.Compare(a.File, b.File)
+	})
+	if last := t.active(); last != nil {
+		if !recovered[last] {
+			if err := last.recover(); err != nil {
+				return err
+			}
+		}
+		if err := last.openForAppend(); err != nil {
+			return err
+		}
+	}
+	return t.writeIndex()
+}
+
+func (t *tier) active() *segment {
+	if len(t.segments) == 0 {
+		return nil
+	}
+	return t.segments[len(t.segments)-1]
+}
+
+func (t *tier) append(rec Record) error {
+	data, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	seg := t.active()
+	if seg == nil || seg.Size >= maxSegmentSize || (seg.Count > 0 && rec.Time.Sub(seg.MinTime) >= t.segmentSpan) {
+		if err := t.roll(rec.Time); err != nil {
+			return err
+		}
+		seg = t.active()
+	}
+	return seg.write(rec, data)
+}
+
+// roll 封存当前段并创建新段
+func (t *tier) roll(start time.Time) error {
+	if seg := t.active(); seg != nil {
+		if err := seg.seal(); err != nil {
+			return err
+		}
+	}
+	seg, err := createSegment(t.dir, start)
+	if errors.Is(err, os.ErrExist) {
+		seg, err = createSegment(t.dir, start.Add(time.Nanosecond))
+	}
+	if err != nil {
+		return err
+	}
+	t.segments = append(t.segments, seg)
+	return t.writeIndex()
+}
+
+// writeIndex 原子地重写索引文件（先写临时文件再重命名）
+func (t *tier) writeIndex() error {
+	metas := make([]segmentMeta, 0, len(t.segments))
+	for _, seg := range t.segments {
+		metas = append(metas, seg.segmentMeta)
+	}
+	data, err := json.Marshal(metas)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(t.dir, indexFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(t.dir, indexFile))
+}
+
+// query 读取 [from, to] 范围内的记录，按时间升序回调
+func (t *tier) query(from, to time.Time, fields map[string]struct{}, fn func(Record)) error {
+	return querySegments(t.segments, from, to, fields, fn)
+}
+
+// snapshot 复制当前的段列表，调用方需持有存储锁
+func (t *tier) snapshot() []*segment {
+	segments := make([]*segment, 0, len(t.segments))
+	for _, seg := range t.segments {
+		segments = append(segments, seg.snapshot())
+	}
+	return segments
+}
+
+// querySegments 按时间升序读取段内 [from, to] 范围的记录，每个段只读取索引中记录的长度
+// 读取期间段可能已被保留策略删除，忽略不存在的段
+func querySegments(segments []*segment, from, to time.Time, fields map[string]struct{}, fn func(Record)) error {
+	for _, seg := range segments {
+		if seg.Count == 0 || seg.MaxTime.Before(from) || seg.MinTime.After(to) {
+			continue
+		}
+		if _, err := seg.scan(seg.Size, fields, func(rec Record) {
+			if rec.Time.Before(from) || rec.Time.After(to) {
+				return
+			}
+			fn(rec)
+		}); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tier) oldest() (time.Time, bool) {
+	for _, seg := range t.segments {
+		if seg.Count > 0 {
+			return seg.MinTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (t *tier) newest() (time.Time, bool) {
+	for i := len(t.segments) - 1; i >= 0; i-- {
+		if t.segments[i].Count > 0 {
+			return t.segments[i].MaxTime, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (t *tier) size() int64 {
+	var total int64
+	for _, seg := range t.segments {
+		total += seg.Size
+	}
+	return total
+}
+
+// expire 删除超过保留时长的已封存段
+func (t *tier) expire(now time.Time) error {
+	cutoff := now.Add(-t.retention)
+	removed := false
+	for len(t.segments) > 1 && t.segments[0].MaxTime.Before(cutoff) {
+		if err := t.removeOldest(); err != nil {
+			return err
+		}
+		removed = true
+	}
+	if removed {
+		return t.writeIndex()
+	}
+	return nil
+}
+
+// removeOldest 删除最旧的段，当前写入段不会被删除
+func (t *tier) removeOldest() error {
+	if len(t.segments) <= 1 {
+		return errors.New("no sealed segment to remove")
+	}
+	seg := t.segments[0]
+	if err := seg.remove(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	logx.Debug("Removed storage segment | tier: %s | file: %s", t.name, seg.File)
+	t.segments = t.segments[1:]
+	return nil
+}
+
+func (t *tier) close() error {
+	var errs []error
+	if seg := t.active(); seg != nil {
+		errs = append(errs, seg.seal())
+	}
+	errs = append(errs, t.writeIndex())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,337 @@
+package token
+
+import (
+	"chihqiang/hoststat/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+// signingKey HMAC-SHA256 签名密钥；RetiredAt 非零表示已被轮换，只用于校验，超过宽限期后删除
+type signingKey struct {
+	ID        string    `json:"id"`
+	Secret    []byte    `json:"secret"`
+	CreatedAt time.Time `json:"createdAt"`
+	RetiredAt time.Time `json:"retiredAt,omitzero"`
+}
+
+// configKeyState 配置中密钥的元数据，不保存密钥本身；按加盐指纹识别同一个密钥，
+// 使密钥ID在重启后保持不变，并记录旧密钥首次出现在 token.previousSecrets 中的时间
+type configKeyState struct {
+	ID          string    `json:"id"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"createdAt"`
+	RetiredAt   time.Time `json:"retiredAt,omitzero"`
+}
+
+// stateFile token.stateFile 的内容：自动生成的密钥、配置中密钥的元数据与吊销的会话
+type stateFile struct {
+	Keys       []*signingKey        `json:"keys"`
+	Salt       []byte               `json:"salt,omitempty"` // 计算配置密钥指纹的随机盐
+	ConfigKeys []*configKeyState    `json:"configKeys,omitempty"`
+	Revoked    map[string]time.Time `json:"revoked"` // 会话ID -> 令牌过期时间，过期后删除
+}
+
+// Store 会话签名密钥与吊销列表
+// 配置了 token.secret 时使用配置中的密钥（由运维人员轮换，token.previousSecrets 首次加载后 token.rotateGrace 内继续有效）；
+// 否则首次启动时生成密钥并保存在 token.stateFile 中，按 token.rotateInterval 自动轮换
+type Store struct {
+	mu         sync.Mutex
+	cfg        config.TokenConfig
+	fromConfig bool
+	keys       []*signingKey // keys[0] 为当前签名密钥
+	salt       []byte
+	configKeys []*configKeyState
+	revoked    map[string]time.Time
+}
+
+var store atomic.Pointer[Store]
+
+// Open 读取状态文件并准备签名密钥，文件不存在时创建
+func Open(cfg config.TokenConfig) (*Store, error) {
+	s := &Store{cfg: cfg, revoked: make(map[string]time.Time)}
+	var state stateFile
+	data, err := os.ReadFile(cfg.StateFile)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, errors.New("parse token state " + cfg.StateFile + ": " + err.Error())
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	if state.Revoked != nil {
+		s.revoked = state.Revoked
+	}
+	now := time.Now()
+	if cfg.Secret != "" {
+		s.fromConfig = true
+		s.salt = state.Salt
+		if len(s.salt) == 0 {
+			s.salt = make([]byte, 32)
+			if _, err := rand.Read(s.salt); err != nil {
+				return nil, err
+			}
+		}
+		s.keys = append(s.keys, s.configKey(cfg.Secret, state.ConfigKeys, time.Time{}, now))
+		for _, secret := range cfg.PreviousSecrets {
+			s.keys = append(s.keys, s.configKey(secret, state.ConfigKeys, now, now))
+		}
+	} else {
+		s.keys = state.Keys
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.maintain(now); err != nil {
+		return nil, err
+	}
+	if s.fromConfig {
+		// 保存新出现的配置密钥的 ID 与轮换时间
+		if err := s.save(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Use 替换当前生效的密钥存储
+// 重新加载配置时 next 在 Open 之后可能错过了当前存储上的吊销和轮换，切换前在当前存储的锁内合并：
+// 吊销记录取并集，两者都使用自动生成的密钥时沿用当前存储的密钥
+func Use(next *Store) {
+	prev := store.Load()
+	if prev == nil {
+		store.Store(next)
+		return
+	}
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	next.mu.Lock()
+	for sid, expires := range prev.revoked {
+		if _, ok := next.revoked[sid]; !ok {
+			next.revoked[sid] = expires
+		}
+	}
+	if !prev.fromConfig && !next.fromConfig {
+		next.keys = prev.keys
+	}
+	if err := next.save(); err != nil {
+		logx.Error("Session state save failed | file: %s | error: %v", next.cfg.StateFile, err)
+	}
+	next.mu.Unlock()
+	store.Store(next)
+}
+
+// lockCurrent 返回已加锁的当前存储；加锁期间存储被 Use 替换时改用新的存储，避免修改丢失
+func lockCurrent() (*Store, error) {
+	for {
+		s := store.Load()
+		if s == nil {
+			return nil, errors.New("session store is not initialized")
+		}
+		s.mu.Lock()
+		if store.Load() == s {
+			return s, nil
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Rotate 立即生成新的签名密钥，旧密钥在 grace 时间内仍可校验；grace 为 0 时所有已签发的会话立即失效
+// 使用配置中的密钥时不支持，需修改 token.secret 后重新加载配置
+func Rotate(grace time.Duration) (string, error) {
+	s, err := lockCurrent()
+	if err != nil {
+		return "", err
+	}
+	defer s.mu.Unlock()
+	if s.fromConfig {
+		return "", errors.New("signing key is set by token.secret, change it in the config and reload")
+	}
+	now := time.Now()
+	if err := s.rotate(now, grace); err != nil {
+		return "", err
+	}
+	if err := s.save(); err != nil {
+		return "", err
+	}
+	return s.keys[0].ID, nil
+}
+
+// Revoke 吊销会话，令牌过期前该会话都无法再使用
+func Revoke(sid string, expires time.Time) error {
+	s, err := lockCurrent()
+	if err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if expires.IsZero() || expires.Before(time.Now()) {
+		// 不知道过期时间时按最长有效期保留
+		expires = time.Now().Add(s.cfg.MaxAge.Std())
+	}
+	s.revoked[sid] = expires
+	return s.save()
+}
+
+func (s *Store) isRevoked(sid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.revoked[sid]
+	return ok
+}
+
+// signingKey 返回当前签名密钥，已到轮换时间时先轮换
+func (s *Store) signingKey(now time.Time) *signingKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.maintain(now); err != nil {
+		logx.Error("Session key maintenance failed | file: %s | error: %v", s.cfg.StateFile, err)
+	}
+	return s.keys[0]
+}
+
+// verifyKey 按 ID 查找可用于校验的密钥，已轮换的密钥超过宽限期后不再可用
+func (s *Store) verifyKey(id string, now time.Time) *signingKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.keys {
+		if key.ID != id {
+			continue
+		}
+		if !key.RetiredAt.IsZero() && now.Sub(key.RetiredAt) > s.cfg.RotateGrace.Std() {
+			return nil
+		}
+		return key
+	}
+	return nil
+}
+
+// maintain 生成或轮换密钥、清理过期的旧密钥和吊销记录，有变化时保存；调用方需持有锁
+func (s *Store) maintain(now time.Time) error {
+	changed := false
+	if !s.fromConfig {
+		if len(s.keys) == 0 || !s.keys[0].RetiredAt.IsZero() {
+			if err := s.rotate(now, 0); err != nil {
+				return err
+			}
+			changed = true
+		} else if now.Sub(s.keys[0].CreatedAt) > s.cfg.RotateInterval.Std() {
+			if err := s.rotate(now, s.cfg.RotateGrace.Std()); err != nil {
+				return err
+			}
+			changed = true
+		}
+		keys := s.keys[:1]
+		for _, key := range s.keys[1:] {
+			if now.Sub(key.RetiredAt) <= s.cfg.RotateGrace.Std() {
+				keys = append(keys, key)
+			} else {
+				changed = true
+			}
+		}
+		s.keys = keys
+	} else {
+		keys := s.keys[:1]
+		for _, key := range s.keys[1:] {
+			if now.Sub(key.RetiredAt) <= s.cfg.RotateGrace.Std() {
+				keys = append(keys, key)
+			} else {
+				logx.Warn("[SECURITY] Previous session secret expired, remove it from token.previousSecrets | key_id: %s | retired: %s", key.ID, key.RetiredAt.Format(time.RFC3339))
+			}
+		}
+		s.keys = keys
+	}
+	for sid, expires := range s.revoked {
+		if now.After(expires) {
+			delete(s.revoked, sid)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// rotate 生成新的当前密钥；grace 之后旧密钥不再可用（通过调整 RetiredAt 实现）。调用方需持有锁
+func (s *Store) rotate(now time.Time, grace time.Duration) error {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	retiredAt := now.Add(grace - s.cfg.RotateGrace.Std())
+	for _, key := range s.keys {
+		if key.RetiredAt.IsZero() || key.RetiredAt.After(retiredAt) {
+			key.RetiredAt = retiredAt
+		}
+	}
+	key := &signingKey{ID: randomID(4), Secret: secret, CreatedAt: now}
+	s.keys = append([]*signingKey{key}, s.keys...)
+	logx.Info("Session signing key rotated | key_id: %s | grace: %s", key.ID, grace)
+	return nil
+}
+
+// save 原子地写入状态文件，使用配置中的密钥时只保存密钥元数据和吊销记录；调用方需持有锁
+func (s *Store) save() error {
+	state := stateFile{Revoked: s.revoked}
+	if s.fromConfig {
+		state.Salt, state.ConfigKeys = s.salt, s.configKeys
+	} else {
+		state.Keys = s.keys
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(s.cfg.StateFile); dir != "." {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+	tmp := s.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.cfg.StateFile)
+}
+
+// configKey 返回配置中密钥对应的签名密钥：ID 随机生成，按指纹沿用状态文件中的 ID 和时间
+// retiredAt 非零表示来自 token.previousSecrets，已记录的轮换时间保持不变，宽限期从首次作为旧密钥加载时开始计算
+func (s *Store) configKey(secret string, known []*configKeyState, retiredAt, now time.Time) *signingKey {
+	mac := hmac.New(sha256.New, s.salt)
+	mac.Write([]byte(secret))
+	fingerprint := hex.EncodeToString(mac.Sum(nil))
+	var state *configKeyState
+	for _, k := range known {
+		if k.Fingerprint == fingerprint {
+			state = &configKeyState{ID: k.ID, Fingerprint: fingerprint, CreatedAt: k.CreatedAt, RetiredAt: k.RetiredAt}
+			break
+		}
+	}
+	if state == nil {
+		state = &configKeyState{ID: "c" + randomID(4), Fingerprint: fingerprint, CreatedAt: now}
+	}
+	switch {
+	case retiredAt.IsZero():
+		state.RetiredAt = time.Time{}
+	case state.RetiredAt.IsZero():
+		state.RetiredAt = retiredAt
+	}
+	s.configKeys = append(s.configKeys, state)
+	return &signingKey{ID: state.ID, Secret: []byte(secret), CreatedAt: state.CreatedAt, RetiredAt: state.RetiredAt}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -1,53 +1,200 @@
 package token
 
 import (
+	"chihqiang/hoststat/config"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chihqiang/logx"
+)
+
+const (
+	cookieName   = "token"
+	tokenVersion = "v1"
+)
+
+// 登录方式
+const (
+	MethodPassword = "password"
+	MethodOIDC     = "oidc"
 )
 
-func SetToken(w http.ResponseWriter, r *http.Request) {
-	headerByte, _ := json.Marshal(r.Header)
+// Claims 会话令牌携带的信息
+type Claims struct {
+	SessionID string `json:"sid"`
+	Subject   string `json:"sub,omitempty"`  // 登录的用户名，匿名会话为空
+	Method    string `json:"auth,omitempty"` // 登录方式：password、oidc
+	Role      string `json:"role,omitempty"` // 单点登录用户的角色
+	PwdGen    int64  `json:"pgen,omitempty"` // 本地用户登录时的密码版本，见 auth.User.Generation
+	Issuer    string `json:"iss,omitempty"`  // 单点登录的提供方
+	ClientID  string `json:"cid,omitempty"`  // 单点登录使用的客户端ID
+	IssuedAt  int64  `json:"iat"`            // Unix 秒
+	ExpiresAt int64  `json:"exp"`            // Unix 秒
+}
+
+// Expires 令牌的过期时间
+func (c *Claims) Expires() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// SetToken 为访问首页的浏览器签发匿名会话令牌；已持有的令牌剩余有效期超过一半时不重新签发
+// 令牌格式为 v1.<密钥ID>.<载荷>.<签名>，签名为 HMAC-SHA256；ip 为经过可信代理解析后的客户端地址，只用于日志
+func SetToken(w http.ResponseWriter, r *http.Request, ip string) {
+	if claims, err := Session(r); err == nil && claims.Expires().Sub(time.Now()) > config.Get().Token.MaxAge.Std()/2 {
+		return
+	}
+	if _, err := Issue(w, r, ip, Claims{}); err != nil {
+		logx.Error("Issue session token failed | remote_ip: %s | error: %v", ip, err)
+	}
+}
+
+// Issue 签发新会话并写入 Cookie；登录成功后调用，替换登录前的会话
+// claims 中只需填写登录信息（Subject、Method、Role、PwdGen、Issuer、ClientID），其余字段由签发时生成；
+// 填写 ExpiresAt 时使用其与 token.maxAge 中较早的过期时间；ip 与 SetToken 相同，只用于日志
+func Issue(w http.ResponseWriter, r *http.Request, ip string, claims Claims) (*Claims, error) {
+	now := time.Now()
+	value, issued, err := issue(claims, now)
+	if err != nil {
+		return nil, err
+	}
+	logx.Debug("Session issued | remote_ip: %s | sid: %s | user: %s | expires: %s", ip, issued.SessionID, issued.Subject, issued.Expires().Format("2006-01-02 15:04:05"))
 	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    base64.StdEncoding.EncodeToString(headerByte),
+		Name:     cookieName,
+		Value:    value,
 		Path:     "/",
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
-		Secure:   false,
-		MaxAge:   86400,
+		Secure:   r.TLS != nil,
+		MaxAge:   int(issued.Expires().Sub(now).Seconds()),
 	})
+	return issued, nil
 }
 
-// ValidateToken 验证token是否有效
-func ValidateToken(r *http.Request) error {
-	// 从请求中获取token cookie
-	cookie, err := r.Cookie("token")
+// Clear 删除浏览器中的会话 Cookie
+func Clear(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+		MaxAge:   -1,
+	})
+}
+
+// ValidateToken 验证token是否有效，返回会话信息
+func ValidateToken(r *http.Request) (*Claims, error) {
+	claims, err := Session(r)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if referer := r.Header.Get("Referer"); referer == "" {
+		return nil, errors.New("referer header is missing")
 	}
-	tokenValue := cookie.Value
-	decoded, err := base64.StdEncoding.DecodeString(tokenValue)
+	return claims, nil
+}
+
+// ValidateUpgrade 验证 WebSocket 握手请求：浏览器握手时不带 Referer，改为要求 Origin 与 Host 一致
+func ValidateUpgrade(r *http.Request) (*Claims, error) {
+	claims, err := Session(r)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var tokenHeader http.Header
-	if err = json.Unmarshal(decoded, &tokenHeader); err != nil {
-		return err
+	if err := SameOrigin(r); err != nil {
+		return nil, err
 	}
-	vHeaders := []string{
-		"User-Agent",
-		"Accept-Encoding",
-		"Host",
+	return claims, nil
+}
+
+// SameOrigin 要求 Origin 与 Host 一致，用于 WebSocket 握手和登录表单等不依赖已有会话的请求
+func SameOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return errors.New("origin header is missing")
 	}
-	for _, header := range vHeaders {
-		if r.Header.Get(header) != tokenHeader.Get(header) {
-			return errors.New("token header mismatch: " + header)
-		}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
 	}
-	if referer := r.Header.Get("Referer"); referer == "" {
-		return errors.New("referer header is missing")
+	if !strings.EqualFold(u.Host, r.Host) {
+		return errors.New("origin mismatch: " + u.Host)
 	}
 	return nil
 }
+
+// Session 校验请求中的会话令牌：签名、过期时间和吊销状态
+func Session(r *http.Request) (*Claims, error) {
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		return nil, err
+	}
+	return Verify(cookie.Value, time.Now())
+}
+
+func issue(claims Claims, now time.Time) (string, *Claims, error) {
+	s := store.Load()
+	if s == nil {
+		return "", nil, errors.New("session store is not initialized")
+	}
+	claims.SessionID = randomID(16)
+	claims.IssuedAt = now.Unix()
+	if expires := now.Add(config.Get().Token.MaxAge.Std()).Unix(); claims.ExpiresAt == 0 || claims.ExpiresAt > expires {
+		claims.ExpiresAt = expires
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	key := s.signingKey(now)
+	unsigned := tokenVersion + "." + key.ID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(key.Secret, unsigned), &claims, nil
+}
+
+// Verify 校验令牌并返回其中的信息
+func Verify(value string, now time.Time) (*Claims, error) {
+	s := store.Load()
+	if s == nil {
+		return nil, errors.New("session store is not initialized")
+	}
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 || parts[0] != tokenVersion {
+		return nil, errors.New("malformed token")
+	}
+	key := s.verifyKey(parts[1], now)
+	if key == nil {
+		return nil, errors.New("unknown or expired signing key: " + parts[1])
+	}
+	unsigned := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(sign(key.Secret, unsigned))) {
+		return nil, errors.New("invalid token signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	if now.After(claims.Expires()) {
+		return nil, errors.New("token expired")
+	}
+	if s.isRevoked(claims.SessionID) {
+		return nil, errors.New("session revoked: " + claims.SessionID)
+	}
+	return &claims, nil
+}
+
+func sign(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
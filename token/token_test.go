@@ -0,0 +1,172 @@
+package token
+
+import (
+	"chihqiang/hoststat/config"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig(t *testing.T) config.TokenConfig {
+	t.Helper()
+	cfg := config.Default()
+	config.Set(cfg)
+	store.Store(nil)
+	tc := cfg.Token
+	tc.StateFile = filepath.Join(t.TempDir(), "session.json")
+	return tc
+}
+
+func openStore(t *testing.T, cfg config.TokenConfig) *Store {
+	t.Helper()
+	s, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func mustIssue(t *testing.T, now time.Time) (string, *Claims) {
+	t.Helper()
+	value, claims, err := issue(Claims{Subject: "alice", Method: MethodPassword}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value, claims
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	cfg := testConfig(t)
+	Use(openStore(t, cfg))
+	now := time.Now()
+	value, issued := mustIssue(t, now)
+
+	claims, err := Verify(value, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "alice" || claims.SessionID != issued.SessionID {
+		t.Fatalf("claims = %+v, want %+v", claims, issued)
+	}
+
+	parts := strings.Split(value, ".")
+	parts[3] = sign([]byte("wrong secret"), strings.Join(parts[:3], "."))
+	if _, err := Verify(strings.Join(parts, "."), now); err == nil {
+		t.Error("token with a forged signature was accepted")
+	}
+	if _, err := Verify(value, now.Add(cfg.MaxAge.Std()+time.Second)); err == nil {
+		t.Error("expired token was accepted")
+	}
+	if err := Revoke(issued.SessionID, issued.Expires()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(value, now); err == nil {
+		t.Error("revoked token was accepted")
+	}
+}
+
+func TestRotateGrace(t *testing.T) {
+	cfg := testConfig(t)
+	Use(openStore(t, cfg))
+	now := time.Now()
+	value, _ := mustIssue(t, now)
+
+	if _, err := Rotate(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(value, now); err != nil {
+		t.Fatalf("token signed with the previous key rejected within grace: %v", err)
+	}
+	if _, err := Rotate(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(value, time.Now()); err == nil {
+		t.Fatal("token signed with a retired key accepted after rotating without grace")
+	}
+}
+
+// 配置密钥的 ID 随机生成并保存在状态文件中，不能由密钥推导
+func TestConfigKeyIDIsRandom(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Secret = strings.Repeat("s", 32)
+	first := openStore(t, cfg)
+	again := openStore(t, cfg)
+	if first.keys[0].ID != again.keys[0].ID {
+		t.Fatalf("key id changed after reopening the same state file: %s -> %s", first.keys[0].ID, again.keys[0].ID)
+	}
+
+	other := cfg
+	other.StateFile = filepath.Join(t.TempDir(), "session.json")
+	if id := openStore(t, other).keys[0].ID; id == first.keys[0].ID {
+		t.Fatalf("key id %s is the same for a different state file", id)
+	}
+	sum := sha256.Sum256([]byte(cfg.Secret))
+	if strings.Contains(first.keys[0].ID, hex.EncodeToString(sum[:4])) {
+		t.Fatalf("key id %s is derived from the secret", first.keys[0].ID)
+	}
+}
+
+// token.previousSecrets 中的旧密钥从首次加载起 token.rotateGrace 内有效，重新打开不会延长
+func TestPreviousSecretExpires(t *testing.T) {
+	cfg := testConfig(t)
+	oldSecret := strings.Repeat("o", 32)
+	cfg.Secret = oldSecret
+	Use(openStore(t, cfg))
+	now := time.Now()
+	value, _ := mustIssue(t, now)
+
+	cfg.Secret = strings.Repeat("n", 32)
+	cfg.PreviousSecrets = []string{oldSecret}
+	rotated := openStore(t, cfg)
+	Use(rotated)
+	if _, err := Verify(value, now); err != nil {
+		t.Fatalf("token signed with the previous secret rejected: %v", err)
+	}
+	if _, err := Verify(value, now.Add(cfg.RotateGrace.Std()+time.Minute)); err == nil {
+		t.Fatal("token signed with the previous secret accepted after the grace period")
+	}
+
+	retiredAt := rotated.keys[1].RetiredAt
+	reopened := openStore(t, cfg)
+	if len(reopened.keys) != 2 || !reopened.keys[1].RetiredAt.Equal(retiredAt) {
+		t.Fatalf("previous secret retired at %v after reopening, want %v", reopened.keys[1].RetiredAt, retiredAt)
+	}
+}
+
+// 重新加载期间在旧存储上的吊销在切换后仍然有效
+func TestUseKeepsRevocationsMadeDuringReload(t *testing.T) {
+	cfg := testConfig(t)
+	Use(openStore(t, cfg))
+	now := time.Now()
+	value, claims := mustIssue(t, now)
+
+	next := openStore(t, cfg)
+	if err := Revoke(claims.SessionID, claims.Expires()); err != nil {
+		t.Fatal(err)
+	}
+	Use(next)
+	if _, err := Verify(value, now); err == nil {
+		t.Fatal("session revoked during reload is accepted by the new store")
+	}
+	if _, ok := openStore(t, cfg).revoked[claims.SessionID]; !ok {
+		t.Fatal("merged revocation was not saved")
+	}
+}
+
+// 调用方填写的过期时间只能缩短会话有效期
+func TestIssueCapsExpiry(t *testing.T) {
+	cfg := testConfig(t)
+	Use(openStore(t, cfg))
+	now := time.Now()
+	short := now.Add(time.Hour).Unix()
+	if _, claims, err := issue(Claims{Subject: "alice", ExpiresAt: short}, now); err != nil || claims.ExpiresAt != short {
+		t.Fatalf("expires = %v, %v, want %d", claims, err, short)
+	}
+	limit := now.Add(cfg.MaxAge.Std()).Unix()
+	if _, claims, err := issue(Claims{Subject: "alice", ExpiresAt: now.Add(cfg.MaxAge.Std() * 2).Unix()}, now); err != nil || claims.ExpiresAt != limit {
+		t.Fatalf("expires = %v, %v, want token.maxAge %d", claims, err, limit)
+	}
+}
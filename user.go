@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"chihqiang/hoststat/auth"
+	"chihqiang/hoststat/config"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	userUsage         = "usage: hoststat user add|passwd|del <username> | hoststat user list"
+	minPasswordLength = 8
+)
+
+// runUserCommand 管理 auth.usersFile 中的本地用户；运行中的服务会自动读取变化，无需重启
+// 修改密码或删除用户后，该用户已登录的会话立即失效
+func runUserCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+	path := cfg.Auth.UsersFile
+	file, err := auth.ReadUserFile(path)
+	if err != nil {
+		return err
+	}
+	if args[0] == "list" {
+		for _, user := range file.Users {
+			fmt.Printf("%s\tcreated: %s\tpassword changed: %s\n", user.Name,
+				user.CreatedAt.Format("2006-01-02 15:04:05"), user.PasswordChangedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return errors.New(userUsage)
+	}
+	name, now := args[1], time.Now()
+	switch args[0] {
+	case "add":
+		if file.Find(name) != nil {
+			return fmt.Errorf("user %q already exists", name)
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := file.Add(name, password, now); err != nil {
+			return err
+		}
+	case "passwd":
+		if file.Find(name) == nil {
+			return fmt.Errorf("user %q not found", name)
+		}
+		password, err := readPassword()
+		if err != nil {
+			return err
+		}
+		if err := file.SetPassword(name, password, now); err != nil {
+			return err
+		}
+	case "del":
+		if err := file.Delete(name); err != nil {
+			return err
+		}
+	default:
+		return errors.New(userUsage)
+	}
+	if err := file.Write(path); err != nil {
+		return err
+	}
+	auditCommand("user."+args[0], map[string]any{"user": name, "file": path})
+	fmt.Printf("user %s: %s (%s)\n", args[0], name, path)
+	return nil
+}
+
+// readPassword 终端中无回显地输入两次密码；否则从标准输入读取一行，便于脚本调用
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		return checkPassword(strings.TrimRight(line, "\r\n"))
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", errors.New("passwords do not match")
+	}
+	return checkPassword(string(first))
+}
+
+func checkPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return password, nil
+}